@@ -1,12 +1,17 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/charmbracelet/log"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
 	"io"
+	"macdent-ai-chatbot/internal/clients"
 	"macdent-ai-chatbot/internal/configs"
 	"macdent-ai-chatbot/internal/databases"
 	"macdent-ai-chatbot/internal/services/agent"
@@ -14,12 +19,16 @@ import (
 	"macdent-ai-chatbot/internal/services/knowledge"
 	"macdent-ai-chatbot/internal/utils"
 	"mime/multipart"
+	"strconv"
 )
 
 type AgentHandler struct {
 	config    *configs.ApiServerConfig
 	postgres  *databases.PostgresDatabase
 	qdrant    *databases.QdrantDatabase
+	denttime  *clients.Client
+	ingestion *knowledge.IngestionQueue
+	sources   *knowledge.SourceScheduler
 	validator *validator.Validate
 	loggger   *log.Logger
 }
@@ -27,12 +36,17 @@ type AgentHandler struct {
 func NewAgentHandler(config *configs.ApiServerConfig) *AgentHandler {
 	postgres := databases.NewPostgres(config.Postgres)
 	qdrant := databases.NewQdrant(config.Qdrant)
+	denttime := clients.NewClient(config.Denttime)
 	logger := utils.NewLogger("handler")
+	ingestion := knowledge.NewIngestionQueue(postgres, qdrant)
 
 	return &AgentHandler{
 		config:    config,
 		postgres:  postgres,
 		qdrant:    qdrant,
+		denttime:  denttime,
+		ingestion: ingestion,
+		sources:   knowledge.NewSourceScheduler(postgres, qdrant, ingestion),
 		validator: validator.New(),
 		loggger:   logger,
 	}
@@ -157,7 +171,7 @@ func (h *AgentHandler) UpdateAgent(c fiber.Ctx) error {
 	}
 
 	updatedAgent, errorResponse := agent.NewService().
-		UpdateAgent(&request, h.postgres)
+		UpdateAgent(&request, h.postgres, h.qdrant)
 
 	if errorResponse != nil {
 		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
@@ -172,10 +186,32 @@ func (h *AgentHandler) UpdateAgent(c fiber.Ctx) error {
 }
 
 func (h *AgentHandler) DeleteAgent(c fiber.Ctx) error {
-	// TODO: Реализовать удаление агента
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
-	})
+	request := agent.DeleteAgentRequest{
+		AgentID: c.Params("id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	errorResponse := agent.NewService().
+		DeleteAgent(&request, h.postgres, h.qdrant)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
 }
 
 func (h *AgentHandler) UploadKnowledge(c fiber.Ctx) error {
@@ -205,41 +241,26 @@ func (h *AgentHandler) UploadKnowledge(c fiber.Ctx) error {
 			})
 		}
 
-		err = func() error {
-			fileStream, err := file.Open()
-			if err != nil {
-				return err
-			}
-			defer func(fileStream multipart.File) {
-				if closeErr := fileStream.Close(); closeErr != nil {
-					h.loggger.Errorf("закрытие файла: %v", closeErr)
-				}
-			}(fileStream)
-
-			content, err := io.ReadAll(fileStream)
-			if err != nil {
-				return err
-			}
-
-			knowledgeFile := knowledge.Knowledge{
-				Name:    file.Filename,
-				Size:    file.Size,
-				Type:    file.Header.Get("Content-Type"),
-				Content: content,
-			}
-
-			request.Files = append(request.Files, knowledgeFile)
-			return nil
-		}()
-
+		knowledgeFile, err := h.readKnowledgeFile(file)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"ошибка": "Ошибка обработки файла",
 				"детали": err.Error(),
 			})
 		}
+
+		request.Files = append(request.Files, knowledgeFile)
 	}
 
+	chunking, err := readChunkingForm(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные параметры разбиения на чанки",
+			"детали": err.Error(),
+		})
+	}
+	request.Chunking = chunking
+
 	if err := h.validator.Struct(&request); err != nil {
 		var validationErrors validator.ValidationErrors
 		if errors.As(err, &validationErrors) {
@@ -250,8 +271,8 @@ func (h *AgentHandler) UploadKnowledge(c fiber.Ctx) error {
 		}
 	}
 
-	errorResponse := knowledge.NewService(h.postgres, h.qdrant).
-		UploadKnowledge(&request)
+	result, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		UploadKnowledge(&request, h.ingestion)
 
 	if errorResponse != nil {
 		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
@@ -260,59 +281,269 @@ func (h *AgentHandler) UploadKnowledge(c fiber.Ctx) error {
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"сообщение": "Файлы успешно загружены",
+	if len(result.Jobs) == 0 {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"сообщение": "Файлы загружены",
+			"data":      result,
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"сообщение": "Файлы поставлены в очередь обработки",
+		"data":      result,
 	})
 }
 
-func (h *AgentHandler) GetKnowledge(c fiber.Ctx) error {
-	// TODO: Реализовать получение базы знаний
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+func (h *AgentHandler) CreateKnowledgeSource(c fiber.Ctx) error {
+	var request knowledge.CreateKnowledgeSourceRequest
+
+	if err := c.Bind().JSON(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильное тело запроса",
+			"детали": err.Error(),
+		})
+	}
+	request.AgentID = c.Params("id")
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	source, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		CreateKnowledgeSource(&request, h.sources)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"сообщение": "Источник поставлен в очередь загрузки",
+		"data":      source,
 	})
 }
 
-func (h *AgentHandler) DeleteKnowledge(c fiber.Ctx) error {
-	// TODO: Реализовать удаление базы знаний
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+func (h *AgentHandler) GetKnowledgeSources(c fiber.Ctx) error {
+	request := knowledge.GetKnowledgeSourcesRequest{
+		AgentID: c.Params("id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	sources, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		GetKnowledgeSources(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": sources,
 	})
 }
 
-func (h *AgentHandler) GetDialogs(c fiber.Ctx) error {
-	// TODO: Реализовать получение диалогов агента
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+func (h *AgentHandler) RefreshKnowledgeSource(c fiber.Ctx) error {
+	request := knowledge.KnowledgeSourceRequest{
+		AgentID:  c.Params("id"),
+		SourceID: c.Params("source_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	source, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		RefreshKnowledgeSource(&request, h.sources)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"сообщение": "Источник поставлен в очередь обновления",
+		"data":      source,
 	})
 }
 
-func (h *AgentHandler) DeleteDialogs(c fiber.Ctx) error {
-	// TODO: Реализовать удаление всех диалогов агента
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+func (h *AgentHandler) DeleteKnowledgeSource(c fiber.Ctx) error {
+	request := knowledge.KnowledgeSourceRequest{
+		AgentID:  c.Params("id"),
+		SourceID: c.Params("source_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		DeleteKnowledgeSource(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"сообщение": "Источник удален",
 	})
 }
 
-func (h *AgentHandler) CreateDialog(c fiber.Ctx) error {
-	// TODO: Реализовать создание диалога
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+// readChunkingForm читает необязательные параметры разбиения на чанки из полей multipart формы
+func readChunkingForm(c fiber.Ctx) (knowledge.ChunkingRequest, error) {
+	chunking := knowledge.ChunkingRequest{
+		ChunkingStrategy: c.FormValue("chunking_strategy"),
+	}
+
+	for field, target := range map[string]*int{
+		"chunk_size":    &chunking.ChunkSize,
+		"chunk_overlap": &chunking.ChunkOverlap,
+	} {
+		value := c.FormValue(field)
+		if value == "" {
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return chunking, fmt.Errorf("%s должно быть числом", field)
+		}
+		*target = number
+	}
+
+	return chunking, nil
+}
+
+// readKnowledgeFile читает загруженный файл multipart формы
+func (h *AgentHandler) readKnowledgeFile(file *multipart.FileHeader) (knowledge.Knowledge, error) {
+	fileStream, err := file.Open()
+	if err != nil {
+		return knowledge.Knowledge{}, err
+	}
+	defer func(fileStream multipart.File) {
+		if closeErr := fileStream.Close(); closeErr != nil {
+			h.loggger.Errorf("закрытие файла: %v", closeErr)
+		}
+	}(fileStream)
+
+	content, err := io.ReadAll(fileStream)
+	if err != nil {
+		return knowledge.Knowledge{}, err
+	}
+
+	return knowledge.Knowledge{
+		Name:    file.Filename,
+		Size:    file.Size,
+		Type:    file.Header.Get("Content-Type"),
+		Content: content,
+	}, nil
+}
+
+func (h *AgentHandler) GetKnowledge(c fiber.Ctx) error {
+	request := knowledge.GetKnowledgeRequest{
+		AgentID: c.Params("id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	agentKnowledge, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		GetKnowledge(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": agentKnowledge,
 	})
 }
 
-func (h *AgentHandler) ResponseDialog(c fiber.Ctx) error {
-	agentID := c.Params("id")
+func (h *AgentHandler) DeleteKnowledge(c fiber.Ctx) error {
+	request := knowledge.DeleteKnowledgeRequest{
+		AgentID: c.Params("id"),
+	}
 
-	var request dialog.UserDialogNewMessageRequest
-	request.AgentID = agentID
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
 
-	if err := c.Bind().JSON(&request); err != nil {
+	if err != nil && len(validationErrors) > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"ошибка": "Неправильное тело запроса",
-			"детали": err.Error(),
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		DeleteKnowledge(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
 		})
 	}
 
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AgentHandler) GetKnowledgeChunks(c fiber.Ctx) error {
+	request := knowledge.GetKnowledgeChunksRequest{
+		AgentID: c.Params("id"),
+		FileID:  c.Params("file_id"),
+	}
+
 	err := h.validator.Struct(&request)
 	var validationErrors validator.ValidationErrors
 	errors.As(err, &validationErrors)
@@ -324,8 +555,8 @@ func (h *AgentHandler) ResponseDialog(c fiber.Ctx) error {
 		})
 	}
 
-	agentMessage, errorResponse := dialog.NewService().
-		ResponseDialogNewMessageRequest(&request, h.postgres)
+	chunks, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		GetKnowledgeChunks(&request)
 
 	if errorResponse != nil {
 		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
@@ -335,20 +566,499 @@ func (h *AgentHandler) ResponseDialog(c fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"data": agentMessage,
+		"data": chunks,
 	})
 }
 
-func (h *AgentHandler) GetDialog(c fiber.Ctx) error {
-	// TODO: Реализовать получение конкретного диалога
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+func (h *AgentHandler) ReplaceKnowledgeFile(c fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Не передан файл для замены",
+		})
+	}
+
+	if file.Size == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Файл не должен быть пустым",
+		})
+	}
+
+	knowledgeFile, err := h.readKnowledgeFile(file)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ошибка": "Ошибка обработки файла",
+			"детали": err.Error(),
+		})
+	}
+
+	chunking, err := readChunkingForm(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные параметры разбиения на чанки",
+			"детали": err.Error(),
+		})
+	}
+
+	request := knowledge.ReplaceKnowledgeFileRequest{
+		AgentID:  c.Params("id"),
+		FileID:   c.Params("file_id"),
+		File:     knowledgeFile,
+		Chunking: chunking,
+	}
+
+	err = h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	job, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		ReplaceKnowledgeFile(&request, h.ingestion)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"data": job,
 	})
 }
 
-func (h *AgentHandler) DeleteDialog(c fiber.Ctx) error {
-	// TODO: Реализовать удаление конкретного диалога
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"сообщение": "Метод не реализован",
+func (h *AgentHandler) GetKnowledgeJob(c fiber.Ctx) error {
+	request := knowledge.GetKnowledgeJobRequest{
+		AgentID: c.Params("id"),
+		JobID:   c.Params("job_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	job, errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		GetKnowledgeJob(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": job,
+	})
+}
+
+func (h *AgentHandler) DeleteKnowledgeFile(c fiber.Ctx) error {
+	request := knowledge.DeleteKnowledgeFileRequest{
+		AgentID: c.Params("id"),
+		FileID:  c.Params("file_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		DeleteKnowledgeFile(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AgentHandler) DeleteKnowledgePrompt(c fiber.Ctx) error {
+	request := knowledge.DeleteKnowledgePromptRequest{
+		AgentID:  c.Params("id"),
+		PromptID: c.Params("prompt_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	errorResponse := knowledge.NewService(h.postgres, h.qdrant).
+		DeleteKnowledgePrompt(&request)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AgentHandler) GetDialogs(c fiber.Ctx) error {
+	var request dialog.GetDialogsRequest
+
+	if err := c.Bind().Query(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные параметры запроса",
+			"детали": err.Error(),
+		})
+	}
+
+	request.AgentID = c.Params("id")
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	dialogs, errorResponse := dialog.NewService().
+		GetDialogs(&request, h.postgres)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": dialogs,
+	})
+}
+
+func (h *AgentHandler) DeleteDialogs(c fiber.Ctx) error {
+	request := dialog.DeleteDialogsRequest{
+		AgentID: c.Params("id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	deleted, errorResponse := dialog.NewService().
+		DeleteDialogs(&request, h.postgres)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{"deleted": deleted},
+	})
+}
+
+func (h *AgentHandler) CreateDialog(c fiber.Ctx) error {
+	var request dialog.CreateDialogRequest
+
+	if len(c.Body()) > 0 {
+		if err := c.Bind().JSON(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ошибка": "Неправильное тело запроса",
+				"детали": err.Error(),
+			})
+		}
+	}
+
+	request.AgentID = c.Params("id")
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	thread, errorResponse := dialog.NewService().
+		CreateDialog(&request, h.postgres)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"data": thread,
+	})
+}
+
+func (h *AgentHandler) ResponseDialog(c fiber.Ctx) error {
+	agentID := c.Params("id")
+
+	var request dialog.UserDialogNewMessageRequest
+	request.AgentID = agentID
+
+	if err := c.Bind().JSON(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильное тело запроса",
+			"детали": err.Error(),
+		})
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	agentResponse, errorResponse := dialog.NewService().
+		ResponseDialogNewMessageRequest(&request, h.postgres, h.qdrant, h.denttime)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	response := fiber.Map{
+		"data": agentResponse.Message,
+	}
+	if len(agentResponse.PendingActions) > 0 {
+		response["pending_actions"] = agentResponse.PendingActions
+	}
+	if request.Debug {
+		response["trace"] = agentResponse.Trace
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *AgentHandler) ConfirmPendingAction(c fiber.Ctx) error {
+	return h.resolvePendingAction(c, true)
+}
+
+func (h *AgentHandler) RejectPendingAction(c fiber.Ctx) error {
+	return h.resolvePendingAction(c, false)
+}
+
+func (h *AgentHandler) resolvePendingAction(c fiber.Ctx, confirmed bool) error {
+	var request dialog.ResolvePendingActionRequest
+
+	if err := c.Bind().JSON(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильное тело запроса",
+			"детали": err.Error(),
+		})
+	}
+
+	request.AgentID = c.Params("id")
+	request.ActionID = c.Params("action_id")
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	result, errorResponse := dialog.NewService().
+		ResolvePendingAction(&request, confirmed, h.postgres, h.denttime)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": result,
+	})
+}
+
+func (h *AgentHandler) StreamDialog(c fiber.Ctx) error {
+	agentID := c.Params("id")
+
+	var request dialog.UserDialogNewMessageRequest
+	request.AgentID = agentID
+
+	if err := c.Bind().JSON(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильное тело запроса",
+			"детали": err.Error(),
+		})
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	dialogService := dialog.NewService()
+
+	conversation, errorResponse := dialogService.
+		PrepareConversation(&request, h.postgres, h.qdrant, h.denttime)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		// Ошибка записи означает, что клиент отключился: ответ и инструменты для него больше не выполняются
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dialogService.StreamConversation(ctx, conversation, h.postgres, h.denttime, func(event dialog.StreamEvent) {
+			if ctx.Err() != nil {
+				return
+			}
+
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				h.loggger.Errorf("сериализация SSE события %s: %v", event.Name, err)
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, data); err != nil {
+				h.loggger.Warnf("отправка SSE события %s: %v", event.Name, err)
+				cancel()
+				return
+			}
+
+			if err := w.Flush(); err != nil {
+				h.loggger.Warnf("отправка SSE события %s: %v", event.Name, err)
+				cancel()
+			}
+		})
+	})
+}
+
+func (h *AgentHandler) GetDialog(c fiber.Ctx) error {
+	request := dialog.GetDialogRequest{
+		AgentID: c.Params("id"),
+		UserID:  c.Params("user_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	thread, errorResponse := dialog.NewService().
+		GetDialog(&request, h.postgres)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": thread,
+	})
+}
+
+func (h *AgentHandler) DeleteDialog(c fiber.Ctx) error {
+	request := dialog.DeleteDialogRequest{
+		AgentID: c.Params("id"),
+		UserID:  c.Params("user_id"),
+	}
+
+	err := h.validator.Struct(&request)
+	var validationErrors validator.ValidationErrors
+	errors.As(err, &validationErrors)
+
+	if err != nil && len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ошибка": "Неправильные данные запроса",
+			"детали": validationErrors.Error(),
+		})
+	}
+
+	deleted, errorResponse := dialog.NewService().
+		DeleteDialog(&request, h.postgres)
+
+	if errorResponse != nil {
+		return c.Status(errorResponse.StatusCode).JSON(fiber.Map{
+			"ошибка": errorResponse.Message,
+			"детали": errorResponse.Details,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{"deleted": deleted},
 	})
 }
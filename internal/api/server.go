@@ -8,6 +8,7 @@ import (
 	"github.com/gofiber/fiber/v3/middleware/logger"
 	"github.com/gofiber/fiber/v3/middleware/recover"
 	"macdent-ai-chatbot/internal/configs"
+	"macdent-ai-chatbot/internal/services/agent"
 	"macdent-ai-chatbot/internal/utils"
 	"strconv"
 )
@@ -67,6 +68,13 @@ func (s *Server) Setup() {
 	api := s.app.Group("/api/v1")
 
 	agentHandler := NewAgentHandler(s.config)
+
+	// Удаляем коллекции Qdrant, оставшиеся от агентов, удаление которых не завершилось
+	go agent.NewService().CleanupDeletedAgents(agentHandler.postgres, agentHandler.qdrant)
+	// Запускаем фоновую индексацию файлов и возобновляем прерванные задачи
+	agentHandler.ingestion.Start()
+	// Запускаем обновление сайтов, загружаемых в базу знаний, по расписанию
+	agentHandler.sources.Start()
 	agents := api.Group("/agents")
 
 	// Создание агента
@@ -87,11 +95,43 @@ func (s *Server) Setup() {
 	agents.Get("/:id/knowledge", agentHandler.GetKnowledge)
 	// Удаление базы знаний
 	agents.Delete("/:id/knowledge", agentHandler.DeleteKnowledge)
+	// Получение чанков файла базы знаний
+	agents.Get("/:id/knowledge/files/:file_id/chunks", agentHandler.GetKnowledgeChunks)
+	// Получение состояния задачи индексации файла
+	agents.Get("/:id/knowledge/jobs/:job_id", agentHandler.GetKnowledgeJob)
+	// Замена содержимого файла базы знаний
+	agents.Put("/:id/knowledge/files/:file_id", agentHandler.ReplaceKnowledgeFile)
+	// Удаление файла базы знаний вместе с его чанками
+	agents.Delete("/:id/knowledge/files/:file_id", agentHandler.DeleteKnowledgeFile)
+	// Удаление промпта базы знаний
+	agents.Delete("/:id/knowledge/prompts/:prompt_id", agentHandler.DeleteKnowledgePrompt)
+	// Добавление страницы или sitemap сайта в базу знаний
+	agents.Post("/:id/knowledge/sources", agentHandler.CreateKnowledgeSource)
+	// Получение сайтов, загружаемых в базу знаний
+	agents.Get("/:id/knowledge/sources", agentHandler.GetKnowledgeSources)
+	// Внеочередное обновление сайта
+	agents.Post("/:id/knowledge/sources/:source_id/refresh", agentHandler.RefreshKnowledgeSource)
+	// Удаление сайта вместе с загруженными страницами
+	agents.Delete("/:id/knowledge/sources/:source_id", agentHandler.DeleteKnowledgeSource)
 
 	// Получение диалогов агента
 	agents.Get("/:id/dialogs", agentHandler.GetDialogs)
+	// Удаление всех диалогов агента
+	agents.Delete("/:id/dialogs", agentHandler.DeleteDialogs)
+	// Создание нового диалога
+	agents.Post("/:id/dialogs/new", agentHandler.CreateDialog)
 	// Запрос на ответ диалогу
 	agents.Post("/:id/dialogs", agentHandler.ResponseDialog)
+	// Потоковый (SSE) ответ диалогу
+	agents.Post("/:id/dialogs/stream", agentHandler.StreamDialog)
+	// Подтверждение действия, ожидающего согласия пользователя
+	agents.Post("/:id/dialogs/actions/:action_id/confirm", agentHandler.ConfirmPendingAction)
+	// Отказ от действия, ожидающего согласия пользователя
+	agents.Post("/:id/dialogs/actions/:action_id/reject", agentHandler.RejectPendingAction)
+	// Получение диалога пользователя со всеми репликами
+	agents.Get("/:id/dialogs/:user_id", agentHandler.GetDialog)
+	// Удаление истории пользователя
+	agents.Delete("/:id/dialogs/:user_id", agentHandler.DeleteDialog)
 
 	openaiHandler := NewOpenAIHandler()
 	openai := api.Group("/openai")
@@ -1,11 +1,8 @@
 package clients
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"macdent-ai-chatbot/internal/utils"
-	"net/http"
 	"net/url"
 	"strconv"
 )
@@ -39,11 +36,47 @@ type CreateAppointmentResponse struct {
 	Response    int             `json:"response"`
 }
 
-func CreateAppointment(request CreateAppointmentRequest) (*CreateAppointmentResponse, *utils.UserErrorResponse) {
-	logger := utils.NewLogger("clients:createAppointment")
+type UpdateAppointmentRequest struct {
+	AccessToken          string `json:"access_token"`
+	AppointmentID        int    `json:"id"`
+	AppointmentDate      string `json:"date"`
+	AppointmentStartTime string `json:"start"`
+	AppointmentEndTime   string `json:"end"`
+}
+
+type UpdateAppointmentResponse struct {
+	Appointment AppointmentInfo `json:"zapis"`
+	Response    int             `json:"response"`
+}
+
+type CancelAppointmentRequest struct {
+	AccessToken   string `json:"access_token"`
+	AppointmentID int    `json:"id"`
+	Reason        string `json:"comment"`
+}
+
+type CancelAppointmentResponse struct {
+	Response int `json:"response"`
+}
+
+type FindAppointmentsRequest struct {
+	AccessToken string `json:"access_token"`
+	DoctorID    int    `json:"doctor"`
+	PatientID   int    `json:"patient"`
+	DateFrom    string `json:"dateFrom"`
+	DateTo      string `json:"dateTo"`
+	Page        int    `json:"page"`
+}
 
-	baseURL := BaseURL + "zapis/add"
+type FindAppointmentsResponse struct {
+	Appointments []AppointmentInfo `json:"zapisi"`
+	Count        string            `json:"count"`
+	AtPage       int               `json:"atPage"`
+	MaxPage      int               `json:"maxPage"`
+	Response     int               `json:"response"`
+}
 
+func (c *Client) CreateAppointment(ctx context.Context, request CreateAppointmentRequest) (*CreateAppointmentResponse, *utils.UserErrorResponse) {
 	params := url.Values{}
 	params.Add("access_token", request.AccessToken)
 	params.Add("doctor", strconv.Itoa(request.DoctorID))
@@ -52,75 +85,95 @@ func CreateAppointment(request CreateAppointmentRequest) (*CreateAppointmentResp
 	params.Add("start", request.AppointmentStartTime)
 	params.Add("end", request.AppointmentEndTime)
 
-	fullURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-	logger.Infof("создание записи на приём по URL: %s", fullURL)
-
-	req, err := http.NewRequest(http.MethodPost, fullURL, nil)
-	if err != nil {
-		logger.Errorf("создание запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при создании запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	var response CreateAppointmentResponse
+	if errorResponse := c.post(ctx, "zapis/add", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("выполнение запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			logger.Fatalf("закрытие тела ответа: %v", err)
-		}
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Errorf("чтение ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при чтении ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	return &response, nil
+}
+
+func (c *Client) UpdateAppointment(ctx context.Context, request UpdateAppointmentRequest) (*UpdateAppointmentResponse, *utils.UserErrorResponse) {
+	params := url.Values{}
+	params.Add("access_token", request.AccessToken)
+	params.Add("id", strconv.Itoa(request.AppointmentID))
+	params.Add("date", request.AppointmentDate)
+	params.Add("start", request.AppointmentStartTime)
+	params.Add("end", request.AppointmentEndTime)
+
+	var response UpdateAppointmentResponse
+	if errorResponse := c.post(ctx, "zapis/edit", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Errorf("получен неверный статус запроса: %d", resp.StatusCode)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	return &response, nil
+}
+
+func (c *Client) CancelAppointment(ctx context.Context, request CancelAppointmentRequest) (*CancelAppointmentResponse, *utils.UserErrorResponse) {
+	params := url.Values{}
+	params.Add("access_token", request.AccessToken)
+	params.Add("id", strconv.Itoa(request.AppointmentID))
+	params.Add("comment", request.Reason)
+
+	var response CancelAppointmentResponse
+	if errorResponse := c.post(ctx, "zapis/cancel", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	var response CreateAppointmentResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		logger.Errorf("десериализация ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при обработке ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	return &response, nil
+}
+
+func (c *Client) FindAppointments(ctx context.Context, request *FindAppointmentsRequest) (*FindAppointmentsResponse, *utils.UserErrorResponse) {
+	params := url.Values{}
+	params.Add("access_token", request.AccessToken)
+	if request.DoctorID > 0 {
+		params.Add("doctor", strconv.Itoa(request.DoctorID))
+	}
+	if request.PatientID > 0 {
+		params.Add("patient", strconv.Itoa(request.PatientID))
+	}
+	if request.DateFrom != "" {
+		params.Add("dateFrom", request.DateFrom)
+	}
+	if request.DateTo != "" {
+		params.Add("dateTo", request.DateTo)
+	}
+	if request.Page > 0 {
+		params.Add("page", strconv.Itoa(request.Page))
 	}
 
-	if response.Response != 1 {
-		logger.Errorf("API вернул неуспешный ответ: %d", response.Response)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"API вернул ошибку",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	var response FindAppointmentsResponse
+	if errorResponse := c.get(ctx, "zapis/find", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
 	return &response, nil
 }
+
+// FindAllAppointments загружает записи со всех страниц, но не более maxPages страниц
+func (c *Client) FindAllAppointments(ctx context.Context, request *FindAppointmentsRequest, maxPages int) (*FindAppointmentsResponse, *utils.UserErrorResponse) {
+	appointments, atPage, maxPage, errorResponse := fetchPages(ctx, maxPages,
+		func(ctx context.Context, page int) ([]AppointmentInfo, int, *utils.UserErrorResponse) {
+			pageRequest := *request
+			pageRequest.Page = page
+
+			response, errorResponse := c.FindAppointments(ctx, &pageRequest)
+			if errorResponse != nil {
+				return nil, 0, errorResponse
+			}
+
+			return response.Appointments, response.MaxPage, nil
+		},
+	)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	return &FindAppointmentsResponse{
+		Appointments: appointments,
+		Count:        strconv.Itoa(len(appointments)),
+		AtPage:       atPage,
+		MaxPage:      maxPage,
+		Response:     1,
+	}, nil
+}
@@ -1,3 +1,173 @@
 package clients
 
-const BaseURL = "http://api-developer.sayan.denttime.kz/"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"io"
+	"macdent-ai-chatbot/internal/configs"
+	"macdent-ai-chatbot/internal/utils"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// retryBaseDelay задает задержку перед первым повтором, далее она удваивается
+const retryBaseDelay = 300 * time.Millisecond
+
+// Client выполняет запросы к Denttime API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	logger     *log.Logger
+}
+
+// apiStatus содержит поле статуса, общее для всех ответов Denttime API
+type apiStatus struct {
+	Response int `json:"response"`
+}
+
+func NewClient(config *configs.DenttimeConfig) *Client {
+	timeout := time.Duration(config.Timeout) * time.Second
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(config.BaseURL, "/") + "/",
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		maxRetries: config.MaxRetries,
+		logger:     utils.NewLogger("clients"),
+	}
+}
+
+// get выполняет идемпотентный GET запрос с повторами при сетевых ошибках и ошибках сервера
+func (c *Client) get(ctx context.Context, path string, params url.Values, response any) *utils.UserErrorResponse {
+	var errorResponse *utils.UserErrorResponse
+	var retry bool
+
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retryBaseDelay << (attempt - 1)
+			c.logger.Warnf("повтор запроса %s через %v (попытка %d из %d)", path, delay, attempt, c.maxRetries)
+
+			select {
+			case <-ctx.Done():
+				return errorResponse
+			case <-time.After(delay):
+			}
+		}
+
+		retry, errorResponse = c.do(ctx, http.MethodGet, path, params, response)
+		if !retry {
+			return errorResponse
+		}
+	}
+
+	return errorResponse
+}
+
+// post выполняет запрос, изменяющий данные, поэтому он не повторяется
+func (c *Client) post(ctx context.Context, path string, params url.Values, response any) *utils.UserErrorResponse {
+	_, errorResponse := c.do(ctx, http.MethodPost, path, params, response)
+	return errorResponse
+}
+
+// do выполняет запрос и декодирует ответ. Первое значение сообщает, имеет ли смысл повторить запрос.
+func (c *Client) do(ctx context.Context, method string, path string, params url.Values, response any) (bool, *utils.UserErrorResponse) {
+	fullURL := fmt.Sprintf("%s%s?%s", c.baseURL, path, params.Encode())
+	c.logger.Infof("запрос к Denttime API: %s %s", method, path)
+
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, nil)
+	if err != nil {
+		c.logger.Errorf("создание запроса: %v", err)
+		return false, utils.NewUserErrorResponse(
+			500,
+			"Ошибка при создании запроса к API",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Errorf("выполнение запроса %s: %v", path, err)
+		return ctx.Err() == nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка при выполнении запроса к API",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+	defer func(Body io.ReadCloser) {
+		if err := Body.Close(); err != nil {
+			c.logger.Errorf("закрытие тела ответа: %v", err)
+		}
+	}(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Errorf("чтение ответа: %v", err)
+		return true, utils.NewUserErrorResponse(
+			500,
+			"Ошибка при чтении ответа от API",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Errorf("получен неверный статус запроса %s: %d", path, resp.StatusCode)
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, utils.NewUserErrorResponse(
+			500,
+			"Ошибка при выполнении запроса к API",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	var status apiStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		c.logger.Errorf("десериализация ответа: %v", err)
+		return false, utils.NewUserErrorResponse(
+			500,
+			"Ошибка при обработке ответа от API",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	if status.Response != 1 {
+		c.logger.Errorf("API вернул неуспешный ответ: %d", status.Response)
+		return false, utils.NewUserErrorResponse(
+			500,
+			"API вернул ошибку",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		c.logger.Errorf("десериализация ответа: %v", err)
+		return false, utils.NewUserErrorResponse(
+			500,
+			"Ошибка при обработке ответа от API",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	return false, nil
+}
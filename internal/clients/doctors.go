@@ -1,17 +1,16 @@
 package clients
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"macdent-ai-chatbot/internal/utils"
-	"net/http"
 	"net/url"
+	"strconv"
 )
 
 type GetDoctorsRequest struct {
 	AccessToken string `json:"access_token"`
 	FullName    string `json:"name"`
+	Page        int    `json:"page"`
 }
 
 type Specialty struct {
@@ -33,86 +32,48 @@ type GetDoctorsResponse struct {
 	Response int      `json:"response"`
 }
 
-func GetDoctors(request *GetDoctorsRequest) (*GetDoctorsResponse, *utils.UserErrorResponse) {
-	logger := utils.NewLogger("clients:getDoctors")
-
-	baseURL := BaseURL + "doctor/find"
-
+func (c *Client) GetDoctors(ctx context.Context, request *GetDoctorsRequest) (*GetDoctorsResponse, *utils.UserErrorResponse) {
 	params := url.Values{}
 	params.Add("access_token", request.AccessToken)
 	if request.FullName != "" {
 		params.Add("name", request.FullName)
 	}
-
-	fullURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-	logger.Infof("получение списка врачей по URL: %s", fullURL)
-
-	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
-	if err != nil {
-		logger.Errorf("создание запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при создании запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("выполнение запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			logger.Fatalf("закрытие тела ответа: %v", err)
-		}
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Errorf("чтение ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при чтении ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		logger.Errorf("получен неверный статус запроса: %d", resp.StatusCode)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if request.Page > 0 {
+		params.Add("page", strconv.Itoa(request.Page))
 	}
 
 	var response GetDoctorsResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		logger.Errorf("десериализация ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при обработке ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if errorResponse := c.get(ctx, "doctor/find", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	if response.Response != 1 {
-		logger.Errorf("API вернул неуспешный ответ: %d", response.Response)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"API вернул ошибку",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	return &response, nil
+}
+
+// GetAllDoctors загружает врачей со всех страниц, но не более maxPages страниц
+func (c *Client) GetAllDoctors(ctx context.Context, request *GetDoctorsRequest, maxPages int) (*GetDoctorsResponse, *utils.UserErrorResponse) {
+	doctors, atPage, maxPage, errorResponse := fetchPages(ctx, maxPages,
+		func(ctx context.Context, page int) ([]Doctor, int, *utils.UserErrorResponse) {
+			pageRequest := *request
+			pageRequest.Page = page
+
+			response, errorResponse := c.GetDoctors(ctx, &pageRequest)
+			if errorResponse != nil {
+				return nil, 0, errorResponse
+			}
+
+			return response.Doctors, response.MaxPage, nil
+		},
+	)
+	if errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	return &response, nil
+	return &GetDoctorsResponse{
+		Doctors:  doctors,
+		Count:    strconv.Itoa(len(doctors)),
+		AtPage:   atPage,
+		MaxPage:  maxPage,
+		Response: 1,
+	}, nil
 }
@@ -0,0 +1,37 @@
+package clients
+
+import (
+	"context"
+	"macdent-ai-chatbot/internal/utils"
+)
+
+// DefaultMaxPages ограничивает количество страниц, загружаемых за один вызов
+const DefaultMaxPages = 10
+
+// fetchPages последовательно загружает страницы, начиная с первой, пока они не закончатся
+// или не будет достигнут лимит maxPages. Возвращает номер последней загруженной страницы и общее число страниц.
+func fetchPages[T any](
+	ctx context.Context,
+	maxPages int,
+	fetch func(ctx context.Context, page int) ([]T, int, *utils.UserErrorResponse),
+) ([]T, int, int, *utils.UserErrorResponse) {
+	var items []T
+	page := 1
+	lastPage := 1
+
+	for ; page <= maxPages; page++ {
+		pageItems, maxPage, errorResponse := fetch(ctx, page)
+		if errorResponse != nil {
+			return nil, 0, 0, errorResponse
+		}
+
+		items = append(items, pageItems...)
+		lastPage = maxPage
+
+		if page >= maxPage || len(pageItems) == 0 {
+			return items, page, lastPage, nil
+		}
+	}
+
+	return items, page - 1, lastPage, nil
+}
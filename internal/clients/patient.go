@@ -1,20 +1,24 @@
 package clients
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"macdent-ai-chatbot/internal/utils"
-	"net/http"
+	"net/url"
 )
 
 type CreatePatientRequest struct {
 	AccessToken string `json:"access_token"`
 	Name        string `json:"name"`
+	Phone       string `json:"phone"`
+	Birth       string `json:"birth"`
+	Comment     string `json:"comment"`
 }
 
 type PatientInfo struct {
 	Name    string `json:"name"`
 	ID      int    `json:"id"`
+	Phone   string `json:"phone"`
+	Birth   string `json:"birth"`
 	Comment string `json:"comment"`
 }
 
@@ -23,80 +27,53 @@ type CreatePatientResponse struct {
 	Response int         `json:"response"`
 }
 
-func CreatePatient(request CreatePatientRequest) (*CreatePatientResponse, *utils.UserErrorResponse) {
-	logger := utils.NewLogger("clients:createPatient")
-
-	baseURL := BaseURL + "patient/add"
-	logger.Infof("создание пациента через URL: %s", baseURL)
+type FindPatientsRequest struct {
+	AccessToken string `json:"access_token"`
+	Phone       string `json:"phone"`
+	Name        string `json:"name"`
+}
 
-	reqURL := baseURL + "?access_token=" + request.AccessToken + "&name=" + request.Name
+type FindPatientsResponse struct {
+	Patients []PatientInfo `json:"patients"`
+	Response int           `json:"response"`
+}
 
-	// Создаем запрос без тела
-	req, err := http.NewRequest(http.MethodPost, reqURL, nil)
-	if err != nil {
-		logger.Errorf("создание запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при создании запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+func (c *Client) CreatePatient(ctx context.Context, request CreatePatientRequest) (*CreatePatientResponse, *utils.UserErrorResponse) {
+	params := url.Values{}
+	params.Add("access_token", request.AccessToken)
+	params.Add("name", request.Name)
+	if request.Phone != "" {
+		params.Add("phone", request.Phone)
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("выполнение запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if request.Birth != "" {
+		params.Add("birth", request.Birth)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			logger.Fatalf("закрытие тела ответа: %v", err)
-		}
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Errorf("чтение ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при чтении ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if request.Comment != "" {
+		params.Add("comment", request.Comment)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Errorf("получен неверный статус запроса: %d", resp.StatusCode)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	var response CreatePatientResponse
+	if errorResponse := c.post(ctx, "patient/add", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	var response CreatePatientResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		logger.Errorf("десериализация ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при обработке ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	return &response, nil
+}
+
+// FindPatients ищет пациентов клиники по номеру телефона и/или имени
+func (c *Client) FindPatients(ctx context.Context, request *FindPatientsRequest) (*FindPatientsResponse, *utils.UserErrorResponse) {
+	params := url.Values{}
+	params.Add("access_token", request.AccessToken)
+	if request.Phone != "" {
+		params.Add("phone", request.Phone)
+	}
+	if request.Name != "" {
+		params.Add("name", request.Name)
 	}
 
-	if response.Response != 1 {
-		logger.Errorf("API вернул неуспешный ответ: %d", response.Response)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"API вернул ошибку",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	var response FindPatientsResponse
+	if errorResponse := c.get(ctx, "patient/find", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
 	return &response, nil
@@ -1,16 +1,16 @@
 package clients
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"macdent-ai-chatbot/internal/utils"
-	"net/http"
 	"net/url"
+	"strconv"
 )
 
 type GetScheduleRequest struct {
 	AccessToken string `json:"access_token"`
+	DoctorID    int    `json:"doctor"`
+	Page        int    `json:"page"`
 }
 
 type TimeInterval struct {
@@ -37,83 +37,48 @@ type GetScheduleResponse struct {
 	Response  int        `json:"response"`
 }
 
-func GetSchedule(request *GetScheduleRequest) (*GetScheduleResponse, *utils.UserErrorResponse) {
-	logger := utils.NewLogger("clients:GetSchedule")
-
-	baseURL := BaseURL + "rasp/find"
-
+func (c *Client) GetSchedule(ctx context.Context, request *GetScheduleRequest) (*GetScheduleResponse, *utils.UserErrorResponse) {
 	params := url.Values{}
 	params.Add("access_token", request.AccessToken)
-
-	fullURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-	logger.Infof("получение списка расписания по URL: %s", fullURL)
-
-	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
-	if err != nil {
-		logger.Errorf("создание запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при создании запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("выполнение запроса: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if request.DoctorID > 0 {
+		params.Add("doctor", strconv.Itoa(request.DoctorID))
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			logger.Fatalf("закрытие тела ответа: %v", err)
-		}
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Errorf("чтение ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при чтении ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		logger.Errorf("получен неверный статус запроса: %d", resp.StatusCode)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при выполнении запроса к API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if request.Page > 0 {
+		params.Add("page", strconv.Itoa(request.Page))
 	}
 
 	var response GetScheduleResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		logger.Errorf("десериализация ответа: %v", err)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"Ошибка при обработке ответа от API",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	if errorResponse := c.get(ctx, "rasp/find", params, &response); errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	if response.Response != 1 {
-		logger.Errorf("API вернул неуспешный ответ: %d", response.Response)
-		return nil, utils.NewUserErrorResponse(
-			500,
-			"API вернул ошибку",
-			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
-		)
+	return &response, nil
+}
+
+// GetAllSchedules загружает расписания со всех страниц, но не более maxPages страниц
+func (c *Client) GetAllSchedules(ctx context.Context, request *GetScheduleRequest, maxPages int) (*GetScheduleResponse, *utils.UserErrorResponse) {
+	schedules, atPage, maxPage, errorResponse := fetchPages(ctx, maxPages,
+		func(ctx context.Context, page int) ([]Schedule, int, *utils.UserErrorResponse) {
+			pageRequest := *request
+			pageRequest.Page = page
+
+			response, errorResponse := c.GetSchedule(ctx, &pageRequest)
+			if errorResponse != nil {
+				return nil, 0, errorResponse
+			}
+
+			return response.Schedules, response.MaxPage, nil
+		},
+	)
+	if errorResponse != nil {
+		return nil, errorResponse
 	}
 
-	return &response, nil
+	return &GetScheduleResponse{
+		Schedules: schedules,
+		Count:     strconv.Itoa(len(schedules)),
+		AtPage:    atPage,
+		MaxPage:   maxPage,
+		Response:  1,
+	}, nil
 }
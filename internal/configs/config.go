@@ -4,6 +4,7 @@ type ApiServerConfig struct {
 	Port     int
 	Postgres *PostgresConfig
 	Qdrant   *QdrantConfig
+	Denttime *DenttimeConfig
 }
 
 type PostgresConfig struct {
@@ -20,6 +21,19 @@ type QdrantConfig struct {
 	ApiKey string
 }
 
+// Настройки Denttime по умолчанию для окружений, где переменные еще не заданы
+const (
+	DefaultDenttimeBaseURL    = "http://api-developer.sayan.denttime.kz/"
+	DefaultDenttimeTimeout    = 15
+	DefaultDenttimeMaxRetries = 2
+)
+
+type DenttimeConfig struct {
+	BaseURL    string
+	Timeout    int
+	MaxRetries int
+}
+
 func NewConfig(env *Env) *ApiServerConfig {
 	return &ApiServerConfig{
 		Port: env.MustInt("APP_INTERNAL_PORT"),
@@ -35,5 +49,10 @@ func NewConfig(env *Env) *ApiServerConfig {
 			Port:   env.MustInt("QDRANT_PORT"),
 			ApiKey: env.MustString("QDRANT_API_KEY"),
 		},
+		Denttime: &DenttimeConfig{
+			BaseURL:    env.StringOr("DENTTIME_BASE_URL", DefaultDenttimeBaseURL),
+			Timeout:    env.IntOr("DENTTIME_TIMEOUT", DefaultDenttimeTimeout),
+			MaxRetries: env.IntOr("DENTTIME_MAX_RETRIES", DefaultDenttimeMaxRetries),
+		},
 	}
 }
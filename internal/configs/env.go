@@ -54,6 +54,23 @@ func (e *Env) MustInt(key string) int {
 	return intValue
 }
 
+// StringOr возвращает строковое значение или значение по умолчанию, если переменная не задана
+func (e *Env) StringOr(key string, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// IntOr возвращает числовое значение или значение по умолчанию, если переменная не задана
+func (e *Env) IntOr(key string, fallback int) int {
+	if os.Getenv(key) == "" {
+		return fallback
+	}
+	return e.MustInt(key)
+}
+
 // MustBool возвращает булево значение или завершает работу с ошибкой
 func (e *Env) MustBool(key string) bool {
 	value := os.Getenv(key)
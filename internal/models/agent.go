@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"time"
 )
 
@@ -34,6 +35,39 @@ func (m *AgentMetadata) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, m)
 }
 
+// Стратегии разбиения текста базы знаний на чанки
+const (
+	// ChunkingStrategyFixed режет текст окном фиксированной длины в символах
+	ChunkingStrategyFixed = "fixed"
+	// ChunkingStrategyStructure собирает чанки из абзацев, не разрывая разделы под заголовками
+	ChunkingStrategyStructure = "structure"
+	// ChunkingStrategyTokens режет текст по количеству токенов модели эмбеддингов
+	ChunkingStrategyTokens = "tokens"
+	// ChunkingStrategyRows выделяет каждую строку таблицы в отдельный чанк
+	ChunkingStrategyRows = "rows"
+)
+
+// Поставщики эмбеддингов базы знаний
+const (
+	// EmbeddingProviderOpenAI использует OpenAI API с API ключом агента
+	EmbeddingProviderOpenAI = "openai"
+	// EmbeddingProviderHTTP использует OpenAI-совместимый сервер, например Ollama или text-embeddings-inference
+	EmbeddingProviderHTTP = "http"
+	// EmbeddingProviderHash строит детерминированные векторы без внешних сервисов, для тестов и офлайн работы
+	EmbeddingProviderHash = "hash"
+)
+
+// Способы переранжирования найденных чанков базы знаний
+const (
+	// RerankProviderLLM оценивает релевантность чанков моделью агента
+	RerankProviderLLM = "llm"
+	// RerankProviderHTTP использует cross-encoder на сервере с эндпоинтом /rerank, например text-embeddings-inference
+	RerankProviderHTTP = "http"
+)
+
+// DefaultEmbeddingModel используется, если у агента не указана модель эмбеддингов
+const DefaultEmbeddingModel = "text-embedding-3-large"
+
 type Agent struct {
 	// Уникальный идентификатор агента
 	ID uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -46,12 +80,44 @@ type Agent struct {
 	ContextSize         int           `json:"context_size" gorm:"not null;default:4096"`
 	Temperature         float64       `json:"temperature" gorm:"default:0.5"`
 	MaxCompletionTokens int           `json:"max_completion_tokens" gorm:"default:1000"`
+	MaxToolRounds       int           `json:"max_tool_rounds" gorm:"not null;default:5"`
 	Metadata            AgentMetadata `json:"metadata" gorm:"type:jsonb"`
 
+	// Настройки поиска по базе знаний
+	KnowledgeTopK           int     `json:"knowledge_top_k" gorm:"not null;default:5"`
+	KnowledgeScoreThreshold float64 `json:"knowledge_score_threshold" gorm:"not null;default:0.3"`
+
+	// Веса векторного поиска и поиска по ключевым словам при объединении результатов. Нулевой вес отключает
+	// соответствующий поиск. Коллекции без векторов ключевых слов ищутся только векторным поиском.
+	KnowledgeDenseWeight   float64 `json:"knowledge_dense_weight" gorm:"not null;default:1"`
+	KnowledgeKeywordWeight float64 `json:"knowledge_keyword_weight" gorm:"not null;default:1"`
+
+	// Настройки переранжирования: из RerankCandidates найденных чанков в контекст попадают RerankTopN
+	// самых релевантных с оценкой не ниже RerankScoreThreshold
+	RerankEnabled        bool    `json:"rerank_enabled" gorm:"not null;default:false"`
+	RerankProvider       string  `json:"rerank_provider" gorm:"not null;default:llm"`
+	RerankBaseURL        string  `json:"rerank_base_url"`
+	RerankAPIKey         string  `json:"rerank_api_key"`
+	RerankCandidates     int     `json:"rerank_candidates" gorm:"not null;default:20"`
+	RerankTopN           int     `json:"rerank_top_n" gorm:"not null;default:5"`
+	RerankScoreThreshold float64 `json:"rerank_score_threshold" gorm:"not null;default:0"`
+
+	// Настройки модели эмбеддингов. Размерность 0 означает размерность модели по умолчанию.
+	EmbeddingProvider   string `json:"embedding_provider" gorm:"not null;default:openai"`
+	EmbeddingModel      string `json:"embedding_model" gorm:"not null;default:text-embedding-3-large"`
+	EmbeddingBaseURL    string `json:"embedding_base_url"`
+	EmbeddingAPIKey     string `json:"embedding_api_key"`
+	EmbeddingDimensions int    `json:"embedding_dimensions" gorm:"not null;default:0"`
+
+	// Настройки разбиения базы знаний на чанки. Нулевые размеры означают значения по умолчанию для стратегии.
+	ChunkingStrategy string `json:"chunking_strategy" gorm:"not null;default:fixed"`
+	ChunkSize        int    `json:"chunk_size" gorm:"not null;default:0"`
+	ChunkOverlap     int    `json:"chunk_overlap" gorm:"not null;default:0"`
+
 	// Метаданные
-	CreatedAt time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
-	UpdatedAt time.Time  `json:"updated_at" gorm:"not null;autoUpdateTime"`
-	DeletedAt *time.Time `json:"deleted_at" gorm:"index"`
+	CreatedAt time.Time      `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"not null;autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 
 	// Связи с другими таблицами
 	Permission       Permission        `json:"permission" gorm:"foreignKey:AgentID;references:ID;constraint:OnDelete:CASCADE"`
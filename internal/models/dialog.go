@@ -5,6 +5,13 @@ import (
 	"time"
 )
 
+// Роли реплик диалога, совпадают с ролями сообщений OpenAI
+const (
+	DialogRoleUser      = "user"
+	DialogRoleAssistant = "assistant"
+	DialogRoleTool      = "tool"
+)
+
 // Dialog представляет запись диалога между пользователем и агентом
 type Dialog struct {
 	// Уникальный идентификатор диалога
@@ -19,6 +26,13 @@ type Dialog struct {
 	Response string `json:"response" gorm:"type:text"`
 	Role     string `json:"role" gorm:"not null;index"`
 
+	// Вызовы инструментов: JSON вызовов у ответа агента и ID вызова у результата инструмента
+	ToolCalls  string `json:"tool_calls,omitempty" gorm:"type:text"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+
+	// ID чанков базы знаний, найденных для сообщения пользователя
+	KnowledgeChunkIDs string `json:"knowledge_chunk_ids,omitempty" gorm:"type:text"`
+
 	// Метаданные
 	CreatedAt time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
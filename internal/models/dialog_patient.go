@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// DialogPatient связывает пользователя чата с пациентом в базе клиники
+type DialogPatient struct {
+	// Связи
+	AgentID uuid.UUID `json:"agent_id" gorm:"type:uuid;primaryKey"`
+	UserID  string    `json:"user_id" gorm:"primaryKey"`
+
+	// ID пациента в MacDent
+	PatientID int `json:"patient_id" gorm:"not null"`
+
+	// Метаданные
+	CreatedAt time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// EmbeddingCache хранит созданный эмбеддинг текста, чтобы повторная загрузка того же текста
+// не требовала повторного обращения к модели. Вектор хранится как последовательность float32 little-endian.
+type EmbeddingCache struct {
+	// Ключ кеша: поставщик и адрес сервера эмбеддингов, модель, размерность и SHA-256 текста
+	Provider   string `json:"provider" gorm:"primaryKey"`
+	BaseURL    string `json:"base_url" gorm:"primaryKey"`
+	Model      string `json:"model" gorm:"primaryKey"`
+	Dimensions int    `json:"dimensions" gorm:"primaryKey;autoIncrement:false"`
+	TextHash   string `json:"text_hash" gorm:"primaryKey;type:char(64)"`
+
+	// Вектор эмбеддинга
+	Vector []byte `json:"-" gorm:"type:bytea;not null"`
+
+	// Метаданные
+	CreatedAt time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
+}
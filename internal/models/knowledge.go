@@ -21,6 +21,14 @@ type KnowledgePrompt struct {
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
 }
 
+// Статусы обработки файла базы знаний, общие для файлов и задач их индексации
+const (
+	KnowledgeFileStatusQueued     = "queued"
+	KnowledgeFileStatusProcessing = "processing"
+	KnowledgeFileStatusCompleted  = "completed"
+	KnowledgeFileStatusFailed     = "failed"
+)
+
 // KnowledgeFile представляет загруженный и обработанный файл базы знаний
 type KnowledgeFile struct {
 	// Уникальный идентификатор файла
@@ -36,10 +44,18 @@ type KnowledgeFile struct {
 	FileType     string `json:"file_type" gorm:"not null"`
 	FilePath     string `json:"file_path" gorm:"not null"`
 
+	// SHA-256 извлеченного текста, по нему распознается повторная загрузка того же содержимого
+	ContentHash string `json:"content_hash" gorm:"index"`
+
+	// Страница сайта, из которой загружен файл, если он получен из источника
+	SourceID  *uuid.UUID `json:"source_id,omitempty" gorm:"type:uuid;index"`
+	SourceURL string     `json:"source_url,omitempty"`
+
 	// Параметры обработки и статус
 	CollectionName string `json:"collection_name" gorm:"not null;index"`
 	ChunkCount     int    `json:"chunk_count" gorm:"default:0;not null"`
 	Status         string `json:"status" gorm:"default:processing;not null;index"`
+	FailureReason  string `json:"failure_reason,omitempty" gorm:"type:text"`
 
 	// Метаданные
 	CreatedAt   time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Операции фоновой обработки файла базы знаний
+const (
+	KnowledgeJobOperationUpload  = "upload"
+	KnowledgeJobOperationReplace = "replace"
+)
+
+// KnowledgeJob представляет задачу фоновой индексации файла базы знаний.
+// Извлеченный текст хранится в задаче, чтобы прерванная обработка продолжилась после перезапуска.
+type KnowledgeJob struct {
+	// Уникальный идентификатор задачи
+	ID uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+
+	// Связи
+	AgentID uuid.UUID `json:"agent_id" gorm:"type:uuid;not null;index"`
+	FileID  uuid.UUID `json:"file_id" gorm:"type:uuid;not null;index"`
+
+	// Обрабатываемое содержимое
+	Operation string `json:"operation" gorm:"not null"`
+	FileName  string `json:"file_name" gorm:"not null"`
+	FileSize  int64  `json:"file_size" gorm:"not null"`
+	FileType  string `json:"file_type" gorm:"not null"`
+	Content   string `json:"-" gorm:"type:text"`
+
+	// Разбиение на чанки, выбранное при загрузке
+	ChunkingStrategy string `json:"chunking_strategy" gorm:"not null;default:fixed"`
+	ChunkSize        int    `json:"chunk_size" gorm:"not null;default:0"`
+	ChunkOverlap     int    `json:"chunk_overlap" gorm:"not null;default:0"`
+
+	// Состояние и прогресс обработки
+	Status          string `json:"status" gorm:"not null;index;default:queued"`
+	TotalChunks     int    `json:"total_chunks" gorm:"default:0;not null"`
+	ProcessedChunks int    `json:"processed_chunks" gorm:"default:0;not null"`
+	Attempts        int    `json:"attempts" gorm:"default:0;not null"`
+	FailureReason   string `json:"failure_reason,omitempty" gorm:"type:text"`
+
+	// Метаданные
+	CreatedAt  time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"not null;autoUpdateTime"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
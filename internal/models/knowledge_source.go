@@ -0,0 +1,49 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Типы источников базы знаний
+const (
+	// KnowledgeSourceTypePage загружает одну страницу сайта
+	KnowledgeSourceTypePage = "page"
+	// KnowledgeSourceTypeSitemap загружает все страницы из sitemap.xml
+	KnowledgeSourceTypeSitemap = "sitemap"
+)
+
+// KnowledgeSource представляет сайт клиники, страницы которого загружаются в базу знаний.
+// Каждая страница хранится отдельным файлом базы знаний и периодически обновляется.
+type KnowledgeSource struct {
+	// Уникальный идентификатор источника
+	ID uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+
+	// Связь с агентом
+	AgentID uuid.UUID `json:"agent_id" gorm:"type:uuid;not null;index"`
+
+	// Адрес страницы или sitemap
+	URL      string `json:"url" gorm:"not null"`
+	Type     string `json:"type" gorm:"not null;default:page"`
+	MaxPages int    `json:"max_pages" gorm:"not null;default:100"`
+
+	// Периодичность обновления в часах
+	RefreshIntervalHours int `json:"refresh_interval_hours" gorm:"not null;default:24"`
+
+	// Разбиение страниц на чанки
+	ChunkingStrategy string `json:"chunking_strategy" gorm:"not null;default:fixed"`
+	ChunkSize        int    `json:"chunk_size" gorm:"not null;default:0"`
+	ChunkOverlap     int    `json:"chunk_overlap" gorm:"not null;default:0"`
+
+	// Состояние последнего обновления
+	Status        string `json:"status" gorm:"not null;index;default:queued"`
+	PageCount     int    `json:"page_count" gorm:"not null;default:0"`
+	FailedPages   int    `json:"failed_pages" gorm:"not null;default:0"`
+	FailureReason string `json:"failure_reason,omitempty" gorm:"type:text"`
+
+	// Метаданные
+	CreatedAt     time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt     time.Time  `json:"updated_at" gorm:"not null;autoUpdateTime"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+	NextFetchAt   time.Time  `json:"next_fetch_at" gorm:"not null;index"`
+}
@@ -5,11 +5,25 @@ import (
 )
 
 func InitMigration(db *gorm.DB) error {
+	// В старом кеше эмбеддингов не записан поставщик, поэтому его записи нельзя отличить
+	// от эмбеддингов другого сервера. Кеш восстанавливается сам, таблица создается заново.
+	migrator := db.Migrator()
+	if migrator.HasTable(&EmbeddingCache{}) && !migrator.HasColumn(&EmbeddingCache{}, "Provider") {
+		if err := migrator.DropTable(&EmbeddingCache{}); err != nil {
+			return err
+		}
+	}
+
 	return db.AutoMigrate(
 		&Agent{},
 		&Permission{},
 		&KnowledgePrompt{},
 		&KnowledgeFile{},
+		&KnowledgeJob{},
+		&KnowledgeSource{},
+		&EmbeddingCache{},
 		&Dialog{},
+		&DialogPatient{},
+		&PendingAction{},
 	)
 }
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Статусы действия, ожидающего подтверждения пользователем
+const (
+	PendingActionStatusPending   = "pending"
+	PendingActionStatusConfirmed = "confirmed"
+	PendingActionStatusRejected  = "rejected"
+	PendingActionStatusExpired   = "expired"
+)
+
+// PendingAction представляет вызов инструмента, изменяющего данные клиники,
+// который выполняется только после подтверждения пользователем
+type PendingAction struct {
+	// Уникальный идентификатор действия
+	ID uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+
+	// Связи
+	AgentID uuid.UUID `json:"agent_id" gorm:"type:uuid;not null;index"`
+	UserID  string    `json:"user_id" gorm:"not null;index"`
+
+	// Отложенный вызов инструмента
+	ToolName  string `json:"tool_name" gorm:"not null"`
+	Arguments string `json:"arguments" gorm:"type:text;not null"`
+
+	// Порядок вызова в ответе модели: действия одного ответа сохраняются с одинаковым created_at
+	Position int `json:"position" gorm:"not null;default:0"`
+
+	// Состояние и результат выполнения
+	Status    string    `json:"status" gorm:"not null;index;default:pending"`
+	Result    string    `json:"result,omitempty" gorm:"type:text"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+
+	// Метаданные
+	CreatedAt time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
+}
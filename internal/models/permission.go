@@ -16,6 +16,9 @@ type Permission struct {
 	Appointment bool `json:"appointment" gorm:"default:false;not null"`
 	Schedule    bool `json:"schedule" gorm:"default:false;not null"`
 
+	// Просмотр, перенос и отмена существующих записей пациента
+	ManageAppointments bool `json:"manage_appointments" gorm:"default:false;not null"`
+
 	// Метаданные
 	CreatedAt time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
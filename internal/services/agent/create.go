@@ -20,15 +20,36 @@ type CreateAgentRequest struct {
 	Temperature         float64            `json:"temperature"`
 	TopP                float64            `json:"top_p"`
 	MaxCompletionTokens int                `json:"max_completion_tokens"`
+	MaxToolRounds       *int               `json:"max_tool_rounds" validate:"omitempty,gte=1,lte=20"`
+	KnowledgeTopK       *int               `json:"knowledge_top_k" validate:"omitempty,gte=0,lte=50"`
+	KnowledgeThreshold  *float64           `json:"knowledge_score_threshold" validate:"omitempty,gte=0,lte=1"`
+	DenseWeight         *float64           `json:"knowledge_dense_weight" validate:"omitempty,gte=0,lte=10"`
+	KeywordWeight       *float64           `json:"knowledge_keyword_weight" validate:"omitempty,gte=0,lte=10"`
+	RerankEnabled       bool               `json:"rerank_enabled"`
+	RerankProvider      string             `json:"rerank_provider" validate:"omitempty,oneof=llm http"`
+	RerankBaseURL       string             `json:"rerank_base_url" validate:"required_if=RerankProvider http,omitempty,url"`
+	RerankAPIKey        string             `json:"rerank_api_key"`
+	RerankCandidates    *int               `json:"rerank_candidates" validate:"omitempty,gte=0,lte=100"`
+	RerankTopN          *int               `json:"rerank_top_n" validate:"omitempty,gte=0,lte=50"`
+	RerankThreshold     *float64           `json:"rerank_score_threshold" validate:"omitempty,gte=0,lte=1"`
+	ChunkingStrategy    string             `json:"chunking_strategy" validate:"omitempty,oneof=fixed structure tokens rows"`
+	EmbeddingProvider   string             `json:"embedding_provider" validate:"omitempty,oneof=openai http hash"`
+	EmbeddingModel      string             `json:"embedding_model"`
+	EmbeddingBaseURL    string             `json:"embedding_base_url" validate:"required_if=EmbeddingProvider http,omitempty,url"`
+	EmbeddingAPIKey     string             `json:"embedding_api_key"`
+	EmbeddingDimensions int                `json:"embedding_dimensions" validate:"gte=0,lte=8192"`
+	ChunkSize           int                `json:"chunk_size" validate:"gte=0,lte=8000"`
+	ChunkOverlap        int                `json:"chunk_overlap" validate:"gte=0,lte=2000"`
 	Metadata            MetadataRequest    `json:"metadata"`
 	Permissions         PermissionsRequest `json:"permissions"`
 }
 
 type PermissionsRequest struct {
-	Stomatology bool `json:"stomatology"`
-	Doctors     bool `json:"doctors"`
-	Appointment bool `json:"appointment"`
-	Schedule    bool `json:"schedule"`
+	Stomatology        bool `json:"stomatology"`
+	Doctors            bool `json:"doctors"`
+	Appointment        bool `json:"appointment"`
+	Schedule           bool `json:"schedule"`
+	ManageAppointments bool `json:"manage_appointments"`
 }
 
 func (s *Service) CreateAgent(request *CreateAgentRequest, postgres *databases.PostgresDatabase) (*models.Agent, *utils.UserErrorResponse) {
@@ -40,6 +61,37 @@ func (s *Service) CreateAgent(request *CreateAgentRequest, postgres *databases.P
 		ContextSize:         request.ContextSize,
 		Temperature:         request.Temperature,
 		MaxCompletionTokens: request.MaxCompletionTokens,
+		RerankEnabled:       request.RerankEnabled,
+		RerankProvider:      request.RerankProvider,
+		RerankBaseURL:       request.RerankBaseURL,
+		RerankAPIKey:        request.RerankAPIKey,
+		EmbeddingProvider:   request.EmbeddingProvider,
+		EmbeddingModel:      request.EmbeddingModel,
+		EmbeddingBaseURL:    request.EmbeddingBaseURL,
+		EmbeddingAPIKey:     request.EmbeddingAPIKey,
+		EmbeddingDimensions: request.EmbeddingDimensions,
+		ChunkingStrategy:    request.ChunkingStrategy,
+		ChunkSize:           request.ChunkSize,
+		ChunkOverlap:        request.ChunkOverlap,
+	}
+
+	if request.DenseWeight != nil && request.KeywordWeight != nil && *request.DenseWeight == 0 && *request.KeywordWeight == 0 {
+		return nil, searchDisabledError()
+	}
+
+	zeroSettings := applySearchSettings(agent, request)
+
+	if agent.EmbeddingProvider == "" {
+		agent.EmbeddingProvider = models.EmbeddingProviderOpenAI
+	}
+	if agent.EmbeddingModel == "" {
+		agent.EmbeddingModel = models.DefaultEmbeddingModel
+	}
+	if agent.RerankProvider == "" {
+		agent.RerankProvider = models.RerankProviderLLM
+	}
+	if agent.ChunkingStrategy == "" {
+		agent.ChunkingStrategy = models.ChunkingStrategyFixed
 	}
 
 	agent.Metadata.Stomatology = request.Metadata.Stomatology
@@ -64,12 +116,29 @@ func (s *Service) CreateAgent(request *CreateAgentRequest, postgres *databases.P
 		)
 	}
 
+	if len(zeroSettings) > 0 {
+		if err := tx.Model(agent).Updates(zeroSettings).Error; err != nil {
+			tx.Rollback()
+
+			s.logger.Errorf("сохранение настроек поиска: %v", err)
+			return nil, utils.NewUserErrorResponse(
+				500,
+				"Ошибка создания агента",
+				"Пожалуйста, повторите попытку позже",
+			)
+		}
+
+		// После создания в агенте оказались значения по умолчанию из базы
+		applySearchSettings(agent, request)
+	}
+
 	permission := &models.Permission{
-		AgentID:     agent.ID,
-		Stomatology: request.Permissions.Stomatology,
-		Doctors:     request.Permissions.Doctors,
-		Appointment: request.Permissions.Appointment,
-		Schedule:    request.Permissions.Schedule,
+		AgentID:            agent.ID,
+		Stomatology:        request.Permissions.Stomatology,
+		Doctors:            request.Permissions.Doctors,
+		Appointment:        request.Permissions.Appointment,
+		Schedule:           request.Permissions.Schedule,
+		ManageAppointments: request.Permissions.ManageAppointments,
 	}
 
 	if err := tx.Create(permission).Error; err != nil {
@@ -107,3 +176,43 @@ func (s *Service) CreateAgent(request *CreateAgentRequest, postgres *databases.P
 
 	return agent, nil
 }
+
+// searchDisabledError возвращается, если нулевые веса отключают оба способа поиска по базе знаний
+func searchDisabledError() *utils.UserErrorResponse {
+	return utils.NewUserErrorResponse(
+		400,
+		"Неправильные данные запроса",
+		"knowledge_dense_weight и knowledge_keyword_weight не могут быть равны 0 одновременно. Чтобы отключить базу знаний, укажите knowledge_top_k = 0.",
+	)
+}
+
+// applySearchSettings переносит в агента явно указанные настройки поиска и возвращает колонки
+// с нулевыми значениями. GORM не записывает нулевые значения полей со значением по умолчанию,
+// поэтому явные нули сохраняются отдельно после создания агента.
+func applySearchSettings(agent *models.Agent, request *CreateAgentRequest) map[string]interface{} {
+	zeros := map[string]interface{}{}
+
+	setExplicit(&agent.MaxToolRounds, request.MaxToolRounds, "max_tool_rounds", zeros)
+	setExplicit(&agent.KnowledgeTopK, request.KnowledgeTopK, "knowledge_top_k", zeros)
+	setExplicit(&agent.KnowledgeScoreThreshold, request.KnowledgeThreshold, "knowledge_score_threshold", zeros)
+	setExplicit(&agent.KnowledgeDenseWeight, request.DenseWeight, "knowledge_dense_weight", zeros)
+	setExplicit(&agent.KnowledgeKeywordWeight, request.KeywordWeight, "knowledge_keyword_weight", zeros)
+	setExplicit(&agent.RerankCandidates, request.RerankCandidates, "rerank_candidates", zeros)
+	setExplicit(&agent.RerankTopN, request.RerankTopN, "rerank_top_n", zeros)
+	setExplicit(&agent.RerankScoreThreshold, request.RerankThreshold, "rerank_score_threshold", zeros)
+
+	return zeros
+}
+
+// setExplicit записывает указанное значение в поле и запоминает колонку, если значение нулевое.
+// Неуказанное значение оставляет поле пустым, и действует значение по умолчанию из модели.
+func setExplicit[T int | float64](field *T, value *T, column string, zeros map[string]interface{}) {
+	if value == nil {
+		return
+	}
+
+	*field = *value
+	if *value == 0 {
+		zeros[column] = *value
+	}
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"macdent-ai-chatbot/internal/models"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestApplySearchSettings(t *testing.T) {
+	intValue := func(value int) *int { return &value }
+	floatValue := func(value float64) *float64 { return &value }
+
+	request := &CreateAgentRequest{
+		MaxToolRounds:      intValue(3),
+		KnowledgeTopK:      intValue(0),
+		KnowledgeThreshold: floatValue(0),
+		DenseWeight:        floatValue(2),
+		KeywordWeight:      floatValue(0),
+		RerankCandidates:   intValue(0),
+		RerankTopN:         intValue(0),
+		RerankThreshold:    floatValue(0.4),
+	}
+
+	agent := &models.Agent{}
+	zeros := applySearchSettings(agent, request)
+
+	wantZeros := []string{
+		"knowledge_keyword_weight", "knowledge_score_threshold", "knowledge_top_k", "rerank_candidates", "rerank_top_n",
+	}
+	if got := slices.Sorted(maps.Keys(zeros)); !slices.Equal(got, wantZeros) {
+		t.Errorf("нулевые колонки %v, ожидались %v", got, wantZeros)
+	}
+
+	if agent.MaxToolRounds != 3 || agent.KnowledgeDenseWeight != 2 || agent.RerankScoreThreshold != 0.4 {
+		t.Errorf("ненулевые значения не перенесены в агента: %+v", agent)
+	}
+
+	// Значения по умолчанию, подставленные базой при создании, заменяются явно указанными
+	agent.KnowledgeTopK, agent.KnowledgeScoreThreshold, agent.RerankTopN = 5, 0.3, 5
+	applySearchSettings(agent, request)
+	if agent.KnowledgeTopK != 0 || agent.KnowledgeScoreThreshold != 0 || agent.RerankTopN != 0 {
+		t.Errorf("явные нули не восстановлены: %+v", agent)
+	}
+}
+
+func TestApplySearchSettingsDefaults(t *testing.T) {
+	agent := &models.Agent{}
+
+	if zeros := applySearchSettings(agent, &CreateAgentRequest{}); len(zeros) != 0 {
+		t.Errorf("нулевые колонки %v для запроса без настроек, должны действовать значения по умолчанию", zeros)
+	}
+}
@@ -1,13 +1,150 @@
 package agent
 
 import (
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// Повторы удаления коллекции Qdrant: задержка перед первым повтором удваивается после каждой попытки
+const (
+	dropCollectionAttempts  = 4
+	dropCollectionBaseDelay = time.Second
 )
 
 type DeleteAgentRequest struct {
-	AgentID string `json:"agent_id" validate:"required"`
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+}
+
+// DeleteAgent мягко удаляет агента и в одной транзакции удаляет все связанные с ним данные
+// и отменяет незавершенные задачи индексации.
+// Коллекция Qdrant удаляется после фиксации транзакции с повторами, а если это не удалось,
+// она будет удалена при следующем запуске в CleanupDeletedAgents.
+func (s *Service) DeleteAgent(
+	request *DeleteAgentRequest,
+	postgres *databases.PostgresDatabase,
+	qdrant *databases.QdrantDatabase,
+) *utils.UserErrorResponse {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	currentAgent, errorResponse := s.GetAgent(agentUUID, postgres)
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	err := postgres.DB.Transaction(func(tx *gorm.DB) error {
+		// Задачи индексации не удаляются, а отменяются: воркер, который уже обрабатывает задачу,
+		// увидит отмену и не создаст коллекцию удаленного агента заново
+		err := tx.Model(&models.KnowledgeJob{}).
+			Where("agent_id = ? AND status IN ?", agentUUID, []string{models.KnowledgeFileStatusQueued, models.KnowledgeFileStatusProcessing}).
+			Updates(map[string]interface{}{
+				"status":         models.KnowledgeFileStatusFailed,
+				"failure_reason": "Агент удален",
+				"finished_at":    time.Now(),
+				"content":        "",
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		related := []interface{}{
+			&models.Permission{},
+			&models.KnowledgePrompt{},
+			&models.KnowledgeFile{},
+			&models.KnowledgeSource{},
+			&models.Dialog{},
+			&models.DialogPatient{},
+			&models.PendingAction{},
+		}
+
+		for _, model := range related {
+			if err := tx.Where("agent_id = ?", agentUUID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(currentAgent).Error
+	})
+
+	if err != nil {
+		s.logger.Errorf("удаление агента %s: %v", agentUUID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления агента",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	s.logger.Infof("агент %s удален", agentUUID)
+
+	go s.dropCollection(agentUUID, qdrant)
+
+	return nil
 }
 
-func (s *Service) DeleteAgent(request *DeleteAgentRequest, postgres *databases.PostgresDatabase) {
+// CleanupDeletedAgents удаляет коллекции Qdrant, оставшиеся от удаленных агентов,
+// если при удалении Qdrant был недоступен
+func (s *Service) CleanupDeletedAgents(postgres *databases.PostgresDatabase, qdrant *databases.QdrantDatabase) {
+	var agentIDs []uuid.UUID
+
+	err := postgres.DB.
+		Unscoped().
+		Model(&models.Agent{}).
+		Where("deleted_at IS NOT NULL").
+		Pluck("id", &agentIDs).Error
+
+	if err != nil {
+		s.logger.Errorf("получение удаленных агентов: %v", err)
+		return
+	}
+
+	for _, agentID := range agentIDs {
+		s.dropCollection(agentID, qdrant)
+	}
+}
+
+func (s *Service) dropCollection(agentID uuid.UUID, qdrant *databases.QdrantDatabase) {
+	collectionName := agentID.String()
+	delay := dropCollectionBaseDelay
+
+	for attempt := 1; attempt <= dropCollectionAttempts; attempt++ {
+		if s.tryDropCollection(collectionName, qdrant) {
+			return
+		}
+
+		if attempt < dropCollectionAttempts {
+			s.logger.Warnf("повтор удаления коллекции %s через %v (попытка %d из %d)", collectionName, delay, attempt, dropCollectionAttempts)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	s.logger.Errorf("не удалось удалить коллекцию %s, она будет удалена при следующем запуске", collectionName)
+}
+
+func (s *Service) tryDropCollection(collectionName string, qdrant *databases.QdrantDatabase) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exists, err := qdrant.Client.CollectionExists(ctx, collectionName)
+	if err != nil {
+		s.logger.Errorf("проверка существования коллекции %s: %v", collectionName, err)
+		return false
+	}
+
+	if !exists {
+		return true
+	}
+
+	if err := qdrant.Client.DeleteCollection(ctx, collectionName); err != nil {
+		s.logger.Errorf("удаление коллекции %s: %v", collectionName, err)
+		return false
+	}
 
+	s.logger.Infof("удалена коллекция %s в Qdrant", collectionName)
+	return true
 }
@@ -1,11 +1,13 @@
 package agent
 
 import (
+	"context"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"macdent-ai-chatbot/internal/databases"
 	"macdent-ai-chatbot/internal/models"
 	"macdent-ai-chatbot/internal/utils"
+	"time"
 )
 
 type UpdateAgentRequest struct {
@@ -18,11 +20,37 @@ type UpdateAgentRequest struct {
 	Temperature         *float64           `json:"temperature"`
 	TopP                *float64           `json:"top_p"`
 	MaxCompletionTokens *int               `json:"max_completion_tokens"`
+	MaxToolRounds       *int               `json:"max_tool_rounds" validate:"omitempty,gte=1,lte=20"`
+	KnowledgeTopK       *int               `json:"knowledge_top_k" validate:"omitempty,gte=0,lte=50"`
+	KnowledgeThreshold  *float64           `json:"knowledge_score_threshold" validate:"omitempty,gte=0,lte=1"`
+	DenseWeight         *float64           `json:"knowledge_dense_weight" validate:"omitempty,gte=0,lte=10"`
+	KeywordWeight       *float64           `json:"knowledge_keyword_weight" validate:"omitempty,gte=0,lte=10"`
+	RerankEnabled       *bool              `json:"rerank_enabled"`
+	RerankProvider      string             `json:"rerank_provider" validate:"omitempty,oneof=llm http"`
+	RerankBaseURL       string             `json:"rerank_base_url" validate:"omitempty,url"`
+	RerankAPIKey        string             `json:"rerank_api_key"`
+	RerankCandidates    *int               `json:"rerank_candidates" validate:"omitempty,gte=1,lte=100"`
+	RerankTopN          *int               `json:"rerank_top_n" validate:"omitempty,gte=1,lte=50"`
+	RerankThreshold     *float64           `json:"rerank_score_threshold" validate:"omitempty,gte=0,lte=1"`
+	ChunkingStrategy    string             `json:"chunking_strategy" validate:"omitempty,oneof=fixed structure tokens rows"`
+	EmbeddingProvider   string             `json:"embedding_provider" validate:"omitempty,oneof=openai http hash"`
+	EmbeddingModel      string             `json:"embedding_model"`
+	EmbeddingBaseURL    string             `json:"embedding_base_url" validate:"omitempty,url"`
+	EmbeddingAPIKey     string             `json:"embedding_api_key"`
+	EmbeddingDimensions *int               `json:"embedding_dimensions" validate:"omitempty,gte=0,lte=8192"`
+	ChunkSize           *int               `json:"chunk_size" validate:"omitempty,gte=0,lte=8000"`
+	ChunkOverlap        *int               `json:"chunk_overlap" validate:"omitempty,gte=0,lte=2000"`
 	Metadata            *MetadataRequest   `json:"metadata"`
 	Permissions         PermissionsRequest `json:"permissions"`
 }
 
-func (s *Service) UpdateAgent(request *UpdateAgentRequest, postgres *databases.PostgresDatabase) (*models.Agent, *utils.UserErrorResponse) {
+// UpdateAgent обновляет настройки агента. Модель эмбеддингов нельзя сменить, пока у агента есть
+// коллекция Qdrant: ее векторы построены прежней моделью, и поиск по ним новой моделью невозможен.
+func (s *Service) UpdateAgent(
+	request *UpdateAgentRequest,
+	postgres *databases.PostgresDatabase,
+	qdrant *databases.QdrantDatabase,
+) (*models.Agent, *utils.UserErrorResponse) {
 	agentID, _ := uuid.Parse(request.AgentID)
 	agent, errorResponse := s.GetAgent(
 		agentID,
@@ -33,6 +61,12 @@ func (s *Service) UpdateAgent(request *UpdateAgentRequest, postgres *databases.P
 		return nil, errorResponse
 	}
 
+	if embeddingChanged(agent, request) {
+		if errorResponse := s.checkNoCollection(agentID, qdrant); errorResponse != nil {
+			return nil, errorResponse
+		}
+	}
+
 	if request.Model != "" {
 		agent.Model = request.Model
 	}
@@ -55,6 +89,70 @@ func (s *Service) UpdateAgent(request *UpdateAgentRequest, postgres *databases.P
 	if request.MaxCompletionTokens != nil {
 		agent.MaxCompletionTokens = *request.MaxCompletionTokens
 	}
+	if request.MaxToolRounds != nil {
+		agent.MaxToolRounds = *request.MaxToolRounds
+	}
+	if request.KnowledgeTopK != nil {
+		agent.KnowledgeTopK = *request.KnowledgeTopK
+	}
+	if request.KnowledgeThreshold != nil {
+		agent.KnowledgeScoreThreshold = *request.KnowledgeThreshold
+	}
+	if request.DenseWeight != nil {
+		agent.KnowledgeDenseWeight = *request.DenseWeight
+	}
+	if request.KeywordWeight != nil {
+		agent.KnowledgeKeywordWeight = *request.KeywordWeight
+	}
+	if request.RerankEnabled != nil {
+		agent.RerankEnabled = *request.RerankEnabled
+	}
+	if request.RerankProvider != "" {
+		agent.RerankProvider = request.RerankProvider
+	}
+	if request.RerankBaseURL != "" {
+		agent.RerankBaseURL = request.RerankBaseURL
+	}
+	if request.RerankAPIKey != "" {
+		agent.RerankAPIKey = request.RerankAPIKey
+	}
+	if request.RerankCandidates != nil {
+		agent.RerankCandidates = *request.RerankCandidates
+	}
+	if request.RerankTopN != nil {
+		agent.RerankTopN = *request.RerankTopN
+	}
+	if request.RerankThreshold != nil {
+		agent.RerankScoreThreshold = *request.RerankThreshold
+	}
+	if request.EmbeddingProvider != "" {
+		agent.EmbeddingProvider = request.EmbeddingProvider
+	}
+	if request.EmbeddingModel != "" {
+		agent.EmbeddingModel = request.EmbeddingModel
+	}
+	if request.EmbeddingBaseURL != "" {
+		agent.EmbeddingBaseURL = request.EmbeddingBaseURL
+	}
+	if request.EmbeddingAPIKey != "" {
+		agent.EmbeddingAPIKey = request.EmbeddingAPIKey
+	}
+	if request.EmbeddingDimensions != nil {
+		agent.EmbeddingDimensions = *request.EmbeddingDimensions
+	}
+	if request.ChunkingStrategy != "" {
+		agent.ChunkingStrategy = request.ChunkingStrategy
+	}
+	if request.ChunkSize != nil {
+		agent.ChunkSize = *request.ChunkSize
+	}
+	if request.ChunkOverlap != nil {
+		agent.ChunkOverlap = *request.ChunkOverlap
+	}
+
+	if agent.KnowledgeDenseWeight == 0 && agent.KnowledgeKeywordWeight == 0 {
+		return nil, searchDisabledError()
+	}
 
 	if request.Metadata != nil {
 		if request.Metadata.Stomatology != 0 {
@@ -68,6 +166,7 @@ func (s *Service) UpdateAgent(request *UpdateAgentRequest, postgres *databases.P
 	agent.Permission.Stomatology = request.Permissions.Stomatology
 	agent.Permission.Doctors = request.Permissions.Doctors
 	agent.Permission.Appointment = request.Permissions.Appointment
+	agent.Permission.ManageAppointments = request.Permissions.ManageAppointments
 
 	tx := postgres.DB.Begin()
 	defer func() {
@@ -101,3 +200,36 @@ func (s *Service) UpdateAgent(request *UpdateAgentRequest, postgres *databases.P
 
 	return agent, nil
 }
+
+// embeddingChanged сообщает, меняет ли запрос поставщика, модель или размерность эмбеддингов
+func embeddingChanged(agent *models.Agent, request *UpdateAgentRequest) bool {
+	return (request.EmbeddingProvider != "" && request.EmbeddingProvider != agent.EmbeddingProvider) ||
+		(request.EmbeddingModel != "" && request.EmbeddingModel != agent.EmbeddingModel) ||
+		(request.EmbeddingDimensions != nil && *request.EmbeddingDimensions != agent.EmbeddingDimensions)
+}
+
+// checkNoCollection возвращает 409, если у агента уже есть коллекция Qdrant
+func (s *Service) checkNoCollection(agentID uuid.UUID, qdrant *databases.QdrantDatabase) *utils.UserErrorResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exists, err := qdrant.Client.CollectionExists(ctx, agentID.String())
+	if err != nil {
+		s.logger.Errorf("проверка существования коллекции %s: %v", agentID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка обновления агента",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	if exists {
+		return utils.NewUserErrorResponse(
+			409,
+			"Нельзя сменить модель эмбеддингов",
+			"База знаний агента построена текущей моделью эмбеддингов. Удалите базу знаний и загрузите ее заново после смены модели.",
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"macdent-ai-chatbot/internal/models"
+	"testing"
+)
+
+func TestEmbeddingChanged(t *testing.T) {
+	current := &models.Agent{
+		EmbeddingProvider:   models.EmbeddingProviderOpenAI,
+		EmbeddingModel:      "text-embedding-3-small",
+		EmbeddingDimensions: 512,
+	}
+	dimensions := func(value int) *int { return &value }
+
+	tests := []struct {
+		name    string
+		request UpdateAgentRequest
+		want    bool
+	}{
+		{name: "эмбеддинги не указаны", request: UpdateAgentRequest{Model: "gpt-4o"}, want: false},
+		{
+			name: "те же настройки",
+			request: UpdateAgentRequest{
+				EmbeddingProvider:   models.EmbeddingProviderOpenAI,
+				EmbeddingModel:      "text-embedding-3-small",
+				EmbeddingDimensions: dimensions(512),
+			},
+			want: false,
+		},
+		{name: "новый ключ API не меняет векторы", request: UpdateAgentRequest{EmbeddingAPIKey: "sk-new"}, want: false},
+		{name: "другой поставщик", request: UpdateAgentRequest{EmbeddingProvider: models.EmbeddingProviderHTTP}, want: true},
+		{name: "другая модель", request: UpdateAgentRequest{EmbeddingModel: "text-embedding-3-large"}, want: true},
+		{name: "другая размерность", request: UpdateAgentRequest{EmbeddingDimensions: dimensions(0)}, want: true},
+	}
+
+	for _, test := range tests {
+		if got := embeddingChanged(current, &test.request); got != test.want {
+			t.Errorf("%s: %v, ожидалось %v", test.name, got, test.want)
+		}
+	}
+}
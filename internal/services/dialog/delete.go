@@ -1 +1,96 @@
 package dialog
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+)
+
+type DeleteDialogRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+	UserID  string `json:"user_id" validate:"required"`
+}
+
+type DeleteDialogsRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+}
+
+// DeleteDialog удаляет всю историю пользователя: реплики, связь с пациентом и ожидающие действия
+func (s *Service) DeleteDialog(request *DeleteDialogRequest, postgres *databases.PostgresDatabase) (int64, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	deleted, total, errorResponse := s.deleteDialogs(func(db *gorm.DB) *gorm.DB {
+		return db.Where("agent_id = ? AND user_id = ?", agentUUID, request.UserID)
+	}, postgres)
+	if errorResponse != nil {
+		return 0, errorResponse
+	}
+
+	// Без реплик у пользователя могут остаться связь с пациентом или ожидающие действия:
+	// их удаление — тоже удаление истории, поэтому 404 возвращается, только если не удалено ничего
+	if total == 0 {
+		return 0, utils.NewUserErrorResponse(
+			404,
+			"Диалог не найден",
+			"У пользователя нет истории диалога с этим агентом",
+		)
+	}
+
+	s.logger.Infof("удалена история пользователя %s агента %s: %d реплик", request.UserID, agentUUID, deleted)
+	return deleted, nil
+}
+
+// DeleteDialogs удаляет все диалоги агента
+func (s *Service) DeleteDialogs(request *DeleteDialogsRequest, postgres *databases.PostgresDatabase) (int64, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	if _, errorResponse := agent.NewService().GetAgent(agentUUID, postgres); errorResponse != nil {
+		return 0, errorResponse
+	}
+
+	deleted, _, errorResponse := s.deleteDialogs(func(db *gorm.DB) *gorm.DB {
+		return db.Where("agent_id = ?", agentUUID)
+	}, postgres)
+	if errorResponse != nil {
+		return 0, errorResponse
+	}
+
+	s.logger.Infof("удалены диалоги агента %s: %d реплик", agentUUID, deleted)
+	return deleted, nil
+}
+
+// deleteDialogs удаляет в одной транзакции все данные диалогов, подходящие под условие.
+// Возвращает количество удаленных реплик и общее количество удаленных записей во всех таблицах.
+func (s *Service) deleteDialogs(filter func(db *gorm.DB) *gorm.DB, postgres *databases.PostgresDatabase) (int64, int64, *utils.UserErrorResponse) {
+	var deleted, total int64
+
+	err := postgres.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Dialog{}, &models.DialogPatient{}, &models.PendingAction{}} {
+			result := tx.Scopes(filter).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if _, ok := model.(*models.Dialog); ok {
+				deleted = result.RowsAffected
+			}
+			total += result.RowsAffected
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Errorf("удаление диалогов: %v", err)
+		return 0, 0, utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления диалогов",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return deleted, total, nil
+}
@@ -1 +1,294 @@
 package dialog
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/openai/openai-go"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// historyMaxTurns ограничивает количество реплик, загружаемых из базы за один запрос
+const historyMaxTurns = 200
+
+// EstimateTokens грубо оценивает количество токенов в тексте.
+// Для кириллицы один токен в среднем занимает 2-3 символа, поэтому оценка завышена намеренно.
+func EstimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 4
+}
+
+// LoadHistory загружает предыдущие реплики пользователя, укладываясь в бюджет токенов.
+// История обрезается целыми обменами (от реплики пользователя до следующей),
+// чтобы результаты инструментов не оказались без вызвавшего их ответа агента.
+func (s *Service) LoadHistory(
+	agentID uuid.UUID,
+	userID string,
+	budget int,
+	postgres *databases.PostgresDatabase,
+) ([]openai.ChatCompletionMessageParamUnion, *utils.UserErrorResponse) {
+	if budget <= 0 {
+		return nil, nil
+	}
+
+	var dialogs []models.Dialog
+
+	err := postgres.DB.
+		Where("agent_id = ? AND user_id = ?", agentID, userID).
+		Order("created_at DESC").
+		Limit(historyMaxTurns).
+		Find(&dialogs).Error
+
+	if err != nil {
+		s.logger.Errorf("получение истории диалога: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения истории диалога",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	var history []openai.ChatCompletionMessageParamUnion
+	var exchange []openai.ChatCompletionMessageParamUnion
+	exchangeTokens := 0
+	usedTokens := 0
+
+	for _, dialog := range dialogs {
+		message, ok := s.dialogToMessage(dialog)
+		if !ok {
+			continue
+		}
+
+		exchange = append([]openai.ChatCompletionMessageParamUnion{message}, exchange...)
+		exchangeTokens += EstimateTokens(dialog.Message) + EstimateTokens(dialog.ToolCalls)
+
+		if dialog.Role != models.DialogRoleUser {
+			continue
+		}
+
+		if usedTokens+exchangeTokens > budget {
+			break
+		}
+
+		history = append(exchange, history...)
+		usedTokens += exchangeTokens
+		exchange = nil
+		exchangeTokens = 0
+	}
+
+	s.logger.Infof("загружено %d сообщений истории (~%d токенов) для пользователя %s", len(history), usedTokens, userID)
+	return history, nil
+}
+
+// SaveHistory сохраняет сообщение пользователя и все новые реплики агента и инструментов
+func (s *Service) SaveHistory(
+	agentID uuid.UUID,
+	userID string,
+	userMessage string,
+	knowledgeChunkIDs []string,
+	messages []openai.ChatCompletionMessageParamUnion,
+	postgres *databases.PostgresDatabase,
+) {
+	dialogs := []models.Dialog{{
+		AgentID:           agentID,
+		UserID:            userID,
+		Message:           userMessage,
+		Role:              models.DialogRoleUser,
+		KnowledgeChunkIDs: strings.Join(knowledgeChunkIDs, ","),
+	}}
+
+	for _, message := range messages {
+		dialog, ok := s.messageToDialog(message)
+		if !ok {
+			continue
+		}
+
+		dialog.AgentID = agentID
+		dialog.UserID = userID
+		dialogs = append(dialogs, dialog)
+	}
+
+	// Сохраняем порядок реплик внутри одного обмена: все записи создаются одной пачкой
+	now := time.Now()
+	for i := range dialogs {
+		dialogs[i].CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+	}
+
+	if err := postgres.DB.Create(&dialogs).Error; err != nil {
+		s.logger.Errorf("сохранение истории диалога: %v", err)
+		return
+	}
+
+	s.logger.Infof("сохранено %d реплик диалога для пользователя %s", len(dialogs), userID)
+}
+
+func (s *Service) dialogToMessage(dialog models.Dialog) (openai.ChatCompletionMessageParamUnion, bool) {
+	switch dialog.Role {
+	case models.DialogRoleUser:
+		return openai.UserMessage(dialog.Message), true
+	case models.DialogRoleAssistant:
+		message := openai.ChatCompletionMessage{
+			Role:    openai.ChatCompletionMessageRoleAssistant,
+			Content: dialog.Message,
+		}
+
+		if dialog.ToolCalls != "" {
+			if err := json.Unmarshal([]byte(dialog.ToolCalls), &message.ToolCalls); err != nil {
+				s.logger.Errorf("разбор вызовов инструментов из истории: %v", err)
+				return nil, false
+			}
+		}
+
+		return message, true
+	case models.DialogRoleTool:
+		return openai.ToolMessage(dialog.ToolCallID, dialog.Message), true
+	}
+
+	s.logger.Warnf("неизвестная роль реплики в истории: %s", dialog.Role)
+	return nil, false
+}
+
+func (s *Service) messageToDialog(message openai.ChatCompletionMessageParamUnion) (models.Dialog, bool) {
+	switch message := message.(type) {
+	case openai.ChatCompletionMessage:
+		dialog := models.Dialog{
+			Message: message.Content,
+			Role:    models.DialogRoleAssistant,
+		}
+
+		if len(message.ToolCalls) > 0 {
+			toolCalls, err := json.Marshal(message.ToolCalls)
+			if err != nil {
+				s.logger.Errorf("сериализация вызовов инструментов: %v", err)
+				return models.Dialog{}, false
+			}
+			dialog.ToolCalls = string(toolCalls)
+		}
+
+		return dialog, true
+	case openai.ChatCompletionToolMessageParam:
+		var content string
+		for _, part := range message.Content.Value {
+			content += part.Text.Value
+		}
+
+		return models.Dialog{
+			Message:    content,
+			Role:       models.DialogRoleTool,
+			ToolCallID: message.ToolCallID.Value,
+		}, true
+	}
+
+	return models.Dialog{}, false
+}
+
+type CreateDialogRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+	UserID  string `json:"user_id"`
+}
+
+type GetDialogRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+	UserID  string `json:"user_id" validate:"required"`
+}
+
+// DialogThread содержит всю историю диалога пользователя с агентом
+type DialogThread struct {
+	AgentID        uuid.UUID               `json:"agent_id"`
+	UserID         string                  `json:"user_id"`
+	PatientID      int                     `json:"patient_id,omitempty"`
+	Turns          []models.Dialog         `json:"turns"`
+	PendingActions []PendingActionResponse `json:"pending_actions,omitempty"`
+}
+
+// CreateDialog начинает новый диалог. Если user_id не указан, он генерируется,
+// чтобы клиент мог вести несколько независимых диалогов с агентом.
+func (s *Service) CreateDialog(request *CreateDialogRequest, postgres *databases.PostgresDatabase) (*DialogThread, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	if _, errorResponse := agent.NewService().GetAgent(agentUUID, postgres); errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	if request.UserID == "" {
+		request.UserID = uuid.NewString()
+	}
+
+	var turns int64
+
+	err := postgres.DB.
+		Model(&models.Dialog{}).
+		Where("agent_id = ? AND user_id = ?", agentUUID, request.UserID).
+		Count(&turns).Error
+
+	if err != nil {
+		s.logger.Errorf("проверка существования диалога: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка создания диалога",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	if turns > 0 {
+		return nil, utils.NewUserErrorResponse(
+			409,
+			"Диалог уже существует",
+			"У пользователя уже есть история диалога с этим агентом",
+		)
+	}
+
+	return &DialogThread{
+		AgentID: agentUUID,
+		UserID:  request.UserID,
+		Turns:   []models.Dialog{},
+	}, nil
+}
+
+// GetDialog возвращает все реплики диалога пользователя в хронологическом порядке
+func (s *Service) GetDialog(request *GetDialogRequest, postgres *databases.PostgresDatabase) (*DialogThread, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	thread := &DialogThread{
+		AgentID: agentUUID,
+		UserID:  request.UserID,
+	}
+
+	err := postgres.DB.
+		Where("agent_id = ? AND user_id = ?", agentUUID, request.UserID).
+		Order("created_at").
+		Find(&thread.Turns).Error
+
+	if err != nil {
+		s.logger.Errorf("получение диалога: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения диалога",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	if len(thread.Turns) == 0 {
+		return nil, utils.NewUserErrorResponse(
+			404,
+			"Диалог не найден",
+			"У пользователя нет истории диалога с этим агентом",
+		)
+	}
+
+	thread.PatientID = s.LoadPatient(agentUUID, request.UserID, postgres)
+
+	pendingActions, errorResponse := s.LoadPendingActions(agentUUID, request.UserID, postgres)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+	for _, action := range pendingActions {
+		thread.PendingActions = append(thread.PendingActions, s.pendingActionResponse(action))
+	}
+
+	return thread, nil
+}
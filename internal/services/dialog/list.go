@@ -1 +1,118 @@
 package dialog
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// Ограничения размера страницы списка диалогов
+const (
+	defaultDialogsLimit = 20
+	maxDialogsLimit     = 100
+)
+
+type GetDialogsRequest struct {
+	AgentID  string `json:"agent_id" validate:"required,uuid"`
+	UserID   string `query:"user_id"`
+	DateFrom string `query:"date_from" validate:"omitempty,datetime=2006-01-02"`
+	DateTo   string `query:"date_to" validate:"omitempty,datetime=2006-01-02"`
+	Limit    int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Offset   int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+// DialogSummary описывает диалог одного пользователя с агентом без реплик
+type DialogSummary struct {
+	UserID         string    `json:"user_id"`
+	Messages       int       `json:"messages"`
+	FirstMessageAt time.Time `json:"first_message_at"`
+	LastMessageAt  time.Time `json:"last_message_at"`
+}
+
+type DialogList struct {
+	Items  []DialogSummary `json:"items"`
+	Total  int64           `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+// GetDialogs возвращает диалоги агента, сгруппированные по пользователям, начиная с самых свежих
+func (s *Service) GetDialogs(request *GetDialogsRequest, postgres *databases.PostgresDatabase) (*DialogList, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	if _, errorResponse := agent.NewService().GetAgent(agentUUID, postgres); errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	if request.Limit <= 0 {
+		request.Limit = defaultDialogsLimit
+	}
+	if request.Limit > maxDialogsLimit {
+		request.Limit = maxDialogsLimit
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("agent_id = ?", agentUUID)
+
+		if request.UserID != "" {
+			db = db.Where("user_id = ?", request.UserID)
+		}
+		if request.DateFrom != "" {
+			dateFrom, _ := time.ParseInLocation(time.DateOnly, request.DateFrom, time.Local)
+			db = db.Where("created_at >= ?", dateFrom)
+		}
+		if request.DateTo != "" {
+			// Дата окончания включается в диапазон целиком
+			dateTo, _ := time.ParseInLocation(time.DateOnly, request.DateTo, time.Local)
+			db = db.Where("created_at < ?", dateTo.AddDate(0, 0, 1))
+		}
+
+		return db
+	}
+
+	list := &DialogList{
+		Items:  []DialogSummary{},
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+
+	err := postgres.DB.
+		Model(&models.Dialog{}).
+		Scopes(filter).
+		Distinct("user_id").
+		Count(&list.Total).Error
+
+	if err != nil {
+		s.logger.Errorf("подсчет диалогов: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения списка диалогов",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	err = postgres.DB.
+		Model(&models.Dialog{}).
+		Scopes(filter).
+		Select("user_id, COUNT(*) AS messages, MIN(created_at) AS first_message_at, MAX(created_at) AS last_message_at").
+		Group("user_id").
+		Order("last_message_at DESC").
+		Limit(request.Limit).
+		Offset(request.Offset).
+		Scan(&list.Items).Error
+
+	if err != nil {
+		s.logger.Errorf("получение списка диалогов: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения списка диалогов",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,130 @@
+package dialog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"github.com/openai/openai-go"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/tool"
+	"time"
+)
+
+// maxIdenticalToolCalls ограничивает количество одинаковых вызовов инструмента с одинаковыми аргументами
+const maxIdenticalToolCalls = 2
+
+// toolLoopFallbackMessage возвращается пользователю, если модель не смогла ответить после остановки цикла
+const toolLoopFallbackMessage = "Извините, мне не удалось выполнить ваш запрос. Пожалуйста, уточните его или обратитесь к администратору клиники."
+
+// ToolTrace описывает один выполненный вызов инструмента для отладки
+type ToolTrace struct {
+	Round      int    `json:"round"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments"`
+	LatencyMs  int64  `json:"latency_ms"`
+	ResultSize int    `json:"result_size"`
+}
+
+// toolLoop следит за раундами вызова инструментов: ограничивает их количество,
+// обнаруживает зацикливание и собирает отладочную трассировку
+type toolLoop struct {
+	logger    *log.Logger
+	maxRounds int
+	round     int
+	calls     map[string]int
+	startedAt map[string]time.Time
+	Trace     []ToolTrace
+}
+
+func newToolLoop(agent *models.Agent, logger *log.Logger) *toolLoop {
+	return &toolLoop{
+		logger:    logger,
+		maxRounds: agent.MaxToolRounds,
+		calls:     make(map[string]int),
+		startedAt: make(map[string]time.Time),
+	}
+}
+
+// attach подключает трассировку к сервису инструментов, сохраняя уже назначенные обработчики
+func (l *toolLoop) attach(toolService *tool.Service) {
+	onStarted := toolService.OnToolStarted
+	onFinished := toolService.OnToolFinished
+
+	toolService.OnToolStarted = func(toolCall openai.ChatCompletionMessageToolCall) {
+		l.startedAt[toolCall.ID] = time.Now()
+
+		if onStarted != nil {
+			onStarted(toolCall)
+		}
+	}
+
+	toolService.OnToolFinished = func(toolCall openai.ChatCompletionMessageToolCall, result string) {
+		l.Trace = append(l.Trace, ToolTrace{
+			Round:      l.round,
+			ID:         toolCall.ID,
+			Name:       toolCall.Function.Name,
+			Arguments:  toolCall.Function.Arguments,
+			LatencyMs:  time.Since(l.startedAt[toolCall.ID]).Milliseconds(),
+			ResultSize: len(result),
+		})
+
+		if onFinished != nil {
+			onFinished(toolCall, result)
+		}
+	}
+}
+
+// next начинает новый раунд вызовов инструментов.
+// Возвращает причину остановки, если раунд выполнять нельзя.
+func (l *toolLoop) next(toolCalls []openai.ChatCompletionMessageToolCall) string {
+	if l.round >= l.maxRounds {
+		l.logger.Warnf("достигнут лимит раундов инструментов: %d", l.maxRounds)
+		return fmt.Sprintf("достигнут лимит вызовов инструментов (%d)", l.maxRounds)
+	}
+
+	for _, toolCall := range toolCalls {
+		key := toolCall.Function.Name + ":" + compactArguments(toolCall.Function.Arguments)
+		l.calls[key]++
+
+		if l.calls[key] > maxIdenticalToolCalls {
+			l.logger.Warnf("обнаружено зацикливание инструмента %s с аргументами %s", toolCall.Function.Name, toolCall.Function.Arguments)
+			return fmt.Sprintf("инструмент %s повторно вызывается с теми же аргументами", toolCall.Function.Name)
+		}
+	}
+
+	l.round++
+	l.logger.Infof("раунд инструментов %d из %d", l.round, l.maxRounds)
+	return ""
+}
+
+// fallbackParams готовит запрос без инструментов, чтобы модель ответила по уже полученным данным
+func (s *Service) fallbackParams(
+	agent *models.Agent,
+	messages []openai.ChatCompletionMessageParamUnion,
+	reason string,
+) openai.ChatCompletionNewParams {
+	fallbackMessages := append(messages[:len(messages):len(messages)], openai.SystemMessage(
+		"Выполнение инструментов остановлено: "+reason+". "+
+			"Не вызывай инструменты, ответь пользователю на основе уже полученных данных "+
+			"и, если запрос не выполнен, честно сообщи об этом.",
+	))
+
+	return s.GetChatCompletionParams(agent, fallbackMessages)
+}
+
+func compactArguments(arguments string) string {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, []byte(arguments)); err != nil {
+		return arguments
+	}
+	return buffer.String()
+}
+
+func newAssistantMessage(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatCompletionMessageRoleAssistant,
+		Content: content,
+	}
+}
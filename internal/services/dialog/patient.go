@@ -0,0 +1,72 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/tool"
+)
+
+// LoadPatient возвращает ID пациента, запомненного в диалоге, или 0
+func (s *Service) LoadPatient(agentID uuid.UUID, userID string, postgres *databases.PostgresDatabase) int {
+	var patient models.DialogPatient
+
+	err := postgres.DB.
+		Where("agent_id = ? AND user_id = ?", agentID, userID).
+		First(&patient).Error
+
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Errorf("получение пациента диалога: %v", err)
+		}
+		return 0
+	}
+
+	return patient.PatientID
+}
+
+// SavePatient сохраняет пациента, определенного инструментами за время ответа
+func (s *Service) SavePatient(conversation *Conversation, toolService *tool.Service, postgres *databases.PostgresDatabase) {
+	patientID := toolService.PatientID()
+	if patientID == 0 || patientID == conversation.PatientID {
+		return
+	}
+
+	if s.storePatient(conversation.Agent.ID, conversation.UserID, patientID, postgres) {
+		conversation.PatientID = patientID
+	}
+}
+
+func (s *Service) storePatient(agentID uuid.UUID, userID string, patientID int, postgres *databases.PostgresDatabase) bool {
+	err := postgres.DB.Save(&models.DialogPatient{
+		AgentID:   agentID,
+		UserID:    userID,
+		PatientID: patientID,
+	}).Error
+
+	if err != nil {
+		s.logger.Errorf("сохранение пациента диалога: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// patientPrompt сообщает модели, что пациент уже определен в предыдущих сообщениях
+func patientPrompt(patientID int) string {
+	return fmt.Sprintf(
+		"Пациент этого диалога уже найден в базе клиники, его ID: %d. Используйте его для записи и не создавайте пациента повторно.",
+		patientID,
+	)
+}
+
+// newToolService создает сервис инструментов, которому известен пациент диалога
+func (s *Service) newToolService(conversation *Conversation, denttime *clients.Client) *tool.Service {
+	toolService := tool.NewService(conversation.Agent, denttime)
+	toolService.RememberPatient(conversation.PatientID)
+	return toolService
+}
@@ -0,0 +1,416 @@
+package dialog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/services/tool"
+	"macdent-ai-chatbot/internal/utils"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// pendingActionTTL задает время, в течение которого пользователь может подтвердить действие
+const pendingActionTTL = 15 * time.Minute
+
+// pendingActionFallbackMessage возвращается, если модель не смогла сформулировать запрос подтверждения
+const pendingActionFallbackMessage = "Пожалуйста, подтвердите действие, ответив «да», или откажитесь, ответив «нет»."
+
+// Ответы пользователя, которые однозначно считаются подтверждением или отказом
+var (
+	confirmationReplies = []string{
+		"да", "да да", "да верно", "да все верно", "все верно", "верно", "подтверждаю",
+		"подтвердить", "согласен", "согласна", "ок", "окей", "хорошо", "давайте", "yes",
+	}
+	rejectionReplies = []string{
+		"нет", "нет спасибо", "не надо", "не нужно", "отмена", "отменить", "не подтверждаю", "no",
+	}
+)
+
+// PendingActionResponse описывает действие, ожидающее подтверждения, для клиента
+type PendingActionResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Tool        string    `json:"tool"`
+	Patient     int       `json:"patient,omitempty"`
+	Doctor      int       `json:"doctor,omitempty"`
+	Appointment int       `json:"appointment,omitempty"`
+	Date        string    `json:"date,omitempty"`
+	Start       string    `json:"start,omitempty"`
+	End         string    `json:"end,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Phone       string    `json:"phone,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type ResolvePendingActionRequest struct {
+	AgentID  string `json:"agent_id" validate:"required,uuid"`
+	ActionID string `json:"action_id" validate:"required,uuid"`
+	UserID   string `json:"user_id" validate:"required"`
+}
+
+type PendingActionResult struct {
+	Action PendingActionResponse `json:"action"`
+	Status string                `json:"status"`
+	Result json.RawMessage       `json:"result,omitempty"`
+}
+
+// SavePendingActions сохраняет вызовы, отложенные до подтверждения.
+// Новые действия заменяют неподтвержденные действия из предыдущих сообщений.
+func (s *Service) SavePendingActions(
+	conversation *Conversation,
+	toolService *tool.Service,
+	postgres *databases.PostgresDatabase,
+) []PendingActionResponse {
+	calls := toolService.PendingCalls()
+	if len(calls) == 0 {
+		return nil
+	}
+
+	err := postgres.DB.Model(&models.PendingAction{}).
+		Where("agent_id = ? AND user_id = ? AND status = ?", conversation.Agent.ID, conversation.UserID, models.PendingActionStatusPending).
+		Update("status", models.PendingActionStatusRejected).Error
+
+	if err != nil {
+		s.logger.Errorf("отмена предыдущих действий: %v", err)
+	}
+
+	actions := make([]models.PendingAction, len(calls))
+	for i, call := range calls {
+		actions[i] = models.PendingAction{
+			AgentID:   conversation.Agent.ID,
+			UserID:    conversation.UserID,
+			ToolName:  call.Name,
+			Arguments: call.Arguments,
+			Position:  i,
+			Status:    models.PendingActionStatusPending,
+			ExpiresAt: time.Now().Add(pendingActionTTL),
+		}
+	}
+
+	if err := postgres.DB.Create(&actions).Error; err != nil {
+		s.logger.Errorf("сохранение действий, ожидающих подтверждения: %v", err)
+		return nil
+	}
+
+	responses := make([]PendingActionResponse, len(actions))
+	for i, action := range actions {
+		responses[i] = s.pendingActionResponse(action)
+	}
+
+	s.logger.Infof("%d действий ожидают подтверждения пользователя %s", len(actions), conversation.UserID)
+	return responses
+}
+
+// LoadPendingActions возвращает неподтвержденные действия диалога, помечая просроченные
+func (s *Service) LoadPendingActions(
+	agentID uuid.UUID,
+	userID string,
+	postgres *databases.PostgresDatabase,
+) ([]models.PendingAction, *utils.UserErrorResponse) {
+	err := postgres.DB.Model(&models.PendingAction{}).
+		Where("status = ? AND expires_at < ?", models.PendingActionStatusPending, time.Now()).
+		Update("status", models.PendingActionStatusExpired).Error
+
+	if err != nil {
+		s.logger.Errorf("обновление просроченных действий: %v", err)
+	}
+
+	var actions []models.PendingAction
+
+	err = postgres.DB.
+		Where("agent_id = ? AND user_id = ? AND status = ?", agentID, userID, models.PendingActionStatusPending).
+		Order("created_at, position").
+		Find(&actions).Error
+
+	if err != nil {
+		s.logger.Errorf("получение действий, ожидающих подтверждения: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения действий",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return actions, nil
+}
+
+// resolvePendingByMessage выполняет или отменяет ожидающие действия, если сообщение пользователя
+// однозначно их подтверждает или отклоняет. Возвращает контекст для модели и ID пациента диалога.
+func (s *Service) resolvePendingByMessage(
+	currentAgent *models.Agent,
+	userID string,
+	message string,
+	patientID int,
+	postgres *databases.PostgresDatabase,
+	denttime *clients.Client,
+) (string, int) {
+	actions, errorResponse := s.LoadPendingActions(currentAgent.ID, userID, postgres)
+	if errorResponse != nil || len(actions) == 0 {
+		return "", patientID
+	}
+
+	reply := normalizeReply(message)
+
+	var summary strings.Builder
+
+	switch {
+	case slices.Contains(confirmationReplies, reply):
+		toolService := tool.NewService(currentAgent, denttime)
+		toolService.RememberPatient(patientID)
+
+		summary.WriteString("Пользователь подтвердил действия, они выполнены. Результаты:\n")
+		for i := range actions {
+			result, ok := s.executePendingAction(&actions[i], toolService, postgres)
+			if !ok {
+				result = "действие уже обработано другим запросом"
+			}
+			fmt.Fprintf(&summary, "- %s: %s\n", actions[i].ToolName, result)
+		}
+
+		if toolService.PatientID() != patientID {
+			patientID = toolService.PatientID()
+			s.storePatient(currentAgent.ID, userID, patientID, postgres)
+		}
+	case slices.Contains(rejectionReplies, reply):
+		summary.WriteString("Пользователь отказался от действий, они не выполнены:\n")
+		for i := range actions {
+			if s.claimPendingAction(&actions[i], models.PendingActionStatusRejected, postgres) {
+				fmt.Fprintf(&summary, "- %s %s\n", actions[i].ToolName, actions[i].Arguments)
+			}
+		}
+	default:
+		summary.WriteString("Ожидают подтверждения пользователя и пока не выполнены:\n")
+		for _, action := range actions {
+			fmt.Fprintf(&summary, "- %s %s\n", action.ToolName, action.Arguments)
+		}
+		summary.WriteString("Если пользователь меняет параметры, вызовите инструмент заново с новыми аргументами.")
+	}
+
+	return summary.String(), patientID
+}
+
+// ResolvePendingAction подтверждает или отклоняет действие по запросу клиента
+func (s *Service) ResolvePendingAction(
+	request *ResolvePendingActionRequest,
+	confirmed bool,
+	postgres *databases.PostgresDatabase,
+	denttime *clients.Client,
+) (*PendingActionResult, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+	actionUUID, _ := uuid.Parse(request.ActionID)
+
+	var action models.PendingAction
+
+	err := postgres.DB.
+		Where("id = ? AND agent_id = ? AND user_id = ?", actionUUID, agentUUID, request.UserID).
+		First(&action).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewUserErrorResponse(
+				404,
+				"Действие не найдено",
+				"Действие с указанным ID не существует",
+			)
+		}
+
+		s.logger.Errorf("получение действия: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения действия",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	if action.Status == models.PendingActionStatusPending && action.ExpiresAt.Before(time.Now()) {
+		s.updatePendingAction(&action, models.PendingActionStatusExpired, "", postgres)
+	}
+
+	switch action.Status {
+	case models.PendingActionStatusPending:
+	case models.PendingActionStatusExpired:
+		return nil, utils.NewUserErrorResponse(
+			410,
+			"Срок подтверждения истек",
+			"Повторите запрос в диалоге",
+		)
+	default:
+		return nil, utils.NewUserErrorResponse(
+			409,
+			"Действие уже обработано",
+			"Текущий статус действия: "+action.Status,
+		)
+	}
+
+	var note string
+
+	if confirmed {
+		currentAgent, errorResponse := agent.NewService().
+			GetAgent(agentUUID, postgres)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		patientID := s.LoadPatient(agentUUID, request.UserID, postgres)
+		toolService := tool.NewService(currentAgent, denttime)
+		toolService.RememberPatient(patientID)
+
+		result, ok := s.executePendingAction(&action, toolService, postgres)
+		if !ok {
+			return nil, s.pendingActionConflict(&action, postgres)
+		}
+		if toolService.PatientID() != patientID {
+			s.storePatient(agentUUID, request.UserID, toolService.PatientID(), postgres)
+		}
+
+		note = fmt.Sprintf("Пользователь подтвердил действие %s, оно выполнено. Результат: %s", action.ToolName, result)
+	} else {
+		if !s.claimPendingAction(&action, models.PendingActionStatusRejected, postgres) {
+			return nil, s.pendingActionConflict(&action, postgres)
+		}
+		note = fmt.Sprintf("Пользователь отказался от действия %s, оно не выполнено.", action.ToolName)
+	}
+
+	// Исход записывается в историю, чтобы модель учитывала его в следующих ответах
+	err = postgres.DB.Create(&models.Dialog{
+		AgentID: agentUUID,
+		UserID:  request.UserID,
+		Message: note,
+		Role:    models.DialogRoleAssistant,
+	}).Error
+
+	if err != nil {
+		s.logger.Errorf("сохранение исхода действия в историю: %v", err)
+	}
+
+	response := &PendingActionResult{
+		Action: s.pendingActionResponse(action),
+		Status: action.Status,
+	}
+	if action.Result != "" && json.Valid([]byte(action.Result)) {
+		response.Result = json.RawMessage(action.Result)
+	}
+
+	return response, nil
+}
+
+// executePendingAction выполняет действие, если удалось его занять. Параллельные подтверждения
+// одного действия, например кнопкой и сообщением «да», не выполняют его повторно.
+func (s *Service) executePendingAction(
+	action *models.PendingAction,
+	toolService *tool.Service,
+	postgres *databases.PostgresDatabase,
+) (string, bool) {
+	if !s.claimPendingAction(action, models.PendingActionStatusConfirmed, postgres) {
+		s.logger.Warnf("действие %s уже обработано или просрочено", action.ID)
+		return "", false
+	}
+
+	s.logger.Infof("выполнение подтвержденного действия %s", action.ToolName)
+
+	result, ok := toolService.ExecuteConfirmed(action.ToolName, action.Arguments)
+	if !ok {
+		result = `{"message":"Не удалось выполнить действие"}`
+	}
+
+	s.updatePendingAction(action, models.PendingActionStatusConfirmed, result, postgres)
+	return result, true
+}
+
+// claimPendingAction атомарно переводит ожидающее и не просроченное действие в новый статус.
+// Возвращает false, если действие уже обработано другим запросом или просрочено.
+func (s *Service) claimPendingAction(
+	action *models.PendingAction,
+	status string,
+	postgres *databases.PostgresDatabase,
+) bool {
+	result := postgres.DB.Model(&models.PendingAction{}).
+		Where("id = ? AND status = ? AND expires_at > ?", action.ID, models.PendingActionStatusPending, time.Now()).
+		Update("status", status)
+
+	if result.Error != nil {
+		s.logger.Errorf("обновление статуса действия %s: %v", action.ID, result.Error)
+		return false
+	}
+
+	if result.RowsAffected != 1 {
+		return false
+	}
+
+	action.Status = status
+	return true
+}
+
+// pendingActionConflict объясняет, почему действие не удалось занять
+func (s *Service) pendingActionConflict(action *models.PendingAction, postgres *databases.PostgresDatabase) *utils.UserErrorResponse {
+	if err := postgres.DB.First(action, "id = ?", action.ID).Error; err != nil {
+		s.logger.Errorf("получение действия %s: %v", action.ID, err)
+	}
+
+	if action.Status == models.PendingActionStatusPending || action.Status == models.PendingActionStatusExpired {
+		return utils.NewUserErrorResponse(
+			410,
+			"Срок подтверждения истек",
+			"Повторите запрос в диалоге",
+		)
+	}
+
+	return utils.NewUserErrorResponse(
+		409,
+		"Действие уже обработано",
+		"Текущий статус действия: "+action.Status,
+	)
+}
+
+func (s *Service) updatePendingAction(
+	action *models.PendingAction,
+	status string,
+	result string,
+	postgres *databases.PostgresDatabase,
+) {
+	action.Status = status
+	action.Result = result
+
+	err := postgres.DB.Model(action).Updates(map[string]interface{}{
+		"status": status,
+		"result": result,
+	}).Error
+
+	if err != nil {
+		s.logger.Errorf("обновление статуса действия %s: %v", action.ID, err)
+	}
+}
+
+func (s *Service) pendingActionResponse(action models.PendingAction) PendingActionResponse {
+	response := PendingActionResponse{}
+
+	if err := json.Unmarshal([]byte(action.Arguments), &response); err != nil {
+		s.logger.Warnf("разбор аргументов действия %s: %v", action.ID, err)
+	}
+
+	response.ID = action.ID
+	response.Tool = action.ToolName
+	response.ExpiresAt = action.ExpiresAt
+
+	return response
+}
+
+// normalizeReply приводит короткий ответ пользователя к виду для сравнения со списками подтверждений
+func normalizeReply(message string) string {
+	message = strings.ReplaceAll(strings.ToLower(message), "ё", "е")
+
+	words := strings.FieldsFunc(message, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(words, " ")
+}
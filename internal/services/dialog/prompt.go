@@ -0,0 +1,66 @@
+package dialog
+
+import (
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"strings"
+)
+
+// knowledgePromptsContextShare задает долю контекста модели (1/N), которую могут занять knowledge prompts
+const knowledgePromptsContextShare = 4
+
+// LoadKnowledgePrompts загружает knowledge prompts агента в порядке их загрузки
+func (s *Service) LoadKnowledgePrompts(agent *models.Agent, postgres *databases.PostgresDatabase) *utils.UserErrorResponse {
+	err := postgres.DB.
+		Where("agent_id = ?", agent.ID).
+		Order("created_at ASC").
+		Find(&agent.KnowledgePrompts).Error
+
+	if err != nil {
+		s.logger.Errorf("получение knowledge prompts: %v", err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения базы знаний",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return nil
+}
+
+// ComposeSystemPrompt собирает системное сообщение агента.
+// Порядок: системный промпт, затем knowledge prompts от старых к новым.
+// Knowledge prompts, которые не укладываются в бюджет токенов, пропускаются.
+func (s *Service) ComposeSystemPrompt(agent *models.Agent) string {
+	parts := make([]string, 0, len(agent.KnowledgePrompts)+1)
+
+	if agent.SystemPrompt != "" {
+		parts = append(parts, agent.SystemPrompt)
+	}
+
+	budget := agent.ContextSize / knowledgePromptsContextShare
+	var knowledgeParts []string
+
+	for _, knowledgePrompt := range agent.KnowledgePrompts {
+		prompt := strings.TrimSpace(knowledgePrompt.Prompt)
+		if prompt == "" {
+			continue
+		}
+
+		tokens := EstimateTokens(prompt)
+		if tokens > budget {
+			s.logger.Warnf("knowledge prompt %s не помещается в бюджет (~%d токенов)", knowledgePrompt.ID, tokens)
+			continue
+		}
+
+		budget -= tokens
+		knowledgeParts = append(knowledgeParts, prompt)
+	}
+
+	if len(knowledgeParts) > 0 {
+		parts = append(parts, "Справочная информация о клинике:\n\n"+strings.Join(knowledgeParts, "\n\n"))
+	}
+
+	return strings.Join(parts, "\n\n")
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"github.com/openai/openai-go"
+	"macdent-ai-chatbot/internal/clients"
 	"macdent-ai-chatbot/internal/databases"
 	"macdent-ai-chatbot/internal/models"
 	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/services/knowledge"
 	openai2 "macdent-ai-chatbot/internal/services/openai"
 	"macdent-ai-chatbot/internal/services/tool"
 	"macdent-ai-chatbot/internal/utils"
@@ -17,62 +19,268 @@ type UserDialogNewMessageRequest struct {
 	AgentID string `json:"agent_id" validate:"required,uuid"`
 	UserID  string `json:"user_id" validate:"required"`
 	Message string `json:"message" validate:"required,max=1000"`
+	Debug   bool   `json:"debug"`
+}
+
+// Conversation содержит подготовленный для запроса к OpenAI контекст диалога
+type Conversation struct {
+	Agent             *models.Agent
+	UserID            string
+	UserMessage       string
+	Messages          []openai.ChatCompletionMessageParamUnion
+	KnowledgeChunkIDs []string
+	PatientID         int
+	Debug             bool
+}
+
+type DialogResponse struct {
+	Message        string
+	Trace          []ToolTrace
+	PendingActions []PendingActionResponse
 }
 
 func (s *Service) ResponseDialogNewMessageRequest(
 	request *UserDialogNewMessageRequest,
 	postgres *databases.PostgresDatabase,
-) (string, *utils.UserErrorResponse) {
+	qdrant *databases.QdrantDatabase,
+	denttime *clients.Client,
+) (*DialogResponse, *utils.UserErrorResponse) {
+	conversation, errorResponse := s.PrepareConversation(request, postgres, qdrant, denttime)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	toolService := s.newToolService(conversation, denttime)
+	loop := newToolLoop(conversation.Agent, s.logger)
+	loop.attach(toolService)
+
+	complete := func(params openai.ChatCompletionNewParams) (*openai.ChatCompletion, *utils.UserErrorResponse) {
+		return s.QueryCompletion(conversation.Agent, params)
+	}
+
+	var response *DialogResponse
+	errorResponse = s.runToolRounds(context.Background(), conversation.Agent, conversation.Messages, toolService, loop, complete,
+		func(result toolRoundsResult) {
+			s.SaveConversation(conversation, result.Messages, result.Answer, postgres)
+			s.SavePatient(conversation, toolService, postgres)
+
+			response = &DialogResponse{
+				Message:        result.Answer.Content,
+				Trace:          loop.Trace,
+				PendingActions: s.SavePendingActions(conversation, toolService, postgres),
+			}
+		})
+
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	return response, nil
+}
+
+// PrepareConversation собирает промпты, базу знаний, историю и новое сообщение пользователя.
+// Если сообщение подтверждает или отклоняет ожидающие действия, они обрабатываются до запроса к модели.
+func (s *Service) PrepareConversation(
+	request *UserDialogNewMessageRequest,
+	postgres *databases.PostgresDatabase,
+	qdrant *databases.QdrantDatabase,
+	denttime *clients.Client,
+) (*Conversation, *utils.UserErrorResponse) {
 	agentUUID, _ := uuid.Parse(request.AgentID)
 
 	currentAgent, errorResponse := agent.NewService().
 		GetAgent(agentUUID, postgres)
 
 	if errorResponse != nil {
-		return "", errorResponse
+		return nil, errorResponse
+	}
+
+	errorResponse = s.LoadKnowledgePrompts(currentAgent, postgres)
+	if errorResponse != nil {
+		return nil, errorResponse
 	}
 
 	var messages []openai.ChatCompletionMessageParamUnion
 
-	if currentAgent.SystemPrompt != "" {
-		messages = append(messages, openai.SystemMessage(currentAgent.SystemPrompt))
+	systemPrompt := s.ComposeSystemPrompt(currentAgent)
+	if systemPrompt != "" {
+		messages = append(messages, openai.SystemMessage(systemPrompt))
 	}
 	if currentAgent.UserPrompt != "" {
 		messages = append(messages, openai.SystemMessage(currentAgent.UserPrompt))
 	}
 
+	var knowledgeContext string
+	var knowledgeChunkIDs []string
+	searchResults, errorResponse := knowledge.NewService(postgres, qdrant).
+		SearchKnowledge(currentAgent, request.Message)
+
+	if errorResponse != nil {
+		s.logger.Warnf("ответ без базы знаний: %s", errorResponse.Message)
+	} else if len(searchResults) > 0 {
+		knowledgeContext = knowledge.FormatSearchResults(searchResults)
+		for _, result := range searchResults {
+			knowledgeChunkIDs = append(knowledgeChunkIDs, result.ID)
+		}
+	}
+
+	var patientContext string
+	patientID := s.LoadPatient(currentAgent.ID, request.UserID, postgres)
+
+	pendingContext, patientID := s.resolvePendingByMessage(currentAgent, request.UserID, request.Message, patientID, postgres, denttime)
+
+	if patientID != 0 {
+		patientContext = patientPrompt(patientID)
+		messages = append(messages, openai.SystemMessage(patientContext))
+	}
+
+	// Бюджет истории: контекст модели за вычетом промптов, нового сообщения и места под ответ
+	historyBudget := currentAgent.ContextSize - currentAgent.MaxCompletionTokens -
+		EstimateTokens(patientContext) -
+		EstimateTokens(pendingContext) -
+		EstimateTokens(systemPrompt) -
+		EstimateTokens(currentAgent.UserPrompt) -
+		EstimateTokens(knowledgeContext) -
+		EstimateTokens(request.Message)
+
+	history, errorResponse := s.LoadHistory(currentAgent.ID, request.UserID, historyBudget, postgres)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	messages = append(messages, history...)
+
+	if knowledgeContext != "" {
+		messages = append(messages, openai.SystemMessage(knowledgeContext))
+	}
+	if pendingContext != "" {
+		messages = append(messages, openai.SystemMessage(pendingContext))
+	}
+
 	messages = append(messages, openai.UserMessage(request.Message))
 
 	s.logger.Infof("сообщения для OpenAI: %v", messages)
 
-	toolService := tool.NewService(currentAgent)
+	return &Conversation{
+		Agent:             currentAgent,
+		UserID:            request.UserID,
+		UserMessage:       request.Message,
+		Messages:          messages,
+		KnowledgeChunkIDs: knowledgeChunkIDs,
+		PatientID:         patientID,
+		Debug:             request.Debug,
+	}, nil
+}
+
+// SaveConversation сохраняет в историю сообщение пользователя, вызовы инструментов и итоговый ответ
+func (s *Service) SaveConversation(
+	conversation *Conversation,
+	messages []openai.ChatCompletionMessageParamUnion,
+	answer openai.ChatCompletionMessage,
+	postgres *databases.PostgresDatabase,
+) {
+	newMessages := append(messages[len(conversation.Messages):], answer)
 
-	return s.processMessagesWithTools(currentAgent, messages, toolService)
+	s.SaveHistory(
+		conversation.Agent.ID,
+		conversation.UserID,
+		conversation.UserMessage,
+		conversation.KnowledgeChunkIDs,
+		newMessages,
+		postgres,
+	)
 }
 
-func (s *Service) processMessagesWithTools(
+// completionFunc выполняет запрос к модели: обычный или потоковый
+type completionFunc func(params openai.ChatCompletionNewParams) (*openai.ChatCompletion, *utils.UserErrorResponse)
+
+// toolRoundsResult — итог раундов вызова инструментов
+type toolRoundsResult struct {
+	Messages []openai.ChatCompletionMessageParamUnion
+	Answer   openai.ChatCompletionMessage
+	Usage    openai.CompletionUsage
+	// Fallback — ответ взят из заготовки, потому что запрос к модели после остановки раундов не удался
+	Fallback bool
+}
+
+// runToolRounds запрашивает модель и выполняет вызванные ею инструменты, пока модель не ответит текстом,
+// раунды не будут остановлены или действие не будет отложено до подтверждения. Итог передается в finish.
+// После отмены ctx новые раунды и инструменты не запускаются, а итог не передается.
+func (s *Service) runToolRounds(
+	ctx context.Context,
 	agent *models.Agent,
 	messages []openai.ChatCompletionMessageParamUnion,
 	toolService *tool.Service,
-) (string, *utils.UserErrorResponse) {
-	chatCompletionParams := s.GetChatCompletionParams(agent, messages)
-	chatCompletionParams.Tools = openai.F(toolService.GetToolsFunctions())
-	completion, err := s.QueryCompletion(agent, chatCompletionParams)
+	loop *toolLoop,
+	complete completionFunc,
+	finish func(result toolRoundsResult),
+) *utils.UserErrorResponse {
+	result := toolRoundsResult{Messages: messages}
 
-	if err != nil {
-		return "", err
+	// answerOrFallback завершает раунды ответом модели, а при ошибке запроса — заготовленным сообщением
+	answerOrFallback := func(params openai.ChatCompletionNewParams, fallbackMessage string) {
+		completion, errorResponse := complete(params)
+		if errorResponse != nil {
+			result.Answer = newAssistantMessage(fallbackMessage)
+			result.Fallback = true
+		} else {
+			result.Answer = completion.Choices[0].Message
+			addUsage(&result.Usage, completion.Usage)
+		}
+
+		finish(result)
 	}
 
-	toolMessage := completion.Choices[0].Message
-	s.logger.Infof("ответ OpenAI: %v", toolMessage)
+	for {
+		if ctx.Err() != nil {
+			return requestCancelledError()
+		}
+
+		chatCompletionParams := s.GetChatCompletionParams(agent, result.Messages)
+		chatCompletionParams.Tools = openai.F(toolService.GetToolsFunctions())
+
+		completion, errorResponse := complete(chatCompletionParams)
+		if errorResponse != nil {
+			return errorResponse
+		}
+		addUsage(&result.Usage, completion.Usage)
 
-	if toolService.HasToolCalls(toolMessage.ToolCalls) {
-		updatedMessages := toolService.ExecuteToolCalls(messages, toolMessage)
+		toolMessage := completion.Choices[0].Message
+		s.logger.Infof("ответ OpenAI: %v", toolMessage)
 
-		return s.processMessagesWithTools(agent, updatedMessages, toolService)
+		if !toolService.HasToolCalls(toolMessage.ToolCalls) {
+			result.Answer = toolMessage
+			finish(result)
+			return nil
+		}
+
+		if reason := loop.next(toolMessage.ToolCalls); reason != "" {
+			answerOrFallback(s.fallbackParams(agent, result.Messages, reason), toolLoopFallbackMessage)
+			return nil
+		}
+
+		result.Messages = toolService.ExecuteToolCalls(ctx, result.Messages, toolMessage)
+		if ctx.Err() != nil {
+			return requestCancelledError()
+		}
+
+		// Действие отложено до подтверждения: модель без инструментов просит пользователя подтвердить его
+		if len(toolService.PendingCalls()) > 0 {
+			answerOrFallback(s.GetChatCompletionParams(agent, result.Messages), pendingActionFallbackMessage)
+			return nil
+		}
 	}
+}
+
+// requestCancelledError возвращается, когда клиент перестал получать ответ
+func requestCancelledError() *utils.UserErrorResponse {
+	return utils.NewUserErrorResponse(499, "Запрос отменен", "Клиент отключился до завершения ответа")
+}
 
-	return toolMessage.Content, nil
+func addUsage(total *openai.CompletionUsage, usage openai.CompletionUsage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
 }
 
 func (s *Service) GetChatCompletionParams(agent *models.Agent, messages []openai.ChatCompletionMessageParamUnion) openai.ChatCompletionNewParams {
@@ -0,0 +1,188 @@
+package dialog
+
+import (
+	"context"
+	"github.com/openai/openai-go"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	openai2 "macdent-ai-chatbot/internal/services/openai"
+	"macdent-ai-chatbot/internal/services/tool"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// Типы SSE событий потокового ответа
+const (
+	StreamEventDelta        = "delta"
+	StreamEventToolStarted  = "tool_started"
+	StreamEventToolFinished = "tool_finished"
+	StreamEventDone         = "done"
+	StreamEventError        = "error"
+)
+
+type StreamEvent struct {
+	Name string
+	Data any
+}
+
+type StreamDelta struct {
+	Content string `json:"content"`
+}
+
+type StreamToolProgress struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ResultSize int    `json:"result_size,omitempty"`
+}
+
+type StreamDone struct {
+	Message string                 `json:"message"`
+	Usage   openai.CompletionUsage `json:"usage"`
+	Trace   []ToolTrace            `json:"trace,omitempty"`
+
+	PendingActions []PendingActionResponse `json:"pending_actions,omitempty"`
+}
+
+type StreamError struct {
+	Message string `json:"ошибка"`
+	Details string `json:"детали"`
+}
+
+// StreamConversation выполняет диалог с потоковой отдачей токенов и прогресса инструментов.
+// События передаются в send по мере появления, последним всегда идет done или error.
+// Отмена ctx, например при отключении клиента, останавливает запрос к модели и вызовы инструментов.
+func (s *Service) StreamConversation(
+	ctx context.Context,
+	conversation *Conversation,
+	postgres *databases.PostgresDatabase,
+	denttime *clients.Client,
+	send func(event StreamEvent),
+) {
+	currentAgent := conversation.Agent
+
+	toolService := s.newToolService(conversation, denttime)
+	toolService.OnToolStarted = func(toolCall openai.ChatCompletionMessageToolCall) {
+		send(StreamEvent{Name: StreamEventToolStarted, Data: StreamToolProgress{
+			ID:   toolCall.ID,
+			Name: toolCall.Function.Name,
+		}})
+	}
+	toolService.OnToolFinished = func(toolCall openai.ChatCompletionMessageToolCall, result string) {
+		send(StreamEvent{Name: StreamEventToolFinished, Data: StreamToolProgress{
+			ID:         toolCall.ID,
+			Name:       toolCall.Function.Name,
+			ResultSize: len(result),
+		}})
+	}
+
+	loop := newToolLoop(currentAgent, s.logger)
+	loop.attach(toolService)
+
+	complete := func(params openai.ChatCompletionNewParams) (*openai.ChatCompletion, *utils.UserErrorResponse) {
+		params.StreamOptions = openai.F(openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.F(true),
+		})
+		return s.StreamCompletion(ctx, currentAgent, params, send)
+	}
+
+	errorResponse := s.runToolRounds(ctx, currentAgent, conversation.Messages, toolService, loop, complete,
+		func(result toolRoundsResult) {
+			// Заготовленный ответ не пришел из потока модели, поэтому отправляем его отдельной дельтой
+			if result.Fallback {
+				send(StreamEvent{Name: StreamEventDelta, Data: StreamDelta{Content: result.Answer.Content}})
+			}
+
+			s.finishStream(conversation, result.Messages, result.Answer, result.Usage, toolService, loop, postgres, send)
+		})
+
+	if errorResponse != nil {
+		if ctx.Err() != nil {
+			s.logger.Warnf("потоковый ответ пользователю %s прерван: клиент отключился", conversation.UserID)
+			return
+		}
+
+		send(StreamEvent{Name: StreamEventError, Data: StreamError{
+			Message: errorResponse.Message,
+			Details: errorResponse.Details,
+		}})
+	}
+}
+
+func (s *Service) finishStream(
+	conversation *Conversation,
+	messages []openai.ChatCompletionMessageParamUnion,
+	answer openai.ChatCompletionMessage,
+	usage openai.CompletionUsage,
+	toolService *tool.Service,
+	loop *toolLoop,
+	postgres *databases.PostgresDatabase,
+	send func(event StreamEvent),
+) {
+	s.SaveConversation(conversation, messages, answer, postgres)
+	s.SavePatient(conversation, toolService, postgres)
+
+	done := StreamDone{
+		Message:        answer.Content,
+		Usage:          usage,
+		PendingActions: s.SavePendingActions(conversation, toolService, postgres),
+	}
+	if conversation.Debug {
+		done.Trace = loop.Trace
+	}
+
+	send(StreamEvent{Name: StreamEventDone, Data: done})
+}
+
+// StreamCompletion выполняет потоковый запрос к OpenAI, отправляя дельты текста в send,
+// и возвращает собранный из чанков ответ
+func (s *Service) StreamCompletion(
+	parent context.Context,
+	agent *models.Agent,
+	completionParams openai.ChatCompletionNewParams,
+	send func(event StreamEvent),
+) (*openai.ChatCompletion, *utils.UserErrorResponse) {
+	openaiService := openai2.NewService(agent.APIKey)
+
+	ctx, cancel := context.WithTimeout(parent, 60*time.Second)
+	defer cancel()
+
+	stream := openaiService.Client.Chat.Completions.NewStreaming(ctx, completionParams)
+	defer func() {
+		if err := stream.Close(); err != nil {
+			s.logger.Errorf("закрытие потока OpenAI: %v", err)
+		}
+	}()
+
+	accumulator := openai.ChatCompletionAccumulator{}
+
+	for stream.Next() {
+		chunk := stream.Current()
+		accumulator.AddChunk(chunk)
+
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			send(StreamEvent{Name: StreamEventDelta, Data: StreamDelta{
+				Content: chunk.Choices[0].Delta.Content,
+			}})
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		s.logger.Errorf("потоковый запрос к OpenAI: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка обработки сообщения",
+			"Не удалось обработать ваше сообщение. Пожалуйста, попробуйте позже.",
+		)
+	}
+
+	if len(accumulator.Choices) == 0 {
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Пустой ответ",
+			"Сервис не смог сформировать ответ на ваше сообщение. Пожалуйста, перефразируйте или попробуйте позже.",
+		)
+	}
+
+	return &accumulator.ChatCompletion, nil
+}
@@ -1,12 +1,16 @@
 package knowledge
 
 import (
+	"macdent-ai-chatbot/internal/models"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
+// ChunkingConfig задает стратегию разбиения и размеры чанков.
+// Для стратегии tokens размеры указываются в токенах, для остальных — в символах.
 type ChunkingConfig struct {
+	Strategy     string
 	ChunkSize    int
 	OverlapSize  int
 	MinChunkSize int
@@ -21,27 +25,67 @@ type Chunk struct {
 
 func NewDefaultChunkingConfig() *ChunkingConfig {
 	return &ChunkingConfig{
+		Strategy:     models.ChunkingStrategyFixed,
 		ChunkSize:    800, // Уменьшил для более стабильной работы
 		OverlapSize:  150,
 		MinChunkSize: 50,
 	}
 }
 
+// NewChunkingConfig создает настройки стратегии. Нулевые размеры заменяются значениями по умолчанию.
+func NewChunkingConfig(strategy string, chunkSize int, overlapSize int) *ChunkingConfig {
+	config := NewDefaultChunkingConfig()
+
+	switch strategy {
+	case models.ChunkingStrategyStructure:
+		config.Strategy = strategy
+		config.ChunkSize = 1200
+		config.OverlapSize = 0
+	case models.ChunkingStrategyTokens:
+		config.Strategy = strategy
+		config.ChunkSize = 400
+		config.OverlapSize = 60
+		config.MinChunkSize = 10
+	case models.ChunkingStrategyRows:
+		config.Strategy = strategy
+		config.ChunkSize = 1200
+		config.OverlapSize = 0
+		config.MinChunkSize = 1
+	}
+
+	if chunkSize > 0 {
+		config.ChunkSize = chunkSize
+	}
+	if overlapSize > 0 {
+		config.OverlapSize = overlapSize
+	}
+	if config.OverlapSize >= config.ChunkSize {
+		config.OverlapSize = config.ChunkSize / 4
+	}
+
+	return config
+}
+
+// CreateChunks разбивает текст на чанки согласно стратегии. По умолчанию используется окно фиксированной длины.
 func (s *Service) CreateChunks(text string, config *ChunkingConfig) []Chunk {
 	if config == nil {
 		config = NewDefaultChunkingConfig()
 	}
 
+	switch config.Strategy {
+	case models.ChunkingStrategyStructure:
+		return s.createStructureChunks(text, config)
+	case models.ChunkingStrategyTokens:
+		return s.createTokenChunks(text, config, defaultTokenizer)
+	case models.ChunkingStrategyRows:
+		return s.createRowChunks(text, config)
+	}
+
 	text = s.preprocessText(text)
 	runes := []rune(text) // Работаем с рунами, а не байтами!
 
 	if len(runes) <= config.ChunkSize {
-		return []Chunk{{
-			Text:     text,
-			StartIdx: 0,
-			EndIdx:   len(runes),
-			Metadata: map[string]interface{}{"chunk_index": 0},
-		}}
+		return []Chunk{newChunk(text, 0, len(runes), 0)}
 	}
 
 	var chunks []Chunk
@@ -0,0 +1,340 @@
+package knowledge
+
+import (
+	"macdent-ai-chatbot/internal/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// textLine хранит строку нормализованного текста и ее позицию в рунах
+type textLine struct {
+	text  string
+	start int
+	end   int
+}
+
+// normalizeLines нормализует пробелы в строках, сохраняя переносы строк и одну пустую строку между абзацами.
+// В отличие от preprocessText структура текста не теряется.
+func normalizeLines(text string) []textLine {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var lines []textLine
+	offset := 0
+	blank := true
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank {
+				lines = append(lines, textLine{start: offset, end: offset})
+				offset++
+			}
+			blank = true
+			continue
+		}
+
+		length := utf8.RuneCountInString(line)
+		lines = append(lines, textLine{text: line, start: offset, end: offset + length})
+		offset += length + 1
+		blank = false
+	}
+
+	return lines
+}
+
+func joinTextLines(lines []textLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// headingLevelOf возвращает уровень Markdown заголовка, который расставляют извлекатели текста
+func headingLevelOf(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+
+	if level == 0 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return 0, ""
+	}
+
+	return level, strings.TrimSpace(line[level:])
+}
+
+// headingPath хранит текущую цепочку заголовков раздела
+type headingPath []string
+
+func (p headingPath) enter(level int, title string) headingPath {
+	if level-1 < len(p) {
+		p = p[:level-1]
+	}
+	for len(p) < level-1 {
+		p = append(p, "")
+	}
+	return append(p, title)
+}
+
+func (p headingPath) String() string {
+	var parts []string
+	for _, title := range p {
+		if title != "" {
+			parts = append(parts, title)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+func withContext(context string, text string) string {
+	if context == "" {
+		return text
+	}
+	return context + "\n" + text
+}
+
+func newChunk(text string, start int, end int, index int) Chunk {
+	return Chunk{
+		Text:     text,
+		StartIdx: start,
+		EndIdx:   end,
+		Metadata: map[string]interface{}{
+			"chunk_index": index,
+			"char_count":  utf8.RuneCountInString(text),
+			"word_count":  len(strings.Fields(text)),
+		},
+	}
+}
+
+// createStructureChunks собирает чанки из целых абзацев. Заголовок начинает новый чанк,
+// а цепочка заголовков раздела добавляется в начало каждого его чанка.
+// Слишком длинный абзац делится по строкам, а слишком длинная строка режется как в стратегии по умолчанию.
+func (s *Service) createStructureChunks(text string, config *ChunkingConfig) []Chunk {
+	var chunks []Chunk
+	var path headingPath
+	var content strings.Builder
+	start, end := 0, 0
+	length := 0
+
+	flush := func() {
+		if length > 0 {
+			chunkText := withContext(path.String(), content.String())
+			chunks = append(chunks, newChunk(chunkText, start, end, len(chunks)))
+		}
+		content.Reset()
+		length = 0
+	}
+
+	// add добавляет фрагмент в текущий чанк через separator, начиная новый чанк при переполнении
+	add := func(lines []textLine, separator string) {
+		fragment := joinTextLines(lines)
+		fragmentLength := utf8.RuneCountInString(fragment)
+
+		if length > 0 && length+fragmentLength > config.ChunkSize {
+			flush()
+		}
+
+		if fragmentLength > config.ChunkSize {
+			for _, part := range s.splitLongText(fragment, config) {
+				chunkText := withContext(path.String(), part.Text)
+				chunks = append(chunks, newChunk(chunkText, lines[0].start+part.StartIdx, lines[0].start+part.EndIdx, len(chunks)))
+			}
+			return
+		}
+
+		if length == 0 {
+			start = lines[0].start
+		} else {
+			content.WriteString(separator)
+		}
+		content.WriteString(fragment)
+		end = lines[len(lines)-1].end
+		length += fragmentLength
+	}
+
+	addParagraph := func(paragraph []textLine) {
+		if len(paragraph) == 1 || utf8.RuneCountInString(joinTextLines(paragraph)) <= config.ChunkSize {
+			add(paragraph, "\n\n")
+			return
+		}
+
+		for i := range paragraph {
+			separator := "\n"
+			if i == 0 {
+				separator = "\n\n"
+			}
+			add(paragraph[i:i+1], separator)
+		}
+	}
+
+	var paragraph []textLine
+	for _, line := range normalizeLines(text) {
+		if level, title := headingLevelOf(line.text); level > 0 {
+			if len(paragraph) > 0 {
+				addParagraph(paragraph)
+				paragraph = nil
+			}
+			flush()
+			path = path.enter(level, title)
+			continue
+		}
+
+		if line.text == "" {
+			if len(paragraph) > 0 {
+				addParagraph(paragraph)
+				paragraph = nil
+			}
+			continue
+		}
+
+		paragraph = append(paragraph, line)
+	}
+
+	if len(paragraph) > 0 {
+		addParagraph(paragraph)
+	}
+	flush()
+
+	return chunks
+}
+
+// createRowChunks выделяет каждую строку таблицы в отдельный чанк. Чтобы строка не теряла смысл,
+// к ней добавляются цепочка заголовков (например, название листа) и строка заголовков колонок таблицы.
+func (s *Service) createRowChunks(text string, config *ChunkingConfig) []Chunk {
+	var chunks []Chunk
+	var path headingPath
+	header := ""
+	tableStart := true
+
+	for _, line := range normalizeLines(text) {
+		if level, title := headingLevelOf(line.text); level > 0 {
+			path = path.enter(level, title)
+			header = ""
+			tableStart = true
+			continue
+		}
+
+		if line.text == "" {
+			header = ""
+			tableStart = true
+			continue
+		}
+
+		isTableRow := strings.Contains(line.text, " | ")
+		if isTableRow && tableStart {
+			// Первая строка таблицы считается строкой заголовков колонок
+			header = line.text
+			tableStart = false
+			continue
+		}
+		tableStart = false
+
+		context := path.String()
+		if isTableRow && header != "" {
+			context = withContext(context, header)
+		}
+
+		if utf8.RuneCountInString(line.text) <= config.ChunkSize {
+			if utf8.RuneCountInString(line.text) >= config.MinChunkSize {
+				chunks = append(chunks, newChunk(withContext(context, line.text), line.start, line.end, len(chunks)))
+			}
+			continue
+		}
+
+		for _, part := range s.splitLongText(line.text, config) {
+			chunks = append(chunks, newChunk(withContext(context, part.Text), line.start+part.StartIdx, line.start+part.EndIdx, len(chunks)))
+		}
+	}
+
+	// Таблица из одной строки заголовков не должна потеряться
+	if len(chunks) == 0 && header != "" {
+		chunks = append(chunks, newChunk(withContext(path.String(), header), 0, utf8.RuneCountInString(header), 0))
+	}
+
+	return chunks
+}
+
+// splitLongText режет слишком длинный фрагмент окном фиксированной длины без оверлапа
+func (s *Service) splitLongText(text string, config *ChunkingConfig) []Chunk {
+	return s.CreateChunks(text, &ChunkingConfig{
+		Strategy:     models.ChunkingStrategyFixed,
+		ChunkSize:    config.ChunkSize,
+		OverlapSize:  config.OverlapSize,
+		MinChunkSize: 1,
+	})
+}
+
+// createTokenChunks набирает чанки по количеству токенов модели эмбеддингов.
+// Чанк по возможности заканчивается на границе предложения или строки.
+func (s *Service) createTokenChunks(text string, config *ChunkingConfig, tokenizer Tokenizer) []Chunk {
+	normalized := joinTextLines(normalizeLines(text))
+	pieces := tokenizer.Pieces(normalized)
+	if len(pieces) == 0 {
+		return nil
+	}
+
+	offsets := make([]int, len(pieces)+1)
+	for i, piece := range pieces {
+		offsets[i+1] = offsets[i] + utf8.RuneCountInString(piece.Text)
+	}
+
+	var chunks []Chunk
+	start := 0
+
+	for start < len(pieces) {
+		end := start
+		tokens := 0
+		lastBreak := -1
+
+		for end < len(pieces) && (end == start || tokens+pieces[end].Tokens <= config.ChunkSize) {
+			tokens += pieces[end].Tokens
+			end++
+			if tokens >= config.ChunkSize/2 && isBreakPiece(pieces[end-1].Text) {
+				lastBreak = end
+			}
+		}
+
+		if end < len(pieces) && lastBreak > start {
+			end = lastBreak
+		}
+
+		var builder strings.Builder
+		chunkTokens := 0
+		for _, piece := range pieces[start:end] {
+			builder.WriteString(piece.Text)
+			chunkTokens += piece.Tokens
+		}
+
+		chunkText := strings.TrimSpace(builder.String())
+		if chunkTokens >= config.MinChunkSize && chunkText != "" {
+			chunk := newChunk(chunkText, offsets[start], offsets[end], len(chunks))
+			chunk.Metadata["token_count"] = chunkTokens
+			chunks = append(chunks, chunk)
+		}
+
+		if end >= len(pieces) {
+			break
+		}
+
+		// Следующий чанк начинается на OverlapSize токенов раньше конца текущего
+		next := end
+		overlap := 0
+		for next > start+1 && overlap+pieces[next-1].Tokens <= config.OverlapSize {
+			next--
+			overlap += pieces[next].Tokens
+		}
+		start = next
+	}
+
+	return chunks
+}
+
+func isBreakPiece(text string) bool {
+	trimmed := strings.TrimRight(text, " ")
+	return strings.HasSuffix(trimmed, "\n") ||
+		strings.HasSuffix(trimmed, ".") ||
+		strings.HasSuffix(trimmed, "!") ||
+		strings.HasSuffix(trimmed, "?")
+}
@@ -32,3 +32,32 @@ func (s *Service) CreateCollection(ctx context.Context, options *qdrant.CreateCo
 
 	return nil
 }
+
+// collectionSchema описывает векторы коллекции агента
+type collectionSchema struct {
+	// Dimensions — размерность плотных векторов модели эмбеддингов
+	Dimensions int
+	// Keywords сообщает, хранит ли коллекция разреженные векторы ключевых слов.
+	// Коллекции, созданные до появления гибридного поиска, их не содержат.
+	Keywords bool
+}
+
+func (s *Service) getCollectionSchema(ctx context.Context, collectionName string) (*collectionSchema, *utils.UserErrorResponse) {
+	info, err := s.qdrant.Client.GetCollectionInfo(ctx, collectionName)
+	if err != nil {
+		s.logger.Errorf("получение информации о коллекции %s: %v", collectionName, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	params := info.GetConfig().GetParams()
+	_, keywords := params.GetSparseVectorsConfig().GetMap()[keywordVectorName]
+
+	return &collectionSchema{
+		Dimensions: int(params.GetVectorsConfig().GetParams().GetSize()),
+		Keywords:   keywords,
+	}, nil
+}
@@ -1 +1,172 @@
 package knowledge
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/qdrant/go-client/qdrant"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+type DeleteKnowledgeRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+}
+
+type DeleteKnowledgeFileRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+	FileID  string `json:"file_id" validate:"required,uuid"`
+}
+
+type DeleteKnowledgePromptRequest struct {
+	AgentID  string `json:"agent_id" validate:"required,uuid"`
+	PromptID string `json:"prompt_id" validate:"required,uuid"`
+}
+
+// DeleteKnowledge удаляет всю базу знаний агента: коллекцию Qdrant, файлы, источники и промпты
+func (s *Service) DeleteKnowledge(request *DeleteKnowledgeRequest) *utils.UserErrorResponse {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	if _, errorResponse := agent.NewService().GetAgent(agentUUID, s.postgres); errorResponse != nil {
+		return errorResponse
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exists, err := s.qdrant.Client.CollectionExists(ctx, agentUUID.String())
+	if err == nil && exists {
+		err = s.qdrant.Client.DeleteCollection(ctx, agentUUID.String())
+	}
+	if err != nil {
+		s.logger.Errorf("удаление коллекции агента %s: %v", agentUUID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	err = s.postgres.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("agent_id = ?", agentUUID).Delete(&models.KnowledgeFile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("agent_id = ?", agentUUID).Delete(&models.KnowledgeJob{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("agent_id = ?", agentUUID).Delete(&models.KnowledgeSource{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("agent_id = ?", agentUUID).Delete(&models.KnowledgePrompt{}).Error
+	})
+
+	if err != nil {
+		s.logger.Errorf("удаление базы знаний агента %s: %v", agentUUID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления базы знаний",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	s.logger.Infof("удалена база знаний агента %s", agentUUID)
+	return nil
+}
+
+// DeleteKnowledgeFile удаляет файл и ровно его чанки по фильтру file_id
+func (s *Service) DeleteKnowledgeFile(request *DeleteKnowledgeFileRequest) *utils.UserErrorResponse {
+	knowledgeFile, errorResponse := s.getKnowledgeFile(request.AgentID, request.FileID)
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	return s.removeKnowledgeFile(knowledgeFile)
+}
+
+// removeKnowledgeFile удаляет чанки файла из коллекции, затем сам файл и его задачи
+func (s *Service) removeKnowledgeFile(knowledgeFile *models.KnowledgeFile) *utils.UserErrorResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if errorResponse := s.deleteFilePoints(ctx, knowledgeFile); errorResponse != nil {
+		return errorResponse
+	}
+
+	err := s.postgres.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", knowledgeFile.ID).Delete(&models.KnowledgeJob{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(knowledgeFile).Error
+	})
+
+	if err != nil {
+		s.logger.Errorf("удаление файла %s: %v", knowledgeFile.ID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления файла",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	s.logger.Infof("удален файл %s агента %s", knowledgeFile.ID, knowledgeFile.AgentID)
+	return nil
+}
+
+// DeleteKnowledgePrompt удаляет промпт базы знаний
+func (s *Service) DeleteKnowledgePrompt(request *DeleteKnowledgePromptRequest) *utils.UserErrorResponse {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+	promptUUID, _ := uuid.Parse(request.PromptID)
+
+	result := s.postgres.DB.
+		Where("id = ? AND agent_id = ?", promptUUID, agentUUID).
+		Delete(&models.KnowledgePrompt{})
+
+	if result.Error != nil {
+		s.logger.Errorf("удаление промпта %s: %v", promptUUID, result.Error)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления промпта",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	if result.RowsAffected == 0 {
+		return utils.NewUserErrorResponse(
+			404,
+			"Промпт не найден",
+			"Указанный промпт не существует или был удален.",
+		)
+	}
+
+	return nil
+}
+
+// deleteFilePoints удаляет из коллекции агента все точки файла
+func (s *Service) deleteFilePoints(ctx context.Context, knowledgeFile *models.KnowledgeFile) *utils.UserErrorResponse {
+	exists, err := s.qdrant.Client.CollectionExists(ctx, knowledgeFile.CollectionName)
+	if err == nil && !exists {
+		return nil
+	}
+
+	if err == nil {
+		wait := true
+		_, err = s.qdrant.Client.Delete(ctx, &qdrant.DeletePoints{
+			CollectionName: knowledgeFile.CollectionName,
+			Wait:           &wait,
+			Points:         qdrant.NewPointsSelectorFilter(fileFilter(knowledgeFile.ID)),
+		})
+	}
+
+	if err != nil {
+		s.logger.Errorf("удаление чанков файла %s из Qdrant: %v", knowledgeFile.ID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления чанков файла",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"github.com/openai/openai-go"
+	"macdent-ai-chatbot/internal/models"
+	openaiService "macdent-ai-chatbot/internal/services/openai"
+	"macdent-ai-chatbot/internal/utils"
+	"strings"
+)
+
+// Embedder создает векторные представления текстов для базы знаний агента
+type Embedder interface {
+	// Model возвращает название модели эмбеддингов
+	Model() string
+	// Dimensions возвращает размерность векторов модели
+	Dimensions(ctx context.Context) (int, error)
+	// Embed возвращает векторы в порядке текстов и количество затраченных токенов
+	Embed(ctx context.Context, texts []string) ([][]float32, int, error)
+}
+
+// openaiEmbeddingDimensions содержит размерности известных моделей OpenAI
+var openaiEmbeddingDimensions = map[string]int{
+	openai.EmbeddingModelTextEmbedding3Large: 3072,
+	openai.EmbeddingModelTextEmbedding3Small: 1536,
+	openai.EmbeddingModelTextEmbeddingAda002: 1536,
+}
+
+// NewEmbedder создает поставщика эмбеддингов по настройкам агента
+func NewEmbedder(agent *models.Agent) (Embedder, *utils.UserErrorResponse) {
+	model := agent.EmbeddingModel
+	if model == "" {
+		model = models.DefaultEmbeddingModel
+	}
+
+	switch agent.EmbeddingProvider {
+	case "", models.EmbeddingProviderOpenAI:
+		return newOpenAIEmbedder(openaiService.NewService(agent.APIKey), model, agent.EmbeddingDimensions), nil
+	case models.EmbeddingProviderHTTP:
+		if agent.EmbeddingBaseURL == "" {
+			return nil, utils.NewUserErrorResponse(
+				400,
+				"Не настроен сервер эмбеддингов",
+				"Укажите embedding_base_url в настройках агента",
+			)
+		}
+		return NewHTTPEmbedder(agent.EmbeddingBaseURL, agent.EmbeddingAPIKey, model, agent.EmbeddingDimensions), nil
+	case models.EmbeddingProviderHash:
+		return NewHashEmbedder(agent.EmbeddingDimensions), nil
+	default:
+		return nil, utils.NewUserErrorResponse(
+			400,
+			"Неизвестный поставщик эмбеддингов",
+			"Поддерживаются поставщики openai, http и hash",
+		)
+	}
+}
+
+// openaiEmbedder создает эмбеддинги через OpenAI API
+type openaiEmbedder struct {
+	service    *openaiService.Service
+	model      string
+	dimensions int
+	// shortened сообщает, что размерность задана агентом и передается в API
+	shortened bool
+}
+
+func newOpenAIEmbedder(service *openaiService.Service, model string, dimensions int) *openaiEmbedder {
+	embedder := &openaiEmbedder{
+		service:    service,
+		model:      model,
+		dimensions: openaiEmbeddingDimensions[model],
+	}
+
+	// Сокращать векторы умеют только модели text-embedding-3
+	if dimensions > 0 && strings.HasPrefix(model, "text-embedding-3") {
+		embedder.dimensions = dimensions
+		embedder.shortened = true
+	}
+
+	return embedder
+}
+
+func (e *openaiEmbedder) Model() string {
+	return e.model
+}
+
+func (e *openaiEmbedder) Dimensions(ctx context.Context) (int, error) {
+	if e.dimensions == 0 {
+		dimensions, err := probeDimensions(ctx, e)
+		if err != nil {
+			return 0, err
+		}
+		e.dimensions = dimensions
+	}
+
+	return e.dimensions, nil
+}
+
+func (e *openaiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, int, error) {
+	params := openai.EmbeddingNewParams{
+		Model: openai.String(e.model),
+		Input: openai.F[openai.EmbeddingNewParamsInputUnion](
+			openai.EmbeddingNewParamsInputArrayOfStrings(texts),
+		),
+		EncodingFormat: openai.F(openai.EmbeddingNewParamsEncodingFormatFloat),
+	}
+	if e.shortened {
+		params.Dimensions = openai.Int(int64(e.dimensions))
+	}
+
+	response, err := e.service.Client.Embeddings.New(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vectors := make([][]float32, len(response.Data))
+	for _, embedding := range response.Data {
+		if embedding.Index < 0 || int(embedding.Index) >= len(vectors) {
+			return nil, 0, errors.New("индекс эмбеддинга вне диапазона")
+		}
+		vectors[embedding.Index] = toFloat32Vector(embedding.Embedding)
+	}
+
+	return vectors, int(response.Usage.TotalTokens), nil
+}
+
+// probeDimensions определяет размерность неизвестной модели по эмбеддингу короткого текста
+func probeDimensions(ctx context.Context, embedder Embedder) (int, error) {
+	vectors, _, err := embedder.Embed(ctx, []string{"probe"})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return 0, errors.New("модель вернула пустой эмбеддинг")
+	}
+
+	return len(vectors[0]), nil
+}
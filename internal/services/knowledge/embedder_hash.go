@@ -0,0 +1,96 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// defaultHashDimensions используется, если размерность hash эмбеддингов не задана
+const defaultHashDimensions = 256
+
+// HashEmbedder строит детерминированные векторы хешированием слов и их триграмм.
+// Внешние сервисы не нужны, поэтому он подходит для тестов и работы без сети.
+// Близкими считаются тексты с общими словами, смысловой близости модель не понимает.
+type HashEmbedder struct {
+	dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = defaultHashDimensions
+	}
+
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+func (e *HashEmbedder) Model() string {
+	return fmt.Sprintf("hash-%d", e.dimensions)
+}
+
+func (e *HashEmbedder) Dimensions(_ context.Context) (int, error) {
+	return e.dimensions, nil
+}
+
+func (e *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, int, error) {
+	vectors := make([][]float32, len(texts))
+	tokens := 0
+
+	for i, text := range texts {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		tokens += len(words)
+		vectors[i] = e.embed(words)
+	}
+
+	return vectors, tokens, nil
+}
+
+func (e *HashEmbedder) embed(words []string) []float32 {
+	vector := make([]float32, e.dimensions)
+
+	for _, word := range words {
+		e.add(vector, "w:"+word, 1)
+
+		// Триграммы сближают разные формы одного слова
+		runes := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			e.add(vector, "t:"+string(runes[i:i+3]), 0.5)
+		}
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		// Нулевой вектор не подходит для косинусного расстояния
+		vector[0] = 1
+		return vector
+	}
+
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+
+	return vector
+}
+
+// add прибавляет вес признака к ячейке вектора. Знак берется из хеша, чтобы коллизии взаимно гасились.
+func (e *HashEmbedder) add(vector []float32, feature string, weight float32) {
+	hash := fnv.New64a()
+	hash.Write([]byte(feature))
+	sum := hash.Sum64()
+
+	index := int(sum % uint64(e.dimensions))
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+
+	vector[index] += weight
+}
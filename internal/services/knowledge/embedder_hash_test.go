@@ -0,0 +1,125 @@
+package knowledge
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"macdent-ai-chatbot/internal/models"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHashEmbedderDeterministic(t *testing.T) {
+	embedder := NewHashEmbedder(64)
+	texts := []string{"Чистка зубов стоит 5000 тенге", ""}
+
+	first, tokens, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	second, _, _ := NewHashEmbedder(64).Embed(context.Background(), texts)
+
+	if tokens != 5 {
+		t.Errorf("токенов %d, ожидалось 5", tokens)
+	}
+
+	for i := range texts {
+		if len(first[i]) != 64 {
+			t.Errorf("размерность вектора %d: %d, ожидалась 64", i, len(first[i]))
+		}
+		if !slices.Equal(first[i], second[i]) {
+			t.Errorf("вектор %d отличается при повторном вызове", i)
+		}
+		if norm := vectorNorm(first[i]); math.Abs(norm-1) > 1e-5 {
+			t.Errorf("норма вектора %d: %f, ожидалась 1", i, norm)
+		}
+	}
+}
+
+func TestHashEmbedderDimensions(t *testing.T) {
+	tests := []struct {
+		dimensions int
+		want       int
+	}{
+		{dimensions: 0, want: defaultHashDimensions},
+		{dimensions: -1, want: defaultHashDimensions},
+		{dimensions: 32, want: 32},
+	}
+
+	for _, test := range tests {
+		embedder := NewHashEmbedder(test.dimensions)
+
+		dimensions, err := embedder.Dimensions(context.Background())
+		if err != nil || dimensions != test.want {
+			t.Errorf("Dimensions(%d) = %d, %v, ожидалось %d", test.dimensions, dimensions, err, test.want)
+		}
+
+		vectors, _, _ := embedder.Embed(context.Background(), []string{"имплант"})
+		if len(vectors[0]) != test.want {
+			t.Errorf("длина вектора при %d: %d, ожидалась %d", test.dimensions, len(vectors[0]), test.want)
+		}
+	}
+}
+
+// Разбиение текста на чанки и создание эмбеддингов без внешних сервисов:
+// запрос должен оказаться ближе всего к чанку с теми же словами
+func TestChunkAndEmbedOffline(t *testing.T) {
+	service := NewService(nil, nil)
+	content := strings.Join([]string{
+		"# Гигиена",
+		"Профессиональная чистка зубов стоит 5000 тенге и занимает час.",
+		"# Имплантация",
+		"Установка импланта стоит 150000 тенге, гарантия пять лет.",
+		"# Ортодонтия",
+		"Брекеты подбираются после консультации ортодонта.",
+	}, "\n\n")
+
+	config := NewChunkingConfig(models.ChunkingStrategyStructure, 80, 0)
+	chunks, errorResponse := service.CreateContentChunks(content, uuid.New(), config)
+	if errorResponse != nil {
+		t.Fatalf("разбиение на чанки: %s", errorResponse.Details)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("чанков %d, ожидалось не меньше 3", len(chunks))
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	embedder := NewHashEmbedder(256)
+	vectors, _, errorResponse := service.createEmbeddings(embedder, texts)
+	if errorResponse != nil {
+		t.Fatalf("создание эмбеддингов: %s", errorResponse.Details)
+	}
+	if len(vectors) != len(chunks) {
+		t.Fatalf("эмбеддингов %d, ожидалось %d", len(vectors), len(chunks))
+	}
+
+	query, _, _ := embedder.Embed(context.Background(), []string{"сколько стоит установка импланта"})
+
+	best := 0
+	for i := range vectors {
+		if dot(query[0], vectors[i]) > dot(query[0], vectors[best]) {
+			best = i
+		}
+	}
+
+	if !strings.Contains(chunks[best].Text, "импланта") {
+		t.Errorf("ближайший чанк %q, ожидался чанк об имплантации", chunks[best].Text)
+	}
+}
+
+func vectorNorm(vector []float32) float64 {
+	return math.Sqrt(dot(vector, vector))
+}
+
+func dot(a []float32, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,141 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpEmbedderTimeout ограничивает один запрос к серверу эмбеддингов
+const httpEmbedderTimeout = 120 * time.Second
+
+// HTTPEmbedder создает эмбеддинги через OpenAI-совместимый эндпоинт POST /embeddings,
+// который поддерживают локальные серверы, например Ollama и text-embeddings-inference
+type HTTPEmbedder struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	dimensions int
+	httpClient *http.Client
+}
+
+type httpEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type httpEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// NewHTTPEmbedder создает клиент сервера эмбеддингов. baseURL указывается без /embeddings,
+// например http://localhost:11434/v1. Если dimensions равно 0, размерность определяется запросом к модели.
+func NewHTTPEmbedder(baseURL string, apiKey string, model string, dimensions int) *HTTPEmbedder {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &HTTPEmbedder{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		dimensions: dimensions,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   httpEmbedderTimeout,
+		},
+	}
+}
+
+func (e *HTTPEmbedder) Model() string {
+	return e.model
+}
+
+func (e *HTTPEmbedder) Dimensions(ctx context.Context) (int, error) {
+	if e.dimensions == 0 {
+		dimensions, err := probeDimensions(ctx, e)
+		if err != nil {
+			return 0, err
+		}
+		e.dimensions = dimensions
+	}
+
+	return e.dimensions, nil
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, int, error) {
+	body, err := json.Marshal(httpEmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 256<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("сервер эмбеддингов вернул статус %d: %s", resp.StatusCode, truncateBody(data))
+	}
+
+	var response httpEmbeddingResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, 0, fmt.Errorf("разбор ответа сервера эмбеддингов: %w", err)
+	}
+
+	vectors := make([][]float32, len(response.Data))
+	for _, embedding := range response.Data {
+		if embedding.Index < 0 || embedding.Index >= len(vectors) {
+			return nil, 0, errors.New("индекс эмбеддинга вне диапазона")
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+
+	return vectors, response.Usage.TotalTokens, nil
+}
+
+func truncateBody(data []byte) string {
+	if len(data) > 500 {
+		return string(data[:500]) + "..."
+	}
+	return string(data)
+}
@@ -3,9 +3,6 @@ package knowledge
 import (
 	"context"
 	"github.com/google/uuid"
-	"github.com/openai/openai-go"
-	"github.com/qdrant/go-client/qdrant"
-	openaiService "macdent-ai-chatbot/internal/services/openai"
 	"macdent-ai-chatbot/internal/utils"
 	"strings"
 	"time"
@@ -20,7 +17,8 @@ type EmbeddingResult struct {
 
 const embeddingsBatchSize = 50
 
-func (s *Service) PrepareContent(openaiService *openaiService.Service, content string, agentID uuid.UUID) ([]EmbeddingResult, *utils.UserErrorResponse) {
+// CreateContentChunks проверяет текст и разбивает его на чанки по стратегии config, отбрасывая пустые и невалидные
+func (s *Service) CreateContentChunks(content string, agentID uuid.UUID, config *ChunkingConfig) ([]Chunk, *utils.UserErrorResponse) {
 	if strings.TrimSpace(content) == "" {
 		return nil, utils.NewUserErrorResponse(400, "Пустой контент", "Контент не может быть пустым")
 	}
@@ -30,14 +28,13 @@ func (s *Service) PrepareContent(openaiService *openaiService.Service, content s
 		return nil, utils.NewUserErrorResponse(400, "Невалидный контент", "Контент содержит недопустимые символы")
 	}
 
-	config := NewDefaultChunkingConfig()
 	chunks := s.CreateChunks(content, config)
 
 	if len(chunks) == 0 {
 		return nil, utils.NewUserErrorResponse(400, "Не удалось создать чанки", "Проверьте корректность контента")
 	}
 
-	s.logger.Infof("создано %d чанков для агента %s", len(chunks), agentID.String())
+	s.logger.Infof("создано %d чанков для агента %s (стратегия %s)", len(chunks), agentID.String(), config.Strategy)
 
 	validChunks := make([]Chunk, 0, len(chunks))
 	for i, chunk := range chunks {
@@ -56,23 +53,37 @@ func (s *Service) PrepareContent(openaiService *openaiService.Service, content s
 		return nil, utils.NewUserErrorResponse(400, "Нет валидных чанков", "Все чанки содержат ошибки")
 	}
 
+	return validChunks, nil
+}
+
+// EmbedChunks создает эмбеддинги чанков пакетами. progress, если задан, вызывается после каждого пакета
+// с количеством обработанных и всех чанков.
+func (s *Service) EmbedChunks(
+	embedder Embedder,
+	chunks []Chunk,
+	agentID uuid.UUID,
+	progress func(processed int, total int),
+) ([]EmbeddingResult, *utils.UserErrorResponse) {
 	var results []EmbeddingResult
 
-	for i := 0; i < len(validChunks); i += embeddingsBatchSize {
+	for i := 0; i < len(chunks); i += embeddingsBatchSize {
 		end := i + embeddingsBatchSize
-		if end > len(validChunks) {
-			end = len(validChunks)
+		if end > len(chunks) {
+			end = len(chunks)
 		}
 
-		batch := validChunks[i:end]
-		batchResults, err := s.processChunkBatch(openaiService, batch, agentID)
+		batch := chunks[i:end]
+		batchResults, err := s.processChunkBatch(embedder, batch, agentID)
 		if err != nil {
 			return nil, err
 		}
 
 		results = append(results, batchResults...)
+		if progress != nil {
+			progress(end, len(chunks))
+		}
 
-		if i+embeddingsBatchSize < len(validChunks) {
+		if i+embeddingsBatchSize < len(chunks) {
 			time.Sleep(100 * time.Millisecond)
 		}
 	}
@@ -80,79 +91,112 @@ func (s *Service) PrepareContent(openaiService *openaiService.Service, content s
 	return results, nil
 }
 
-func (s *Service) UpsertChunks(ctx context.Context, agentID uuid.UUID, results []EmbeddingResult) *utils.UserErrorResponse {
-	if len(results) == 0 {
-		return nil
-	}
-
-	points := make([]*qdrant.PointStruct, len(results))
-	for i, result := range results {
-		points[i] = &qdrant.PointStruct{
-			Id:      qdrant.NewID(uuid.NewString()),
-			Vectors: qdrant.NewVectors(result.Vector...),
-			Payload: qdrant.NewValueMap(map[string]any{
-				"text":        result.Chunk.Text,
-				"chunk_index": int64(result.Chunk.Metadata["chunk_index"].(int)),
-				"char_count":  int64(result.Chunk.Metadata["char_count"].(int)),
-				"word_count":  int64(result.Chunk.Metadata["word_count"].(int)),
-				"start_idx":   int64(result.Chunk.StartIdx),
-				"end_idx":     int64(result.Chunk.EndIdx),
-				"agent_id":    agentID.String(),
-				"created_at":  time.Now().Format(time.RFC3339),
-			}),
-		}
+// processChunkBatch создает эмбеддинги пакета чанков. Эмбеддинги текстов, которые эта модель
+// уже обрабатывала, берутся из кеша, а к модели отправляются только новые тексты.
+func (s *Service) processChunkBatch(embedder Embedder, chunks []Chunk, agentID uuid.UUID) ([]EmbeddingResult, *utils.UserErrorResponse) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dimensions, err := embedder.Dimensions(ctx)
+	if err != nil {
+		s.logger.Errorf("определение размерности модели %s: %v", embedder.Model(), err)
+		return nil, utils.NewUserErrorResponse(500, "Ошибка создания эмбеддингов", "Попробуйте позже")
 	}
 
-	return s.UpsertPoints(ctx, agentID, points)
-}
+	hashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		hashes[i] = hashText(chunk.Text)
+	}
 
-func (s *Service) processChunkBatch(openaiService *openaiService.Service, chunks []Chunk, agentID uuid.UUID) ([]EmbeddingResult, *utils.UserErrorResponse) {
-	texts := make([]string, len(chunks))
+	cacheKey := newEmbeddingCacheKey(embedder, dimensions)
+	vectors := s.loadCachedEmbeddings(ctx, cacheKey, hashes)
+	if vectors == nil {
+		vectors = make(map[string][]float32)
+	}
+	cachedCount := len(vectors)
+
+	var texts []string
+	var textHashes []string
 	for i, chunk := range chunks {
-		texts[i] = chunk.Text
+		if _, ok := vectors[hashes[i]]; ok {
+			continue
+		}
+
+		texts = append(texts, chunk.Text)
+		textHashes = append(textHashes, hashes[i])
+		// Одинаковые тексты внутри пакета отправляются один раз
+		vectors[hashes[i]] = nil
+
 		s.logger.Infof("обработка чанка %d (%d символов): %s",
 			chunk.Metadata["chunk_index"],
 			len([]rune(chunk.Text)),
 			s.truncateForLog(chunk.Text, 100))
 	}
 
+	tokenUsage := 0
+	createdVectors := make(map[string][]float32, len(texts))
+	if len(texts) > 0 {
+		created, tokens, errorResponse := s.createEmbeddings(embedder, texts)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		tokenUsage = tokens / len(texts)
+		for i, vector := range created {
+			vectors[textHashes[i]] = vector
+			createdVectors[textHashes[i]] = vector
+		}
+
+		s.saveCachedEmbeddings(ctx, cacheKey, createdVectors)
+	}
+
+	results := make([]EmbeddingResult, len(chunks))
+	for i, chunk := range chunks {
+		results[i] = EmbeddingResult{
+			Chunk:  chunk,
+			Vector: vectors[hashes[i]],
+		}
+		if _, ok := createdVectors[hashes[i]]; ok {
+			results[i].TokenUsage = tokenUsage
+		}
+	}
+
+	s.logger.Infof("эмбеддинги для агента %s: %d из кеша, %d создано", agentID.String(), cachedCount, len(texts))
+	return results, nil
+}
+
+// createEmbeddings создает эмбеддинги текстов и проверяет, что на каждый текст получен непустой вектор
+func (s *Service) createEmbeddings(embedder Embedder, texts []string) ([][]float32, int, *utils.UserErrorResponse) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	response, err := openaiService.Client.Embeddings.New(ctx, openai.EmbeddingNewParams{
-		Model: openai.String(openai.EmbeddingModelTextEmbedding3Large),
-		Input: openai.F[openai.EmbeddingNewParamsInputUnion](
-			openai.EmbeddingNewParamsInputArrayOfStrings(texts),
-		),
-		EncodingFormat: openai.F(openai.EmbeddingNewParamsEncodingFormatFloat),
-	})
-
+	vectors, tokens, err := embedder.Embed(ctx, texts)
 	if err != nil {
-		s.logger.Errorf("создания эмбеддингов: %v", err)
-		return nil, utils.NewUserErrorResponse(500, "Ошибка создания эмбеддингов", "Попробуйте позже")
+		s.logger.Errorf("создания эмбеддингов моделью %s: %v", embedder.Model(), err)
+		return nil, 0, utils.NewUserErrorResponse(500, "Ошибка создания эмбеддингов", "Попробуйте позже")
 	}
 
-	if len(response.Data) != len(chunks) {
-		s.logger.Errorf("несоответствие количества эмбеддингов: ожидалось %d, получено %d", len(chunks), len(response.Data))
-		return nil, utils.NewUserErrorResponse(500, "Ошибка обработки эмбеддингов", "Внутренняя ошибка")
+	if len(vectors) != len(texts) {
+		s.logger.Errorf("несоответствие количества эмбеддингов: ожидалось %d, получено %d", len(texts), len(vectors))
+		return nil, 0, utils.NewUserErrorResponse(500, "Ошибка обработки эмбеддингов", "Внутренняя ошибка")
 	}
 
-	results := make([]EmbeddingResult, len(chunks))
-	for i, embedding := range response.Data {
-		vector := make([]float32, len(embedding.Embedding))
-		for j, v := range embedding.Embedding {
-			vector[j] = float32(v)
-		}
-
-		results[i] = EmbeddingResult{
-			Chunk:      chunks[i],
-			Vector:     vector,
-			TokenUsage: int(response.Usage.TotalTokens) / len(response.Data),
+	for _, vector := range vectors {
+		if len(vector) == 0 {
+			s.logger.Errorf("модель %s вернула пустой эмбеддинг", embedder.Model())
+			return nil, 0, utils.NewUserErrorResponse(500, "Ошибка обработки эмбеддингов", "Внутренняя ошибка")
 		}
 	}
 
-	s.logger.Infof("успешно создано %d эмбеддингов для агента %s", len(results), agentID.String())
-	return results, nil
+	return vectors, tokens, nil
+}
+
+func toFloat32Vector(embedding []float64) []float32 {
+	vector := make([]float32, len(embedding))
+	for i, v := range embedding {
+		vector[i] = float32(v)
+	}
+	return vector
 }
 
 func (s *Service) truncateForLog(text string, maxLen int) string {
@@ -0,0 +1,125 @@
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+	"macdent-ai-chatbot/internal/models"
+	"math"
+)
+
+// chunkPointNamespace — пространство имен детерминированных идентификаторов точек Qdrant
+var chunkPointNamespace = uuid.MustParse("6f1c9d2e-8b4a-4f37-9a5e-2c7d0b3e1a64")
+
+// hashText возвращает SHA-256 текста в шестнадцатеричном виде
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkPointID строит идентификатор точки из агента, файла и хеша текста чанка.
+// Неизменившийся чанк при повторной загрузке файла получает тот же идентификатор.
+func chunkPointID(agentID uuid.UUID, fileID uuid.UUID, textHash string) string {
+	return uuid.NewSHA1(chunkPointNamespace, []byte(agentID.String()+"/"+fileID.String()+"/"+textHash)).String()
+}
+
+// openaiBaseURL — адрес OpenAI API, через который работает поставщик openai
+const openaiBaseURL = "https://api.openai.com/v1/"
+
+// embeddingCacheKey определяет, какие эмбеддинги взаимозаменяемы. Одна и та же модель у разных
+// поставщиков или серверов может возвращать разные векторы, поэтому они учитываются в ключе.
+type embeddingCacheKey struct {
+	Provider   string
+	BaseURL    string
+	Model      string
+	Dimensions int
+}
+
+func newEmbeddingCacheKey(embedder Embedder, dimensions int) embeddingCacheKey {
+	key := embeddingCacheKey{Model: embedder.Model(), Dimensions: dimensions}
+
+	switch embedder := embedder.(type) {
+	case *openaiEmbedder:
+		key.Provider, key.BaseURL = models.EmbeddingProviderOpenAI, openaiBaseURL
+	case *HTTPEmbedder:
+		key.Provider, key.BaseURL = models.EmbeddingProviderHTTP, embedder.baseURL
+	case *HashEmbedder:
+		key.Provider = models.EmbeddingProviderHash
+	default:
+		key.Provider = fmt.Sprintf("%T", embedder)
+	}
+
+	return key
+}
+
+// loadCachedEmbeddings возвращает сохраненные эмбеддинги текстов по их хешам
+func (s *Service) loadCachedEmbeddings(ctx context.Context, key embeddingCacheKey, hashes []string) map[string][]float32 {
+	var entries []models.EmbeddingCache
+
+	err := s.postgres.DB.WithContext(ctx).
+		Where("provider = ? AND base_url = ? AND model = ? AND dimensions = ? AND text_hash IN ?",
+			key.Provider, key.BaseURL, key.Model, key.Dimensions, hashes).
+		Find(&entries).Error
+
+	if err != nil {
+		// Без кеша эмбеддинги просто создаются заново
+		s.logger.Warnf("чтение кеша эмбеддингов: %v", err)
+		return nil
+	}
+
+	vectors := make(map[string][]float32, len(entries))
+	for _, entry := range entries {
+		if vector := decodeVector(entry.Vector); len(vector) == key.Dimensions {
+			vectors[entry.TextHash] = vector
+		}
+	}
+
+	return vectors
+}
+
+// saveCachedEmbeddings сохраняет созданные эмбеддинги, не перезаписывая уже сохраненные
+func (s *Service) saveCachedEmbeddings(ctx context.Context, key embeddingCacheKey, vectors map[string][]float32) {
+	if len(vectors) == 0 {
+		return
+	}
+
+	entries := make([]models.EmbeddingCache, 0, len(vectors))
+	for hash, vector := range vectors {
+		entries = append(entries, models.EmbeddingCache{
+			Provider:   key.Provider,
+			BaseURL:    key.BaseURL,
+			Model:      key.Model,
+			Dimensions: key.Dimensions,
+			TextHash:   hash,
+			Vector:     encodeVector(vector),
+		})
+	}
+
+	err := s.postgres.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entries).Error
+
+	if err != nil {
+		s.logger.Warnf("запись кеша эмбеддингов: %v", err)
+	}
+}
+
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,48 @@
+package knowledge
+
+import (
+	"macdent-ai-chatbot/internal/models"
+	"testing"
+)
+
+// Одна модель на разных поставщиках и серверах не должна делить записи кеша
+func TestEmbeddingCacheKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		embedder Embedder
+		want     embeddingCacheKey
+	}{
+		{
+			name:     "openai",
+			embedder: newOpenAIEmbedder(nil, "text-embedding-3-small", 512),
+			want:     embeddingCacheKey{models.EmbeddingProviderOpenAI, openaiBaseURL, "text-embedding-3-small", 512},
+		},
+		{
+			name:     "http сервер",
+			embedder: NewHTTPEmbedder("http://ollama:11434/v1/", "", "text-embedding-3-small", 512),
+			want:     embeddingCacheKey{models.EmbeddingProviderHTTP, "http://ollama:11434/v1", "text-embedding-3-small", 512},
+		},
+		{
+			name:     "hash",
+			embedder: NewHashEmbedder(512),
+			want:     embeddingCacheKey{models.EmbeddingProviderHash, "", NewHashEmbedder(512).Model(), 512},
+		},
+	}
+
+	keys := make(map[embeddingCacheKey]string)
+	for _, test := range tests {
+		got := newEmbeddingCacheKey(test.embedder, 512)
+		if got != test.want {
+			t.Errorf("%s: ключ %+v, ожидался %+v", test.name, got, test.want)
+		}
+		if other, ok := keys[got]; ok {
+			t.Errorf("%s и %s используют один ключ кеша", test.name, other)
+		}
+		keys[got] = test.name
+	}
+
+	other := newEmbeddingCacheKey(NewHTTPEmbedder("http://tei:8080/v1/", "", "text-embedding-3-small", 512), 512)
+	if _, ok := keys[other]; ok {
+		t.Error("разные серверы http используют один ключ кеша")
+	}
+}
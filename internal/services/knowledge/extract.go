@@ -0,0 +1,151 @@
+package knowledge
+
+import (
+	"github.com/gabriel-vasile/mimetype"
+	"macdent-ai-chatbot/internal/utils"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MIME типы документов, из которых извлекается текст базы знаний
+const (
+	MIMEPlain    = "text/plain"
+	MIMEMarkdown = "text/markdown"
+	MIMEHTML     = "text/html"
+	MIMECSV      = "text/csv"
+	MIMEPDF      = "application/pdf"
+	MIMEDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MIMEXLSX     = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Extractor извлекает из документа текст с сохранением структуры: заголовков, списков и строк таблиц
+type Extractor interface {
+	Extract(content []byte) (string, error)
+}
+
+// ExtractorFunc позволяет использовать функцию как Extractor
+type ExtractorFunc func(content []byte) (string, error)
+
+func (f ExtractorFunc) Extract(content []byte) (string, error) {
+	return f(content)
+}
+
+// extractors сопоставляет MIME тип документа с извлекателем текста.
+// Воркеры загрузки читают его параллельно, поэтому доступ защищен extractorsMutex.
+var extractorsMutex sync.RWMutex
+var extractors = map[string]Extractor{
+	MIMEPlain:    ExtractorFunc(extractPlainText),
+	MIMEMarkdown: ExtractorFunc(extractMarkdown),
+	MIMEHTML:     ExtractorFunc(extractHTML),
+	MIMECSV:      ExtractorFunc(extractCSV),
+	MIMEPDF:      ExtractorFunc(extractPDF),
+	MIMEDOCX:     ExtractorFunc(extractDOCX),
+	MIMEXLSX:     ExtractorFunc(extractXLSX),
+}
+
+// RegisterExtractor добавляет или заменяет извлекатель текста для MIME типа
+func RegisterExtractor(mimeType string, extractor Extractor) {
+	extractorsMutex.Lock()
+	defer extractorsMutex.Unlock()
+
+	extractors[mimeType] = extractor
+}
+
+func findExtractor(mimeType string) (Extractor, bool) {
+	extractorsMutex.RLock()
+	defer extractorsMutex.RUnlock()
+
+	extractor, ok := extractors[mimeType]
+	return extractor, ok
+}
+
+// Расширения файлов для форматов, которые нельзя отличить от простого текста по содержимому
+var textExtensions = map[string]string{
+	".md":       MIMEMarkdown,
+	".markdown": MIMEMarkdown,
+	".csv":      MIMECSV,
+	".html":     MIMEHTML,
+	".htm":      MIMEHTML,
+	".txt":      MIMEPlain,
+}
+
+// DetectMIMEType определяет формат файла по содержимому. Текстовые форматы уточняются
+// по расширению и заявленному клиентом Content-Type, так как по содержимому неотличимы.
+func DetectMIMEType(file Knowledge) string {
+	detected := baseMIMEType(mimetype.Detect(file.Content).String())
+
+	if _, ok := findExtractor(detected); ok && detected != MIMEPlain {
+		return detected
+	}
+
+	// Текст в однобайтовой кодировке может определиться как двоичные данные
+	binary := detected == "application/octet-stream"
+	if !strings.HasPrefix(detected, "text/") && !binary {
+		return detected
+	}
+
+	if mimeType, ok := textExtensions[strings.ToLower(filepath.Ext(file.Name))]; ok {
+		return mimeType
+	}
+
+	declared := baseMIMEType(file.Type)
+	if declared == "text/x-markdown" {
+		return MIMEMarkdown
+	}
+	if _, ok := findExtractor(declared); ok && strings.HasPrefix(declared, "text/") {
+		return declared
+	}
+
+	if binary {
+		return detected
+	}
+	return MIMEPlain
+}
+
+// ExtractText извлекает текст из загруженного файла в зависимости от его формата
+func (s *Service) ExtractText(file Knowledge) (string, string, *utils.UserErrorResponse) {
+	mimeType := DetectMIMEType(file)
+
+	extractor, ok := findExtractor(mimeType)
+	if !ok {
+		s.logger.Warnf("неподдерживаемый формат файла %s: %s", file.Name, mimeType)
+		return "", mimeType, utils.NewUserErrorResponse(
+			415,
+			"Неподдерживаемый формат файла",
+			"Файл "+file.Name+" имеет формат "+mimeType+". Поддерживаются PDF, DOCX, XLSX, CSV, HTML, Markdown и текстовые файлы.",
+		)
+	}
+
+	text, err := extractor.Extract(file.Content)
+	if err != nil {
+		s.logger.Errorf("извлечение текста из файла %s (%s): %v", file.Name, mimeType, err)
+		return "", mimeType, utils.NewUserErrorResponse(
+			400,
+			"Не удалось прочитать файл",
+			"Файл "+file.Name+" поврежден или имеет неверный формат.",
+		)
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", mimeType, utils.NewUserErrorResponse(
+			400,
+			"Файл не содержит текста",
+			"В файле "+file.Name+" не найден текст. Отсканированные документы не поддерживаются.",
+		)
+	}
+
+	s.logger.Infof("из файла %s (%s) извлечено %d символов", file.Name, mimeType, utf8.RuneCountInString(text))
+	return text, mimeType, nil
+}
+
+func baseMIMEType(value string) string {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	return mediaType
+}
@@ -0,0 +1,172 @@
+package knowledge
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// extractHTML извлекает видимый текст страницы: заголовки размечаются как в Markdown,
+// пункты списков начинаются с «- », а ячейки строки таблицы разделяются « | »
+func extractHTML(content []byte) (string, error) {
+	document, err := html.Parse(bytes.NewReader([]byte(decodeText(content))))
+	if err != nil {
+		return "", err
+	}
+
+	writer := &htmlTextWriter{}
+	writer.walk(document)
+
+	return joinLines(strings.Split(writer.builder.String(), "\n")), nil
+}
+
+// extractWebPage извлекает заголовок и основной текст страницы сайта: содержимое <main> или
+// единственного <article>, а если их нет — тело страницы без навигации, шапки, подвала, боковых колонок и форм
+func extractWebPage(content []byte) (string, string, error) {
+	document, err := html.Parse(bytes.NewReader([]byte(decodeText(content))))
+	if err != nil {
+		return "", "", err
+	}
+
+	title := ""
+	if node := findElements(document, atom.Title); len(node) > 0 {
+		title = elementText(node[0])
+	}
+	if title == "" {
+		if node := findElements(document, atom.H1); len(node) > 0 {
+			title = elementText(node[0])
+		}
+	}
+
+	root := document
+	if main := findElements(document, atom.Main); len(main) > 0 {
+		root = main[0]
+	} else if articles := findElements(document, atom.Article); len(articles) == 1 {
+		root = articles[0]
+	} else if body := findElements(document, atom.Body); len(body) > 0 {
+		root = body[0]
+	}
+
+	writer := &htmlTextWriter{skipChrome: true}
+	writer.walk(root)
+
+	return title, joinLines(strings.Split(writer.builder.String(), "\n")), nil
+}
+
+// findElements возвращает элементы с тегом tag в порядке документа
+func findElements(node *html.Node, tag atom.Atom) []*html.Node {
+	var found []*html.Node
+	if node.Type == html.ElementNode && node.DataAtom == tag {
+		found = append(found, node)
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		found = append(found, findElements(child, tag)...)
+	}
+	return found
+}
+
+func elementText(node *html.Node) string {
+	writer := &htmlTextWriter{}
+	writer.walkChildren(node)
+	return strings.Join(strings.Fields(writer.builder.String()), " ")
+}
+
+// htmlTextWriter собирает текст документа. skipChrome пропускает навигацию и оформление сайта.
+type htmlTextWriter struct {
+	textBuilder
+	skipChrome bool
+}
+
+func (w *htmlTextWriter) walk(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		w.writeText(node.Data)
+		return
+	case html.CommentNode, html.DoctypeNode:
+		return
+	case html.ElementNode:
+	default:
+		w.walkChildren(node)
+		return
+	}
+
+	if w.skipChrome {
+		switch node.DataAtom {
+		case atom.Nav, atom.Header, atom.Footer, atom.Aside, atom.Form, atom.Button:
+			return
+		}
+	}
+
+	switch node.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Noscript, atom.Template, atom.Svg, atom.Iframe:
+		return
+	case atom.Br:
+		w.newLine()
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.paragraph()
+		w.builder.WriteString(strings.Repeat("#", int(node.Data[1]-'0')) + " ")
+		w.walkChildren(node)
+		w.paragraph()
+	case atom.Li:
+		w.newLine()
+		w.builder.WriteString("- ")
+		w.walkChildren(node)
+		w.newLine()
+	case atom.Tr:
+		w.newLine()
+		w.builder.WriteString(formatTableRow(tableCells(node)))
+		w.newLine()
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Table, atom.Ul, atom.Ol,
+		atom.Blockquote, atom.Pre, atom.Header, atom.Footer, atom.Main, atom.Nav, atom.Dl, atom.Dt, atom.Dd:
+		w.paragraph()
+		w.walkChildren(node)
+		w.paragraph()
+	default:
+		w.walkChildren(node)
+	}
+}
+
+func (w *htmlTextWriter) walkChildren(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		w.walk(child)
+	}
+}
+
+// writeText добавляет текст, схлопывая пробелы так же, как это делает браузер
+func (w *htmlTextWriter) writeText(text string) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		if text != "" {
+			w.space()
+		}
+		return
+	}
+
+	if isHTMLSpace(text[0]) {
+		w.space()
+	}
+	w.builder.WriteString(strings.Join(words, " "))
+	if isHTMLSpace(text[len(text)-1]) {
+		w.space()
+	}
+}
+
+// tableCells возвращает текст ячеек строки таблицы
+func tableCells(row *html.Node) []string {
+	var cells []string
+	for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+		if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+			continue
+		}
+
+		writer := &htmlTextWriter{}
+		writer.walkChildren(cell)
+		cells = append(cells, strings.Join(strings.Fields(writer.builder.String()), " "))
+	}
+	return cells
+}
+
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
@@ -0,0 +1,351 @@
+package knowledge
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxArchiveEntrySize ограничивает распакованный размер части документа, чтобы архив-бомба не исчерпал память
+const maxArchiveEntrySize = 64 << 20
+
+// maxXLSXColumns — число колонок листа Excel (XFD)
+const maxXLSXColumns = 16384
+
+// extractDOCX извлекает текст документа Word. Абзацы со стилем заголовка размечаются «#»,
+// строки таблиц выводятся через « | »
+func extractDOCX(content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+
+	document, err := readArchiveEntry(archive, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+
+	var (
+		lines     []string
+		paragraph strings.Builder
+		heading   int
+		row       []string
+		cell      []string
+		depth     int // вложенность таблиц
+	)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "tbl":
+				depth++
+			case "p":
+				paragraph.Reset()
+				heading = 0
+			case "pStyle":
+				heading = headingLevel(xmlAttribute(element, "val"))
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &element); err != nil {
+					return "", err
+				}
+				paragraph.WriteString(text)
+			case "tab":
+				paragraph.WriteString(" ")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if depth > 0 {
+					if text != "" {
+						cell = append(cell, text)
+					}
+					continue
+				}
+				if heading > 0 && text != "" {
+					text = strings.Repeat("#", heading) + " " + text
+				}
+				lines = append(lines, text)
+			case "tc":
+				row = append(row, strings.Join(cell, " "))
+				cell = nil
+			case "tr":
+				lines = append(lines, formatTableRow(row))
+				row = nil
+			case "tbl":
+				depth--
+				lines = append(lines, "")
+			}
+		}
+	}
+
+	return joinLines(lines), nil
+}
+
+// headingLevel определяет уровень заголовка по стилю абзаца: Heading1, Title и т.п.
+func headingLevel(style string) int {
+	style = strings.ToLower(style)
+
+	if style == "title" {
+		return 1
+	}
+
+	for _, prefix := range []string{"heading", "заголовок"} {
+		if level, found := strings.CutPrefix(style, prefix); found {
+			number, err := strconv.Atoi(strings.TrimSpace(level))
+			if err != nil || number < 1 {
+				return 1
+			}
+			return min(number, 6)
+		}
+	}
+
+	return 0
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+// xlsxRichText хранит текст ячейки: либо целиком в t, либо по частям форматирования в r/t
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+
+	var builder strings.Builder
+	for _, run := range t.Runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Reference string       `xml:"r,attr"`
+			Type      string       `xml:"t,attr"`
+			Value     string       `xml:"v"`
+			Inline    xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// extractXLSX извлекает таблицы книги Excel. Каждый лист начинается с заголовка с его названием,
+// первая непустая строка листа считается строкой заголовков колонок
+func extractXLSX(content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+
+	var sharedStrings []string
+	if data, err := readArchiveEntry(archive, "xl/sharedStrings.xml"); err == nil {
+		var parsed xlsxSharedStrings
+		if err := xml.Unmarshal(data, &parsed); err != nil {
+			return "", err
+		}
+		for _, item := range parsed.Items {
+			sharedStrings = append(sharedStrings, item.String())
+		}
+	}
+
+	sheets, err := xlsxSheetPaths(archive)
+	if err != nil {
+		return "", err
+	}
+
+	var sections []string
+	for _, sheet := range sheets {
+		data, err := readArchiveEntry(archive, sheet.path)
+		if err != nil {
+			return "", err
+		}
+
+		var parsed xlsxSheet
+		if err := xml.Unmarshal(data, &parsed); err != nil {
+			return "", err
+		}
+
+		rows := make([][]string, 0, len(parsed.Rows))
+		for _, row := range parsed.Rows {
+			var cells []string
+			for i, cell := range row.Cells {
+				column := columnIndex(cell.Reference)
+				if column < 0 {
+					column = i
+				}
+				// Ссылка за пределами листа Excel означает поврежденный файл
+				if column >= maxXLSXColumns {
+					continue
+				}
+				for len(cells) <= column {
+					cells = append(cells, "")
+				}
+
+				switch cell.Type {
+				case "s":
+					index, err := strconv.Atoi(cell.Value)
+					if err == nil && index >= 0 && index < len(sharedStrings) {
+						cells[column] = sharedStrings[index]
+					}
+				case "inlineStr":
+					cells[column] = cell.Inline.String()
+				case "b":
+					cells[column] = map[string]string{"1": "да", "0": "нет"}[cell.Value]
+				default:
+					cells[column] = cell.Value
+				}
+			}
+			rows = append(rows, cells)
+		}
+
+		table := formatTable(rows)
+		if table == "" {
+			continue
+		}
+		sections = append(sections, "# Лист: "+sheet.name+"\n"+table)
+	}
+
+	return strings.Join(sections, "\n\n"), nil
+}
+
+type xlsxSheetPath struct {
+	name string
+	path string
+}
+
+// xlsxSheetPaths возвращает листы книги в порядке их следования вместе с путями в архиве
+func xlsxSheetPaths(archive *zip.Reader) ([]xlsxSheetPath, error) {
+	data, err := readArchiveEntry(archive, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	var workbook xlsxWorkbook
+	if err := xml.Unmarshal(data, &workbook); err != nil {
+		return nil, err
+	}
+
+	targets := map[string]string{}
+	if data, err := readArchiveEntry(archive, "xl/_rels/workbook.xml.rels"); err == nil {
+		var relationships xlsxRelationships
+		if err := xml.Unmarshal(data, &relationships); err != nil {
+			return nil, err
+		}
+		for _, relationship := range relationships.Relationships {
+			target := relationship.Target
+			if strings.HasPrefix(target, "/") {
+				target = strings.TrimPrefix(target, "/")
+			} else {
+				target = path.Join("xl", target)
+			}
+			targets[relationship.ID] = target
+		}
+	}
+
+	sheets := make([]xlsxSheetPath, 0, len(workbook.Sheets))
+	for i, sheet := range workbook.Sheets {
+		sheetPath, ok := targets[sheet.ID]
+		if !ok {
+			sheetPath = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		sheets = append(sheets, xlsxSheetPath{name: sheet.Name, path: sheetPath})
+	}
+
+	return sheets, nil
+}
+
+// columnIndex переводит ссылку на ячейку вида «AB12» в номер колонки с нуля
+func columnIndex(reference string) int {
+	index := 0
+	found := false
+
+	for _, r := range reference {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		found = true
+	}
+
+	if !found {
+		return -1
+	}
+	return index - 1
+}
+
+func readArchiveEntry(archive *zip.Reader, name string) ([]byte, error) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(io.LimitReader(reader, maxArchiveEntrySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxArchiveEntrySize {
+			return nil, fmt.Errorf("часть документа %s превышает допустимый размер", name)
+		}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("в документе отсутствует %s", name)
+}
+
+func xmlAttribute(element xml.StartElement, name string) string {
+	for _, attribute := range element.Attr {
+		if attribute.Name.Local == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,862 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Упрощенный разбор PDF: извлекается только текстовый слой страниц.
+// Поддерживаются сжатие FlateDecode, потоки объектов и шрифты с таблицей ToUnicode.
+// Отсканированные документы без текстового слоя дают пустой результат.
+
+const (
+	// maxPDFStreamSize ограничивает распакованный размер потока
+	maxPDFStreamSize = 64 << 20
+	// maxPDFFormDepth ограничивает вложенность форм, чтобы циклические ссылки не зациклили разбор
+	maxPDFFormDepth = 8
+	// pdfWordSpacing — сдвиг в TJ (в тысячных долях кегля), начиная с которого он считается пробелом
+	pdfWordSpacing = 200
+)
+
+var errPDFEncrypted = errors.New("зашифрованный PDF не поддерживается")
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[string]any
+	pdfRef     struct{ number, generation int }
+)
+
+type pdfObject struct {
+	value  any
+	stream []byte
+}
+
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	fonts   map[pdfRef]*pdfFont
+}
+
+func extractPDF(content []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, "\x00\t\n\f\r "), []byte("%PDF")) {
+		return "", errors.New("файл не является PDF документом")
+	}
+
+	if bytes.Contains(content, []byte("/Encrypt")) {
+		return "", errPDFEncrypted
+	}
+
+	document := &pdfDocument{objects: map[int]*pdfObject{}, fonts: map[pdfRef]*pdfFont{}}
+	document.parseObjects(content)
+	document.expandObjectStreams()
+
+	var pages []string
+	for _, page := range document.pages() {
+		writer := &pdfTextWriter{document: document}
+		writer.renderPage(page)
+		if text := joinLines(strings.Split(writer.builder.String(), "\n")); text != "" {
+			pages = append(pages, text)
+		}
+	}
+
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// parseObjects находит в файле все косвенные объекты. Более поздние версии объекта
+// из инкрементальных обновлений заменяют ранние.
+func (d *pdfDocument) parseObjects(content []byte) {
+	position := 0
+	for position < len(content) {
+		match := pdfObjectHeader.FindSubmatchIndex(content[position:])
+		if match == nil {
+			return
+		}
+
+		number, _ := strconv.Atoi(string(content[position+match[2] : position+match[3]]))
+		lexer := &pdfLexer{data: content, position: position + match[1]}
+		object := &pdfObject{value: lexer.readObject()}
+		// На оборванном объекте лексер может выйти за конец файла
+		lexer.position = min(lexer.position, len(content))
+
+		if dict, ok := object.value.(pdfDict); ok {
+			lexer.skipSpace()
+			if bytes.HasPrefix(content[lexer.position:], []byte("stream")) {
+				object.stream, lexer.position = readPDFStream(content, lexer.position+len("stream"), dict)
+			}
+		}
+
+		d.objects[number] = object
+		position = max(lexer.position, position+match[1])
+	}
+}
+
+// readPDFStream возвращает данные потока, начинающиеся с start, и позицию после endstream
+func readPDFStream(content []byte, start int, dict pdfDict) ([]byte, int) {
+	if bytes.HasPrefix(content[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(content) && (content[start] == '\n' || content[start] == '\r') {
+		start++
+	}
+
+	if length, ok := dict["Length"].(float64); ok {
+		end := start + int(length)
+		if length >= 0 && end <= len(content) &&
+			bytes.HasPrefix(bytes.TrimLeft(content[end:], "\r\n "), []byte("endstream")) {
+			return content[start:end], end
+		}
+	}
+
+	end := bytes.Index(content[start:], []byte("endstream"))
+	if end < 0 {
+		return content[start:], len(content)
+	}
+
+	return bytes.TrimRight(content[start:start+end], "\r\n"), start + end
+}
+
+// expandObjectStreams извлекает объекты, упакованные в потоки объектов (ObjStm)
+func (d *pdfDocument) expandObjectStreams() {
+	numbers := make([]int, 0, len(d.objects))
+	for number := range d.objects {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		object := d.objects[number]
+		dict, ok := object.value.(pdfDict)
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+
+		data, err := d.decodeStream(object)
+		if err != nil {
+			continue
+		}
+
+		count, _ := dict["N"].(float64)
+		firstValue, _ := dict["First"].(float64)
+		first := int(firstValue)
+		if first < 0 || first > len(data) {
+			continue
+		}
+
+		header := &pdfLexer{data: data[:first]}
+		for i := 0; i < int(count); i++ {
+			objectNumber, ok1 := header.readObject().(float64)
+			offset, ok2 := header.readObject().(float64)
+			position := first + int(offset)
+			if !ok1 || !ok2 || offset < 0 || position < 0 || position >= len(data) {
+				break
+			}
+
+			// Объекты вне потоков имеют приоритет: так обычно записываются обновления
+			if _, exists := d.objects[int(objectNumber)]; exists {
+				continue
+			}
+
+			lexer := &pdfLexer{data: data, position: position}
+			d.objects[int(objectNumber)] = &pdfObject{value: lexer.readObject()}
+		}
+	}
+}
+
+func (d *pdfDocument) resolve(value any) any {
+	for range 32 {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		object, ok := d.objects[ref.number]
+		if !ok {
+			return nil
+		}
+		value = object.value
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(value any) pdfDict {
+	dict, _ := d.resolve(value).(pdfDict)
+	return dict
+}
+
+func (d *pdfDocument) object(value any) *pdfObject {
+	if ref, ok := value.(pdfRef); ok {
+		return d.objects[ref.number]
+	}
+	return nil
+}
+
+// decodeStream распаковывает поток. Потоки с неподдерживаемыми фильтрами (например, изображения) пропускаются.
+func (d *pdfDocument) decodeStream(object *pdfObject) ([]byte, error) {
+	dict, _ := object.value.(pdfDict)
+	data := object.stream
+
+	var filters []any
+	switch filter := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case pdfArray:
+		filters = filter
+	}
+
+	for _, filter := range filters {
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			decoded, err := io.ReadAll(io.LimitReader(reader, maxPDFStreamSize))
+			reader.Close()
+			// Поврежденный конец потока не мешает прочитать уже распакованный текст
+			if err != nil && len(decoded) == 0 {
+				return nil, err
+			}
+			data = decoded
+		default:
+			return nil, errors.New("неподдерживаемый фильтр потока")
+		}
+	}
+
+	return data, nil
+}
+
+// pages возвращает словари страниц в порядке документа вместе с унаследованными ресурсами
+func (d *pdfDocument) pages() []pdfDict {
+	var root pdfDict
+	for _, object := range d.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			root = d.dict(dict["Pages"])
+			break
+		}
+	}
+
+	var pages []pdfDict
+	visited := map[*pdfObject]bool{}
+
+	var walk func(node pdfDict, resources any, depth int)
+	walk = func(node pdfDict, resources any, depth int) {
+		if node == nil || depth > 64 {
+			return
+		}
+		if own, ok := node["Resources"]; ok {
+			resources = own
+		}
+
+		kids, ok := d.resolve(node["Kids"]).(pdfArray)
+		if !ok {
+			if node["Type"] == pdfName("Page") {
+				page := pdfDict{"Contents": node["Contents"], "Resources": resources}
+				pages = append(pages, page)
+			}
+			return
+		}
+
+		for _, kid := range kids {
+			if object := d.object(kid); object != nil {
+				if visited[object] {
+					continue
+				}
+				visited[object] = true
+			}
+			walk(d.dict(kid), resources, depth+1)
+		}
+	}
+	walk(root, nil, 0)
+
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// Каталог поврежден: страницы собираются в порядке номеров объектов
+	numbers := make([]int, 0, len(d.objects))
+	for number, object := range d.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		dict := d.objects[number].value.(pdfDict)
+		pages = append(pages, pdfDict{"Contents": dict["Contents"], "Resources": dict["Resources"]})
+	}
+	return pages
+}
+
+// pdfFont переводит коды символов строки в текст
+type pdfFont struct {
+	codeWidth int
+	toUnicode map[int]string
+}
+
+func (d *pdfDocument) font(value any) *pdfFont {
+	ref, cacheable := value.(pdfRef)
+	if font, ok := d.fonts[ref]; ok && cacheable {
+		return font
+	}
+
+	font := &pdfFont{codeWidth: 1}
+	dict := d.dict(value)
+	if dict["Subtype"] == pdfName("Type0") {
+		font.codeWidth = 2
+	}
+
+	if object := d.object(dict["ToUnicode"]); object != nil {
+		if data, err := d.decodeStream(object); err == nil {
+			font.parseCMap(data)
+		}
+	}
+
+	if cacheable {
+		d.fonts[ref] = font
+	}
+	return font
+}
+
+// parseCMap читает таблицу соответствия кодов символам Unicode (bfchar и bfrange)
+func (f *pdfFont) parseCMap(data []byte) {
+	f.toUnicode = map[int]string{}
+
+	lexer := &pdfLexer{data: data}
+	var operands []any
+
+	for {
+		token := lexer.readObject()
+		if token == nil {
+			return
+		}
+
+		keyword, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if code, ok := operands[0].(pdfString); ok && len(code) > 0 {
+					f.codeWidth = len(code)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				source, ok1 := operands[i].(pdfString)
+				target, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.toUnicode[bytesToCode(source)] = decodeUTF16(target)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := bytesToCode(low), bytesToCode(high)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+
+				switch target := operands[i+2].(type) {
+				case pdfString:
+					runes := utf16.Decode(utf16Units(target))
+					for code := start; code <= end && len(runes) > 0; code++ {
+						f.toUnicode[code] = string(runes)
+						runes[len(runes)-1]++
+					}
+				case pdfArray:
+					for j, item := range target {
+						if value, ok := item.(pdfString); ok && start+j <= end {
+							f.toUnicode[start+j] = decodeUTF16(value)
+						}
+					}
+				}
+			}
+		}
+
+		operands = operands[:0]
+	}
+}
+
+func (f *pdfFont) decode(value pdfString) string {
+	if len(f.toUnicode) == 0 {
+		if f.codeWidth == 2 {
+			// Составной шрифт без ToUnicode: коды глифов нельзя перевести в текст
+			return ""
+		}
+		runes := make([]rune, len(value))
+		for i, b := range value {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+
+	var builder []byte
+	for i := 0; i+f.codeWidth <= len(value); i += f.codeWidth {
+		if text, ok := f.toUnicode[bytesToCode(value[i:i+f.codeWidth])]; ok {
+			builder = append(builder, text...)
+		}
+	}
+	return string(builder)
+}
+
+func bytesToCode(value []byte) int {
+	code := 0
+	for _, b := range value {
+		code = code<<8 | int(b)
+	}
+	return code
+}
+
+func utf16Units(value []byte) []uint16 {
+	units := make([]uint16, 0, len(value)/2)
+	for i := 0; i+1 < len(value); i += 2 {
+		units = append(units, uint16(value[i])<<8|uint16(value[i+1]))
+	}
+	return units
+}
+
+func decodeUTF16(value []byte) string {
+	return string(utf16.Decode(utf16Units(value)))
+}
+
+// pdfTextWriter исполняет текстовые операторы потока содержимого страницы
+type pdfTextWriter struct {
+	textBuilder
+	document *pdfDocument
+	font     *pdfFont
+	lastY    float64
+}
+
+func (w *pdfTextWriter) renderPage(page pdfDict) {
+	var data []byte
+
+	contents := w.document.resolve(page["Contents"])
+	parts, ok := contents.(pdfArray)
+	if !ok {
+		parts = pdfArray{page["Contents"]}
+	}
+
+	for _, part := range parts {
+		object := w.document.object(part)
+		if object == nil {
+			continue
+		}
+		if decoded, err := w.document.decodeStream(object); err == nil {
+			data = append(data, decoded...)
+			data = append(data, '\n')
+		}
+	}
+
+	w.render(data, w.document.dict(page["Resources"]), 0)
+}
+
+func (w *pdfTextWriter) render(data []byte, resources pdfDict, depth int) {
+	fonts := w.document.dict(resources["Font"])
+	lexer := &pdfLexer{data: data}
+	var operands []any
+
+	for {
+		token := lexer.readObject()
+		if token == nil {
+			return
+		}
+
+		operator, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch operator {
+		case "BI":
+			lexer.skipInlineImage()
+		case "BT":
+			w.font = nil
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					w.font = w.document.font(fonts[string(name)])
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if y, ok := operands[len(operands)-1].(float64); ok && y != 0 {
+					w.newLine()
+				} else {
+					w.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				if y, ok := operands[len(operands)-1].(float64); ok {
+					if math.Abs(y-w.lastY) > 1 {
+						w.newLine()
+					} else {
+						w.space()
+					}
+					w.lastY = y
+				}
+			}
+		case "T*":
+			w.newLine()
+		case "Tj":
+			w.show(operands)
+		case "'", "\"":
+			w.newLine()
+			w.show(operands)
+		case "TJ":
+			if len(operands) > 0 {
+				if items, ok := operands[len(operands)-1].(pdfArray); ok {
+					for _, item := range items {
+						switch value := item.(type) {
+						case pdfString:
+							w.write(value)
+						case float64:
+							if value < -pdfWordSpacing {
+								w.space()
+							}
+						}
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxPDFFormDepth {
+				w.renderForm(operands[len(operands)-1], resources, depth)
+			}
+		}
+
+		operands = operands[:0]
+	}
+}
+
+// renderForm выводит текст из вложенной формы (Form XObject), которой часто оформляют колонтитулы
+func (w *pdfTextWriter) renderForm(operand any, resources pdfDict, depth int) {
+	name, ok := operand.(pdfName)
+	if !ok {
+		return
+	}
+
+	reference := w.document.dict(resources["XObject"])[string(name)]
+	object := w.document.object(reference)
+	if object == nil {
+		return
+	}
+
+	dict, _ := object.value.(pdfDict)
+	if dict["Subtype"] != pdfName("Form") {
+		return
+	}
+
+	data, err := w.document.decodeStream(object)
+	if err != nil {
+		return
+	}
+
+	formResources := w.document.dict(dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	font := w.font
+	w.render(data, formResources, depth+1)
+	w.font = font
+}
+
+func (w *pdfTextWriter) show(operands []any) {
+	if len(operands) == 0 {
+		return
+	}
+	if value, ok := operands[len(operands)-1].(pdfString); ok {
+		w.write(value)
+	}
+}
+
+func (w *pdfTextWriter) write(value pdfString) {
+	font := w.font
+	if font == nil {
+		font = &pdfFont{codeWidth: 1}
+	}
+	w.builder.WriteString(font.decode(value))
+}
+
+// pdfLexer разбирает синтаксис PDF: числа, строки, имена, массивы, словари и ссылки
+type pdfLexer struct {
+	data     []byte
+	position int
+}
+
+func isPDFSpace(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isPDFDelimiter(b byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), b) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.position < len(l.data) {
+		switch b := l.data[l.position]; {
+		case isPDFSpace(b):
+			l.position++
+		case b == '%':
+			for l.position < len(l.data) && l.data[l.position] != '\n' && l.data[l.position] != '\r' {
+				l.position++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readObject возвращает следующий объект или nil в конце данных
+func (l *pdfLexer) readObject() any {
+	token := l.readToken()
+
+	switch value := token.(type) {
+	case pdfKeyword:
+		switch value {
+		case "<<":
+			dict := pdfDict{}
+			for {
+				key := l.readObject()
+				name, ok := key.(pdfName)
+				if !ok {
+					return dict
+				}
+				dict[string(name)] = l.readObject()
+			}
+		case "[":
+			var array pdfArray
+			for {
+				item := l.readObject()
+				if item == nil || item == pdfKeyword("]") {
+					return array
+				}
+				array = append(array, item)
+			}
+		}
+	case float64:
+		// Ссылка на объект имеет вид «номер поколение R»
+		saved := l.position
+		if generation, ok := l.readToken().(float64); ok {
+			if l.readToken() == pdfKeyword("R") {
+				return pdfRef{number: int(value), generation: int(generation)}
+			}
+		}
+		l.position = saved
+	}
+
+	return token
+}
+
+func (l *pdfLexer) readToken() any {
+	l.skipSpace()
+	if l.position >= len(l.data) {
+		return nil
+	}
+
+	start := l.position
+	switch b := l.data[l.position]; b {
+	case '(':
+		return l.readLiteralString()
+	case '<':
+		if l.position+1 < len(l.data) && l.data[l.position+1] == '<' {
+			l.position += 2
+			return pdfKeyword("<<")
+		}
+		return l.readHexString()
+	case '>':
+		l.position++
+		if l.position < len(l.data) && l.data[l.position] == '>' {
+			l.position++
+			return pdfKeyword(">>")
+		}
+		return pdfKeyword(">")
+	case '[', ']', '{', '}', ')':
+		l.position++
+		return pdfKeyword(l.data[start:l.position])
+	case '/':
+		l.position++
+		return pdfName(decodePDFName(l.readRegular()))
+	}
+
+	word := l.readRegular()
+	if len(word) == 0 {
+		l.position++
+		return pdfKeyword(l.data[start:l.position])
+	}
+
+	if number, err := strconv.ParseFloat(string(word), 64); err == nil {
+		return number
+	}
+	return pdfKeyword(word)
+}
+
+func (l *pdfLexer) readRegular() []byte {
+	start := l.position
+	for l.position < len(l.data) && !isPDFSpace(l.data[l.position]) && !isPDFDelimiter(l.data[l.position]) {
+		l.position++
+	}
+	return l.data[start:l.position]
+}
+
+func (l *pdfLexer) readLiteralString() pdfString {
+	l.position++
+	var value []byte
+	depth := 1
+
+	for l.position < len(l.data) {
+		b := l.data[l.position]
+		l.position++
+
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return value
+			}
+		case '\\':
+			if l.position >= len(l.data) {
+				return value
+			}
+			escaped := l.data[l.position]
+			l.position++
+
+			switch escaped {
+			case 'n':
+				value = append(value, '\n')
+			case 'r':
+				value = append(value, '\r')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				value = append(value, '\b')
+			case 'f':
+				value = append(value, '\f')
+			case '\r':
+				if l.position < len(l.data) && l.data[l.position] == '\n' {
+					l.position++
+				}
+			case '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					code := int(escaped - '0')
+					for i := 0; i < 2 && l.position < len(l.data); i++ {
+						digit := l.data[l.position]
+						if digit < '0' || digit > '7' {
+							break
+						}
+						code = code*8 + int(digit-'0')
+						l.position++
+					}
+					value = append(value, byte(code))
+				} else {
+					value = append(value, escaped)
+				}
+			}
+			continue
+		}
+
+		value = append(value, b)
+	}
+
+	return value
+}
+
+func (l *pdfLexer) readHexString() pdfString {
+	l.position++
+	var digits []byte
+
+	for l.position < len(l.data) && l.data[l.position] != '>' {
+		if b := l.data[l.position]; hexValue(b) >= 0 {
+			digits = append(digits, b)
+		}
+		l.position++
+	}
+	l.position++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	value := make([]byte, len(digits)/2)
+	for i := range value {
+		value[i] = byte(hexValue(digits[2*i])<<4 | hexValue(digits[2*i+1]))
+	}
+	return value
+}
+
+// skipInlineImage пропускает данные встроенного изображения до оператора EI
+func (l *pdfLexer) skipInlineImage() {
+	end := bytes.Index(l.data[l.position:], []byte("ID"))
+	if end < 0 {
+		l.position = len(l.data)
+		return
+	}
+	l.position += end + 2
+
+	for l.position < len(l.data) {
+		index := bytes.Index(l.data[l.position:], []byte("EI"))
+		if index < 0 {
+			l.position = len(l.data)
+			return
+		}
+
+		at := l.position + index
+		l.position = at + 2
+		before := at == 0 || isPDFSpace(l.data[at-1])
+		after := l.position >= len(l.data) || isPDFSpace(l.data[l.position])
+		if before && after {
+			return
+		}
+	}
+}
+
+func hexValue(b byte) int {
+	switch {
+	case b >= '0' && b <= '9':
+		return int(b - '0')
+	case b >= 'a' && b <= 'f':
+		return int(b-'a') + 10
+	case b >= 'A' && b <= 'F':
+		return int(b-'A') + 10
+	}
+	return -1
+}
+
+func decodePDFName(name []byte) string {
+	if bytes.IndexByte(name, '#') < 0 {
+		return string(name)
+	}
+
+	var value []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) && hexValue(name[i+1]) >= 0 && hexValue(name[i+2]) >= 0 {
+			value = append(value, byte(hexValue(name[i+1])<<4|hexValue(name[i+2])))
+			i += 2
+			continue
+		}
+		value = append(value, name[i])
+	}
+	return string(value)
+}
@@ -0,0 +1,202 @@
+package knowledge
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		extract func([]byte) (string, error)
+		want    string
+	}{
+		{
+			name:    "pdf",
+			file:    "simple.pdf",
+			extract: extractPDF,
+			want:    "Price list\nCleaning 5000",
+		},
+		{
+			name:    "pdf с потоком объектов",
+			file:    "objstm.pdf",
+			extract: extractPDF,
+			want:    "Price list\nCleaning 5000",
+		},
+		{
+			name:    "docx",
+			file:    "price.docx",
+			extract: extractDOCX,
+			want:    "# Прайс\nЦены указаны в тенге.\nУслуга | Цена\nЧистка | 5000",
+		},
+		{
+			name:    "xlsx",
+			file:    "price.xlsx",
+			extract: extractXLSX,
+			want:    "# Лист: Цены\nУслуга | Цена\nУслуга: Чистка; Цена: 5000; да",
+		},
+		{
+			name:    "html",
+			file:    "price.html",
+			extract: extractHTML,
+			want:    "# Прайс\n\nЦены указаны в тенге.\n\n- Чистка\n- Отбеливание\n\nУслуга | Цена\nЧистка | 5000",
+		},
+		{
+			name:    "markdown",
+			file:    "price.md",
+			extract: extractMarkdown,
+			want:    "# Прайс\n\nЦены указаны в тенге.\n\nУслуга | Цена\nЧистка | 5000",
+		},
+		{
+			name:    "csv",
+			file:    "price.csv",
+			extract: extractCSV,
+			want:    "Услуга | Цена\nУслуга: Чистка; Цена: 5000\nУслуга: Отбеливание; Цена: 20000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, err := test.extract(readFixture(t, test.file))
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+			if text != test.want {
+				t.Errorf("текст:\n%q\nожидался:\n%q", text, test.want)
+			}
+		})
+	}
+}
+
+// Поврежденные файлы не должны приводить к panic: текст либо не извлекается, либо возвращается ошибка
+func TestExtractorsMalformedInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		extract func([]byte) (string, error)
+		wantErr bool
+	}{
+		{
+			name:    "оборванный pdf",
+			content: readFixture(t, "truncated.pdf"),
+			extract: extractPDF,
+		},
+		{
+			name:    "pdf с отрицательным First потока объектов",
+			content: readFixture(t, "objstm_negative_first.pdf"),
+			extract: extractPDF,
+		},
+		{
+			name:    "pdf с незакрытым объектом в конце файла",
+			content: readFixture(t, "unterminated_object.pdf"),
+			extract: extractPDF,
+		},
+		{
+			name:    "не pdf",
+			content: []byte("просто текст"),
+			extract: extractPDF,
+			wantErr: true,
+		},
+		{
+			name:    "docx не является архивом",
+			content: []byte("PK не архив"),
+			extract: extractDOCX,
+			wantErr: true,
+		},
+		{
+			name:    "docx без документа",
+			content: readFixture(t, "price.xlsx"),
+			extract: extractDOCX,
+			wantErr: true,
+		},
+		{
+			name:    "xlsx без книги",
+			content: readFixture(t, "price.docx"),
+			extract: extractXLSX,
+			wantErr: true,
+		},
+		{
+			name:    "xlsx со ссылкой за пределами листа",
+			content: readFixture(t, "wide_column.xlsx"),
+			extract: extractXLSX,
+		},
+		{
+			name:    "незакрытые теги html",
+			content: []byte("<html><body><table><tr><td>Чистка<td>5000<ul><li>пункт"),
+			extract: extractHTML,
+		},
+		{
+			name:    "csv с незакрытой кавычкой",
+			content: []byte("Услуга;Цена\n\"Чистка;5000\n"),
+			extract: extractCSV,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.extract(test.content)
+			if test.wantErr && err == nil {
+				t.Error("ожидалась ошибка")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("неожиданная ошибка: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractPDFEncrypted(t *testing.T) {
+	_, err := extractPDF([]byte("%PDF-1.4\ntrailer << /Encrypt 5 0 R >>"))
+	if !errors.Is(err, errPDFEncrypted) {
+		t.Errorf("ошибка %v, ожидалась %v", err, errPDFEncrypted)
+	}
+}
+
+// Регистрация извлекателя во время загрузки файлов не должна приводить к гонке (go test -race)
+func TestRegisterExtractorConcurrent(t *testing.T) {
+	const mimePNG = "image/png"
+	t.Cleanup(func() {
+		extractorsMutex.Lock()
+		delete(extractors, mimePNG)
+		extractorsMutex.Unlock()
+	})
+
+	service := NewService(nil, nil)
+	csv := Knowledge{Name: "price.csv", Content: readFixture(t, "price.csv")}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, errorResponse := service.ExtractText(csv); errorResponse != nil {
+				t.Errorf("извлечение CSV: %s", errorResponse.Details)
+			}
+		}()
+	}
+
+	RegisterExtractor(mimePNG, ExtractorFunc(func([]byte) (string, error) {
+		return "текст изображения", nil
+	}))
+	wg.Wait()
+
+	png := Knowledge{Name: "scan.png", Content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")}
+	text, mimeType, errorResponse := service.ExtractText(png)
+	if errorResponse != nil || mimeType != mimePNG || text != "текст изображения" {
+		t.Errorf("зарегистрированный извлекатель не использован: %q %s %v", text, mimeType, errorResponse)
+	}
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("чтение %s: %v", name, err)
+	}
+	return content
+}
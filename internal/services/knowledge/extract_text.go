@@ -0,0 +1,219 @@
+package knowledge
+
+import (
+	"bytes"
+	"encoding/csv"
+	"golang.org/x/text/encoding/charmap"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM встречается в начале текстовых файлов, сохраненных в Windows
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeText приводит текст к UTF-8. Файлы из Excel и Блокнота часто сохранены в Windows-1251.
+func decodeText(content []byte) string {
+	content = bytes.TrimPrefix(content, utf8BOM)
+
+	if utf8.Valid(content) {
+		return string(content)
+	}
+
+	decoded, err := charmap.Windows1251.NewDecoder().Bytes(content)
+	if err != nil {
+		return strings.ToValidUTF8(string(content), "")
+	}
+
+	return string(decoded)
+}
+
+func extractPlainText(content []byte) (string, error) {
+	return decodeText(content), nil
+}
+
+var (
+	markdownImage     = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	markdownLink      = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownEmphasis  = regexp.MustCompile(`(\*\*|__|~~|\*|` + "`" + `)`)
+	markdownHeading   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	markdownListItem  = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+	markdownSeparator = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+)
+
+// extractMarkdown убирает разметку, сохраняя заголовки, пункты списков и строки таблиц
+func extractMarkdown(content []byte) (string, error) {
+	var lines []string
+
+	for _, line := range strings.Split(decodeText(content), "\n") {
+		line = strings.TrimRight(line, "\r ")
+
+		if strings.HasPrefix(strings.TrimSpace(line), "```") || markdownSeparator.MatchString(line) {
+			continue
+		}
+
+		line = markdownImage.ReplaceAllString(line, "")
+		line = markdownLink.ReplaceAllString(line, "$1")
+
+		switch {
+		case markdownHeading.MatchString(line):
+			match := markdownHeading.FindStringSubmatch(line)
+			line = match[1] + " " + match[2]
+		case markdownListItem.MatchString(line):
+			line = "- " + markdownListItem.ReplaceAllString(line, "")
+		case strings.HasPrefix(strings.TrimSpace(line), "|"):
+			line = formatTableRow(splitMarkdownRow(line))
+		case strings.HasPrefix(strings.TrimSpace(line), ">"):
+			line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), ">"))
+		}
+
+		lines = append(lines, strings.TrimSpace(markdownEmphasis.ReplaceAllString(line, "")))
+	}
+
+	return joinLines(lines), nil
+}
+
+func splitMarkdownRow(line string) []string {
+	line = strings.Trim(strings.TrimSpace(line), "|")
+	return strings.Split(line, "|")
+}
+
+// extractCSV превращает каждую строку таблицы в строку вида «Заголовок: значение; ...»
+func extractCSV(content []byte) (string, error) {
+	text := decodeText(content)
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = detectDelimiter(text)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", err
+	}
+
+	return formatTable(rows), nil
+}
+
+// detectDelimiter выбирает разделитель по первой строке: русский Excel сохраняет CSV через точку с запятой
+func detectDelimiter(text string) rune {
+	firstLine, _, _ := strings.Cut(text, "\n")
+
+	best := ','
+	bestCount := strings.Count(firstLine, ",")
+	for _, delimiter := range []rune{';', '\t'} {
+		if count := strings.Count(firstLine, string(delimiter)); count > bestCount {
+			best = delimiter
+			bestCount = count
+		}
+	}
+
+	return best
+}
+
+// formatTable форматирует строки таблицы с учетом заголовка: первая непустая строка считается заголовком,
+// а каждая следующая выводится отдельной строкой с названиями колонок, чтобы чанк не терял контекст.
+func formatTable(rows [][]string) string {
+	var header []string
+	var lines []string
+
+	for _, row := range rows {
+		cells := trimCells(row)
+		if len(cells) == 0 {
+			continue
+		}
+
+		if header == nil {
+			header = cells
+			lines = append(lines, formatTableRow(cells))
+			continue
+		}
+
+		var parts []string
+		for i, cell := range cells {
+			if cell == "" {
+				continue
+			}
+			if i < len(header) && header[i] != "" {
+				parts = append(parts, header[i]+": "+cell)
+			} else {
+				parts = append(parts, cell)
+			}
+		}
+
+		if len(parts) > 0 {
+			lines = append(lines, strings.Join(parts, "; "))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatTableRow выводит ячейки строки таблицы через разделитель
+func formatTableRow(cells []string) string {
+	var parts []string
+	for _, cell := range cells {
+		if cell = strings.TrimSpace(cell); cell != "" {
+			parts = append(parts, cell)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// trimCells убирает пробелы в ячейках и пустые ячейки в конце строки. Пустая строка дает nil.
+func trimCells(row []string) []string {
+	cells := make([]string, len(row))
+	last := -1
+	for i, cell := range row {
+		cells[i] = strings.Join(strings.Fields(cell), " ")
+		if cells[i] != "" {
+			last = i
+		}
+	}
+	return cells[:last+1]
+}
+
+// textBuilder собирает извлеченный текст, не допуская лишних пробелов и переносов строк
+type textBuilder struct {
+	builder strings.Builder
+}
+
+func (b *textBuilder) space() {
+	current := b.builder.String()
+	if current != "" && !strings.HasSuffix(current, " ") && !strings.HasSuffix(current, "\n") {
+		b.builder.WriteString(" ")
+	}
+}
+
+func (b *textBuilder) newLine() {
+	if current := b.builder.String(); current != "" && !strings.HasSuffix(current, "\n") {
+		b.builder.WriteString("\n")
+	}
+}
+
+func (b *textBuilder) paragraph() {
+	b.newLine()
+	b.builder.WriteString("\n")
+}
+
+// joinLines склеивает строки, схлопывая повторяющиеся пустые строки
+func joinLines(lines []string) string {
+	var builder strings.Builder
+	blank := true
+
+	for _, line := range lines {
+		if line == "" {
+			if !blank {
+				builder.WriteString("\n")
+			}
+			blank = true
+			continue
+		}
+
+		builder.WriteString(line)
+		builder.WriteString("\n")
+		blank = false
+	}
+
+	return strings.TrimSpace(builder.String())
+}
@@ -0,0 +1,63 @@
+package knowledge
+
+import "sort"
+
+// rrfK сглаживает вклад первых позиций в reciprocal rank fusion
+const rrfK = 60
+
+// Ranking — результаты одного способа поиска, упорядоченные по убыванию релевантности, и вес способа
+type Ranking struct {
+	Results []SearchResult
+	Weight  float64
+}
+
+// FuseRankings объединяет результаты нескольких способов поиска методом reciprocal rank fusion:
+// чанк получает сумму weight / (rrfK + позиция) по всем спискам, в которых он найден.
+// Score результата заменяется итоговой оценкой, при равенстве выше остается чанк, найденный раньше.
+func FuseRankings(rankings []Ranking, limit int) []SearchResult {
+	type fused struct {
+		result SearchResult
+		score  float64
+		order  int
+	}
+
+	byID := make(map[string]*fused)
+	for _, ranking := range rankings {
+		if ranking.Weight <= 0 {
+			continue
+		}
+
+		for position, result := range ranking.Results {
+			item, ok := byID[result.ID]
+			if !ok {
+				item = &fused{result: result, order: len(byID)}
+				byID[result.ID] = item
+			}
+			item.score += ranking.Weight / float64(rrfK+position+1)
+		}
+	}
+
+	items := make([]*fused, 0, len(byID))
+	for _, item := range byID {
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].score != items[j].score {
+			return items[i].score > items[j].score
+		}
+		return items[i].order < items[j].order
+	})
+
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	results := make([]SearchResult, len(items))
+	for i, item := range items {
+		results[i] = item.result
+		results[i].Score = float32(item.score)
+	}
+
+	return results
+}
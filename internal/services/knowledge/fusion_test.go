@@ -0,0 +1,115 @@
+package knowledge
+
+import (
+	"math"
+	"testing"
+)
+
+func results(ids ...string) []SearchResult {
+	items := make([]SearchResult, len(ids))
+	for i, id := range ids {
+		items[i] = SearchResult{ID: id, Text: "текст " + id}
+	}
+	return items
+}
+
+func resultIDs(items []SearchResult) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func TestFuseRankings(t *testing.T) {
+	tests := []struct {
+		name     string
+		rankings []Ranking
+		limit    int
+		want     []string
+	}{
+		{
+			name: "совпадения в обоих списках поднимаются выше",
+			rankings: []Ranking{
+				{Results: results("a", "b", "c"), Weight: 1},
+				{Results: results("c", "d", "b"), Weight: 1},
+			},
+			want: []string{"c", "b", "a", "d"},
+		},
+		{
+			name: "непересекающиеся списки чередуются, при равенстве первым идет найденный раньше",
+			rankings: []Ranking{
+				{Results: results("a", "b"), Weight: 1},
+				{Results: results("c", "d"), Weight: 1},
+			},
+			want: []string{"a", "c", "b", "d"},
+		},
+		{
+			name: "больший вес перевешивает позицию",
+			rankings: []Ranking{
+				{Results: results("a", "b"), Weight: 1},
+				{Results: results("c", "d"), Weight: 3},
+			},
+			want: []string{"c", "d", "a", "b"},
+		},
+		{
+			name: "нулевой вес исключает список",
+			rankings: []Ranking{
+				{Results: results("a", "b"), Weight: 0},
+				{Results: results("c", "d"), Weight: 1},
+			},
+			want: []string{"c", "d"},
+		},
+		{
+			name: "limit обрезает результаты",
+			rankings: []Ranking{
+				{Results: results("a", "b", "c"), Weight: 1},
+				{Results: results("d", "e"), Weight: 1},
+			},
+			limit: 3,
+			want:  []string{"a", "d", "b"},
+		},
+		{
+			name: "пустые списки",
+			rankings: []Ranking{
+				{Weight: 1},
+			},
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := resultIDs(FuseRankings(test.rankings, test.limit))
+			if len(got) != len(test.want) {
+				t.Fatalf("результаты %v, ожидались %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("результаты %v, ожидались %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRankingsScore(t *testing.T) {
+	fused := FuseRankings([]Ranking{
+		{Results: results("a", "b"), Weight: 2},
+		{Results: results("b"), Weight: 0.5},
+	}, 0)
+
+	want := map[string]float64{
+		"a": 2.0 / (rrfK + 1),
+		"b": 2.0/(rrfK+2) + 0.5/(rrfK+1),
+	}
+
+	for _, result := range fused {
+		if math.Abs(float64(result.Score)-want[result.ID]) > 1e-6 {
+			t.Errorf("оценка %s: %f, ожидалась %f", result.ID, result.Score, want[result.ID])
+		}
+		if result.Text != "текст "+result.ID {
+			t.Errorf("текст %s потерян при объединении: %q", result.ID, result.Text)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package knowledge
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// Параметры фоновой индексации файлов
+const (
+	ingestionWorkers      = 2
+	ingestionQueueSize    = 100
+	ingestionPollInterval = 30 * time.Second
+)
+
+// IngestionQueue обрабатывает задачи индексации пулом воркеров. Задачи хранятся в Postgres,
+// а канал лишь ускоряет их доставку: задачи, не поместившиеся в канал, подбирает периодический опрос.
+type IngestionQueue struct {
+	logger  *log.Logger
+	service *Service
+	jobs    chan uuid.UUID
+}
+
+func NewIngestionQueue(postgres *databases.PostgresDatabase, qdrant *databases.QdrantDatabase) *IngestionQueue {
+	return &IngestionQueue{
+		logger:  utils.NewLogger("ingestion"),
+		service: NewService(postgres, qdrant),
+		jobs:    make(chan uuid.UUID, ingestionQueueSize),
+	}
+}
+
+// Start возвращает в очередь задачи, прерванные перезапуском, и запускает воркеры
+func (q *IngestionQueue) Start() {
+	q.resumeInterrupted()
+
+	for range ingestionWorkers {
+		go q.work()
+	}
+
+	go q.poll()
+}
+
+// Enqueue передает задачу воркерам, не блокируя запрос
+func (q *IngestionQueue) Enqueue(jobID uuid.UUID) {
+	select {
+	case q.jobs <- jobID:
+	default:
+		q.logger.Warnf("очередь индексации заполнена, задача %s будет взята при следующем опросе", jobID)
+	}
+}
+
+func (q *IngestionQueue) work() {
+	for jobID := range q.jobs {
+		q.service.processJob(jobID)
+	}
+}
+
+// poll периодически передает воркерам задачи, ожидающие обработки
+func (q *IngestionQueue) poll() {
+	ticker := time.NewTicker(ingestionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.enqueueQueued()
+		<-ticker.C
+	}
+}
+
+func (q *IngestionQueue) enqueueQueued() {
+	var jobIDs []uuid.UUID
+
+	err := q.service.postgres.DB.
+		Model(&models.KnowledgeJob{}).
+		Where("status = ?", models.KnowledgeFileStatusQueued).
+		Order("created_at").
+		Limit(ingestionQueueSize).
+		Pluck("id", &jobIDs).Error
+
+	if err != nil {
+		q.logger.Errorf("получение задач индексации: %v", err)
+		return
+	}
+
+	for _, jobID := range jobIDs {
+		q.Enqueue(jobID)
+	}
+}
+
+// resumeInterrupted возвращает в очередь задачи, которые обрабатывались в момент остановки сервиса.
+// Сервис запускается в одном экземпляре, поэтому при старте такие задачи точно никем не обрабатываются.
+func (q *IngestionQueue) resumeInterrupted() {
+	db := q.service.postgres.DB
+
+	result := db.Model(&models.KnowledgeJob{}).
+		Where("status = ?", models.KnowledgeFileStatusProcessing).
+		Update("status", models.KnowledgeFileStatusQueued)
+
+	if result.Error != nil {
+		q.logger.Errorf("возобновление прерванных задач индексации: %v", result.Error)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	err := db.Model(&models.KnowledgeFile{}).
+		Where("status = ?", models.KnowledgeFileStatusProcessing).
+		Where("id IN (?)", db.Model(&models.KnowledgeJob{}).
+			Select("file_id").
+			Where("status = ? AND operation = ?", models.KnowledgeFileStatusQueued, models.KnowledgeJobOperationUpload)).
+		Update("status", models.KnowledgeFileStatusQueued).Error
+
+	if err != nil {
+		q.logger.Errorf("возобновление статуса прерванных файлов: %v", err)
+	}
+
+	q.logger.Infof("возобновлено %d прерванных задач индексации", result.RowsAffected)
+}
@@ -0,0 +1,409 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+const (
+	// ingestionTimeout ограничивает время обработки одного файла
+	ingestionTimeout = 10 * time.Minute
+	// ingestionMaxAttempts ограничивает число запусков задачи, которая прерывается при каждом запуске
+	ingestionMaxAttempts = 3
+)
+
+type GetKnowledgeJobRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+	JobID   string `json:"job_id" validate:"required,uuid"`
+}
+
+// GetKnowledgeJob возвращает состояние и прогресс задачи индексации
+func (s *Service) GetKnowledgeJob(request *GetKnowledgeJobRequest) (*models.KnowledgeJob, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+	jobUUID, _ := uuid.Parse(request.JobID)
+
+	var job models.KnowledgeJob
+
+	err := s.postgres.DB.
+		Where("id = ? AND agent_id = ?", jobUUID, agentUUID).
+		First(&job).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewUserErrorResponse(
+				404,
+				"Задача не найдена",
+				"Указанная задача не существует или была удалена.",
+			)
+		}
+
+		s.logger.Errorf("получение задачи индексации: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения задачи",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return &job, nil
+}
+
+// createJob ставит файл в очередь индексации вместе с извлеченным текстом и настройками разбиения
+func (s *Service) createJob(
+	knowledgeFile *models.KnowledgeFile,
+	operation string,
+	file extractedFile,
+	chunking ChunkingRequest,
+) (*models.KnowledgeJob, *utils.UserErrorResponse) {
+	job := models.KnowledgeJob{
+		AgentID:          knowledgeFile.AgentID,
+		FileID:           knowledgeFile.ID,
+		Operation:        operation,
+		FileName:         file.Name,
+		FileSize:         file.Size,
+		FileType:         file.Type,
+		Content:          file.Text,
+		ChunkingStrategy: chunking.ChunkingStrategy,
+		ChunkSize:        chunking.ChunkSize,
+		ChunkOverlap:     chunking.ChunkOverlap,
+		Status:           models.KnowledgeFileStatusQueued,
+	}
+
+	if err := s.postgres.DB.Create(&job).Error; err != nil {
+		s.logger.Errorf("создание задачи индексации файла %s: %v", knowledgeFile.ID, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка загрузки базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	return &job, nil
+}
+
+// hasActiveJob проверяет, ожидает ли файл обработки или обрабатывается
+func (s *Service) hasActiveJob(fileID uuid.UUID) (bool, *utils.UserErrorResponse) {
+	var count int64
+
+	err := s.postgres.DB.
+		Model(&models.KnowledgeJob{}).
+		Where("file_id = ? AND status IN ?", fileID, []string{models.KnowledgeFileStatusQueued, models.KnowledgeFileStatusProcessing}).
+		Count(&count).Error
+
+	if err != nil {
+		s.logger.Errorf("проверка задач файла %s: %v", fileID, err)
+		return false, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения задач",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return count > 0, nil
+}
+
+// processJob выполняет задачу, если ее не взял другой воркер
+func (s *Service) processJob(jobID uuid.UUID) {
+	job, ok := s.claimJob(jobID)
+	if !ok {
+		return
+	}
+
+	var knowledgeFile *models.KnowledgeFile
+	var chunkCount int
+	var errorResponse *utils.UserErrorResponse
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				s.logger.Errorf("паника при обработке задачи %s: %v", job.ID, recovered)
+				errorResponse = utils.NewUserErrorResponse(500, "Ошибка обработки файла", "Внутренняя ошибка")
+			}
+		}()
+
+		if job.Attempts > ingestionMaxAttempts {
+			errorResponse = utils.NewUserErrorResponse(
+				500,
+				"Ошибка обработки файла",
+				fmt.Sprintf("Обработка прерывалась %d раз подряд", ingestionMaxAttempts),
+			)
+			return
+		}
+
+		knowledgeFile, chunkCount, errorResponse = s.runJob(job)
+	}()
+
+	s.finishJob(job, knowledgeFile, chunkCount, errorResponse)
+}
+
+// claimJob атомарно переводит задачу из очереди в обработку
+func (s *Service) claimJob(jobID uuid.UUID) (*models.KnowledgeJob, bool) {
+	startedAt := time.Now()
+
+	result := s.postgres.DB.
+		Model(&models.KnowledgeJob{}).
+		Where("id = ? AND status = ?", jobID, models.KnowledgeFileStatusQueued).
+		Updates(map[string]interface{}{
+			"status":     models.KnowledgeFileStatusProcessing,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"started_at": startedAt,
+		})
+
+	if result.Error != nil {
+		s.logger.Errorf("получение задачи индексации %s: %v", jobID, result.Error)
+		return nil, false
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, false
+	}
+
+	var job models.KnowledgeJob
+	if err := s.postgres.DB.First(&job, "id = ?", jobID).Error; err != nil {
+		s.logger.Errorf("получение задачи индексации %s: %v", jobID, err)
+		return nil, false
+	}
+
+	s.logger.Infof("начата обработка задачи %s (%s, попытка %d)", job.ID, job.Operation, job.Attempts)
+	return &job, true
+}
+
+// runJob разбивает текст задачи на чанки и приводит к ним точки файла в коллекции агента.
+// Эмбеддинги создаются только для чанков, которых еще нет в коллекции.
+func (s *Service) runJob(job *models.KnowledgeJob) (*models.KnowledgeFile, int, *utils.UserErrorResponse) {
+	var knowledgeFile models.KnowledgeFile
+
+	if err := s.postgres.DB.First(&knowledgeFile, "id = ?", job.FileID).Error; err != nil {
+		s.logger.Errorf("получение файла %s задачи %s: %v", job.FileID, job.ID, err)
+		return nil, 0, utils.NewUserErrorResponse(404, "Файл не найден", "Файл был удален до завершения обработки")
+	}
+
+	if job.Operation == models.KnowledgeJobOperationUpload {
+		s.updateFileStatus(&knowledgeFile, models.KnowledgeFileStatusProcessing)
+	}
+
+	currentAgent, errorResponse := agent.NewService().
+		GetAgent(job.AgentID, s.postgres)
+
+	if errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	embedder, errorResponse := NewEmbedder(currentAgent)
+	if errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ingestionTimeout)
+	defer cancel()
+
+	if errorResponse := s.checkJobCancelled(job); errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	schema, errorResponse := s.prepareCollection(ctx, job.AgentID, embedder)
+	if errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	// Агента могли удалить между проверкой и созданием коллекции: коллекция удаленного агента не должна остаться
+	if errorResponse := s.checkJobCancelled(job); errorResponse != nil {
+		if s.agentDeleted(job.AgentID) {
+			s.dropAgentCollection(ctx, job.AgentID)
+		}
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	chunks, errorResponse := s.CreateContentChunks(
+		job.Content,
+		job.AgentID,
+		NewChunkingConfig(job.ChunkingStrategy, job.ChunkSize, job.ChunkOverlap),
+	)
+	if errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	// При загрузке в коллекции могут быть чанки прерванной попытки, при замене — прежнее содержимое файла
+	plan, errorResponse := s.planFileChunks(ctx, &knowledgeFile, chunks)
+	if errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	unchanged := len(plan.Chunks) - len(plan.Changed)
+	s.updateJobProgress(job, unchanged, len(plan.Chunks))
+
+	results, errorResponse := s.EmbedChunks(
+		embedder,
+		plan.Changed,
+		job.AgentID,
+		func(processed int, total int) {
+			s.updateJobProgress(job, unchanged+processed, len(plan.Chunks))
+		},
+	)
+	if errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	if errorResponse := s.checkJobCancelled(job); errorResponse != nil {
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	if job.Operation == models.KnowledgeJobOperationReplace {
+		s.updateFileMetadata(&knowledgeFile, job)
+	}
+
+	if errorResponse := s.applyFileChunks(ctx, &knowledgeFile, plan, results, schema.Keywords); errorResponse != nil {
+		if job.Operation == models.KnowledgeJobOperationReplace {
+			// Чанки файла могли обновиться частично, поэтому файл считается необработанным
+			s.finishKnowledgeFile(&knowledgeFile, 0, errorResponse)
+		}
+		return &knowledgeFile, 0, errorResponse
+	}
+
+	// Файл могли удалить во время обработки: его чанки не должны остаться в коллекции
+	var count int64
+	s.postgres.DB.Model(&models.KnowledgeFile{}).Where("id = ?", knowledgeFile.ID).Count(&count)
+	if count == 0 {
+		s.deleteFilePoints(ctx, &knowledgeFile)
+		return nil, 0, utils.NewUserErrorResponse(404, "Файл не найден", "Файл был удален до завершения обработки")
+	}
+
+	return &knowledgeFile, len(plan.Chunks), nil
+}
+
+// finishJob записывает итог задачи и переносит его в статус файла
+func (s *Service) finishJob(
+	job *models.KnowledgeJob,
+	knowledgeFile *models.KnowledgeFile,
+	chunkCount int,
+	failure *utils.UserErrorResponse,
+) {
+	finishedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":         models.KnowledgeFileStatusCompleted,
+		"failure_reason": "",
+		"finished_at":    finishedAt,
+		// Текст больше не нужен: повторная обработка невозможна без новой загрузки
+		"content": "",
+	}
+
+	if failure != nil {
+		updates["status"] = models.KnowledgeFileStatusFailed
+		updates["failure_reason"] = failure.Message + ": " + failure.Details
+	}
+
+	// Итог записывается только в задачу, которую не отменили во время обработки
+	err := s.postgres.DB.Model(job).
+		Where("status = ?", models.KnowledgeFileStatusProcessing).
+		Updates(updates).Error
+
+	if err != nil {
+		s.logger.Errorf("обновление статуса задачи %s: %v", job.ID, err)
+	}
+
+	if knowledgeFile != nil && (job.Operation == models.KnowledgeJobOperationUpload || failure == nil) {
+		s.finishKnowledgeFile(knowledgeFile, chunkCount, failure)
+	}
+
+	if failure != nil {
+		s.logger.Errorf("задача %s завершилась ошибкой: %s", job.ID, updates["failure_reason"])
+		return
+	}
+
+	s.logger.Infof("задача %s завершена: %d чанков файла %s", job.ID, chunkCount, job.FileName)
+}
+
+// checkJobCancelled возвращает ошибку, если задачу отменили: агент удален или задача больше не в обработке
+func (s *Service) checkJobCancelled(job *models.KnowledgeJob) *utils.UserErrorResponse {
+	if s.agentDeleted(job.AgentID) {
+		return utils.NewUserErrorResponse(410, "Задача отменена", "Агент удален")
+	}
+
+	var count int64
+	err := s.postgres.DB.
+		Model(&models.KnowledgeJob{}).
+		Where("id = ? AND status = ?", job.ID, models.KnowledgeFileStatusProcessing).
+		Count(&count).Error
+
+	if err != nil {
+		s.logger.Errorf("проверка состояния задачи %s: %v", job.ID, err)
+		return nil
+	}
+
+	if count == 0 {
+		return utils.NewUserErrorResponse(410, "Задача отменена", "Задача была отменена во время обработки")
+	}
+
+	return nil
+}
+
+// agentDeleted сообщает, что агент удален. При ошибке чтения агент считается существующим:
+// коллекцию удаленного агента в этом случае удалит CleanupDeletedAgents.
+func (s *Service) agentDeleted(agentID uuid.UUID) bool {
+	var count int64
+
+	if err := s.postgres.DB.Model(&models.Agent{}).Where("id = ?", agentID).Count(&count).Error; err != nil {
+		s.logger.Errorf("проверка агента %s: %v", agentID, err)
+		return false
+	}
+
+	return count == 0
+}
+
+// dropAgentCollection удаляет коллекцию, созданную для уже удаленного агента
+func (s *Service) dropAgentCollection(ctx context.Context, agentID uuid.UUID) {
+	if err := s.qdrant.Client.DeleteCollection(ctx, agentID.String()); err != nil {
+		s.logger.Errorf("удаление коллекции удаленного агента %s: %v", agentID, err)
+		return
+	}
+
+	s.logger.Infof("удалена коллекция %s, созданная после удаления агента", agentID)
+}
+
+func (s *Service) updateJobProgress(job *models.KnowledgeJob, processed int, total int) {
+	job.ProcessedChunks = processed
+	job.TotalChunks = total
+
+	err := s.postgres.DB.Model(job).Updates(map[string]interface{}{
+		"processed_chunks": processed,
+		"total_chunks":     total,
+	}).Error
+
+	if err != nil {
+		s.logger.Errorf("обновление прогресса задачи %s: %v", job.ID, err)
+	}
+}
+
+func (s *Service) updateFileStatus(knowledgeFile *models.KnowledgeFile, status string) {
+	knowledgeFile.Status = status
+
+	if err := s.postgres.DB.Model(knowledgeFile).Update("status", status).Error; err != nil {
+		s.logger.Errorf("обновление статуса файла %s: %v", knowledgeFile.ID, err)
+	}
+}
+
+// updateFileMetadata переносит в файл сведения о новом содержимом из задачи замены
+func (s *Service) updateFileMetadata(knowledgeFile *models.KnowledgeFile, job *models.KnowledgeJob) {
+	knowledgeFile.OriginalName = job.FileName
+	knowledgeFile.FileSize = job.FileSize
+	knowledgeFile.FileType = job.FileType
+	knowledgeFile.ContentHash = hashText(job.Content)
+
+	err := s.postgres.DB.Model(knowledgeFile).Updates(map[string]interface{}{
+		"original_name": knowledgeFile.OriginalName,
+		"file_size":     knowledgeFile.FileSize,
+		"file_type":     knowledgeFile.FileType,
+		"content_hash":  knowledgeFile.ContentHash,
+	}).Error
+
+	if err != nil {
+		s.logger.Errorf("обновление файла %s: %v", knowledgeFile.ID, err)
+	}
+}
@@ -0,0 +1,100 @@
+package knowledge
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keywordVectorName — имя разреженного вектора ключевых слов в коллекции агента
+const keywordVectorName = "keywords"
+
+// Параметры BM25. Средняя длина чанка неизвестна при индексации одного файла,
+// поэтому берется оценка, близкая к размеру чанка по умолчанию. IDF считает сам Qdrant.
+const (
+	bm25K1            = 1.2
+	bm25B             = 0.75
+	bm25AverageLength = 120
+)
+
+// KeywordVector хранит разреженный вектор ключевых слов: номера терминов и их веса
+type KeywordVector struct {
+	Indices []uint32
+	Values  []float32
+}
+
+// keywordTerms разбивает текст на термины поиска по ключевым словам. Термины сохраняются целиком,
+// чтобы точные совпадения кодов услуг, названий препаратов и цен не терялись из-за нормализации.
+func keywordTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < 2 && !unicode.IsNumber([]rune(word)[0]) {
+			continue
+		}
+		terms = append(terms, word)
+	}
+
+	return terms
+}
+
+// termIndex переводит термин в номер измерения разреженного вектора
+func termIndex(term string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(term))
+	return hash.Sum32()
+}
+
+// DocumentKeywordVector строит вектор чанка с весами BM25 по частоте терминов и длине текста
+func DocumentKeywordVector(text string) KeywordVector {
+	terms := keywordTerms(text)
+
+	frequencies := make(map[uint32]int)
+	for _, term := range terms {
+		frequencies[termIndex(term)]++
+	}
+
+	lengthNorm := 1 - bm25B + bm25B*float64(len(terms))/bm25AverageLength
+
+	return newKeywordVector(frequencies, func(frequency int) float32 {
+		tf := float64(frequency)
+		return float32(tf * (bm25K1 + 1) / (tf + bm25K1*lengthNorm))
+	})
+}
+
+// QueryKeywordVector строит вектор запроса: каждый термин учитывается один раз
+func QueryKeywordVector(text string) KeywordVector {
+	frequencies := make(map[uint32]int)
+	for _, term := range keywordTerms(text) {
+		frequencies[termIndex(term)] = 1
+	}
+
+	return newKeywordVector(frequencies, func(int) float32 {
+		return 1
+	})
+}
+
+func newKeywordVector(frequencies map[uint32]int, weight func(frequency int) float32) KeywordVector {
+	vector := KeywordVector{
+		Indices: make([]uint32, 0, len(frequencies)),
+		Values:  make([]float32, 0, len(frequencies)),
+	}
+
+	for index := range frequencies {
+		vector.Indices = append(vector.Indices, index)
+	}
+	sort.Slice(vector.Indices, func(i, j int) bool {
+		return vector.Indices[i] < vector.Indices[j]
+	})
+
+	for _, index := range vector.Indices {
+		vector.Values = append(vector.Values, weight(frequencies[index]))
+	}
+
+	return vector
+}
@@ -0,0 +1,82 @@
+package knowledge
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKeywordTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "регистр и знаки препинания",
+			text: "Чистка, ЗУБОВ! Отбеливание?",
+			want: []string{"чистка", "зубов", "отбеливание"},
+		},
+		{
+			name: "однобуквенные слова отбрасываются, цифры остаются",
+			text: "Скидка 5 % и бонус в подарок",
+			want: []string{"скидка", "5", "бонус", "подарок"},
+		},
+		{
+			name: "коды услуг и цены не теряются",
+			text: "Код A16.07 стоит 15000₸",
+			want: []string{"код", "a16", "07", "стоит", "15000"},
+		},
+		{
+			name: "пустой текст",
+			text: " ,.; ",
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := keywordTerms(test.text)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("термины %q, ожидались %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDocumentKeywordVector(t *testing.T) {
+	vector := DocumentKeywordVector("имплант имплант коронка")
+
+	if len(vector.Indices) != 2 || len(vector.Values) != 2 {
+		t.Fatalf("вектор %+v, ожидалось 2 термина", vector)
+	}
+	if !slices.IsSorted(vector.Indices) {
+		t.Errorf("номера терминов не упорядочены: %v", vector.Indices)
+	}
+
+	implant := vector.Values[slices.Index(vector.Indices, termIndex("имплант"))]
+	crown := vector.Values[slices.Index(vector.Indices, termIndex("коронка"))]
+	if implant <= crown {
+		t.Errorf("вес повторяющегося термина %f не больше веса одиночного %f", implant, crown)
+	}
+	// BM25 ограничивает вклад частоты термина значением k1 + 1
+	if implant >= bm25K1+1 {
+		t.Errorf("вес термина %f превышает предел BM25 %f", implant, bm25K1+1)
+	}
+}
+
+func TestQueryKeywordVector(t *testing.T) {
+	vector := QueryKeywordVector("имплант Имплант коронка")
+
+	if len(vector.Indices) != 2 {
+		t.Fatalf("вектор %+v, ожидалось 2 термина", vector)
+	}
+	for _, value := range vector.Values {
+		if value != 1 {
+			t.Errorf("вес термина запроса %f, ожидался 1", value)
+		}
+	}
+
+	if !slices.Equal(vector.Indices, QueryKeywordVector("коронка имплант").Indices) {
+		t.Error("вектор запроса зависит от порядка слов")
+	}
+}
@@ -1 +1,197 @@
 package knowledge
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/qdrant/go-client/qdrant"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+	"sort"
+	"time"
+)
+
+// scrollPageSize задает количество точек, запрашиваемых из Qdrant за один вызов
+const scrollPageSize = 256
+
+type GetKnowledgeRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+}
+
+type GetKnowledgeChunksRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+	FileID  string `json:"file_id" validate:"required,uuid"`
+}
+
+// AgentKnowledge содержит все источники базы знаний агента
+type AgentKnowledge struct {
+	Files   []models.KnowledgeFile   `json:"files"`
+	Prompts []models.KnowledgePrompt `json:"prompts"`
+}
+
+// KnowledgeChunk описывает чанк файла, сохраненный в Qdrant
+type KnowledgeChunk struct {
+	ID         string `json:"id"`
+	ChunkIndex int64  `json:"chunk_index"`
+	Text       string `json:"text"`
+	CharCount  int64  `json:"char_count"`
+}
+
+type KnowledgeFileChunks struct {
+	File   models.KnowledgeFile `json:"file"`
+	Chunks []KnowledgeChunk     `json:"chunks"`
+}
+
+// GetKnowledge возвращает файлы и промпты базы знаний агента
+func (s *Service) GetKnowledge(request *GetKnowledgeRequest) (*AgentKnowledge, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	if _, errorResponse := agent.NewService().GetAgent(agentUUID, s.postgres); errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	knowledge := &AgentKnowledge{
+		Files:   []models.KnowledgeFile{},
+		Prompts: []models.KnowledgePrompt{},
+	}
+
+	err := s.postgres.DB.
+		Where("agent_id = ?", agentUUID).
+		Order("created_at DESC").
+		Find(&knowledge.Files).Error
+
+	if err == nil {
+		err = s.postgres.DB.
+			Where("agent_id = ?", agentUUID).
+			Order("created_at DESC").
+			Find(&knowledge.Prompts).Error
+	}
+
+	if err != nil {
+		s.logger.Errorf("получение базы знаний агента %s: %v", agentUUID, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения базы знаний",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return knowledge, nil
+}
+
+// GetKnowledgeChunks возвращает чанки файла в порядке их следования в файле
+func (s *Service) GetKnowledgeChunks(request *GetKnowledgeChunksRequest) (*KnowledgeFileChunks, *utils.UserErrorResponse) {
+	knowledgeFile, errorResponse := s.getKnowledgeFile(request.AgentID, request.FileID)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	points, errorResponse := s.scrollFilePoints(ctx, knowledgeFile)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	chunks := make([]KnowledgeChunk, 0, len(points))
+	for _, point := range points {
+		payload := point.GetPayload()
+		chunks = append(chunks, KnowledgeChunk{
+			ID:         point.GetId().GetUuid(),
+			ChunkIndex: payload["chunk_index"].GetIntegerValue(),
+			Text:       payload["text"].GetStringValue(),
+			CharCount:  payload["char_count"].GetIntegerValue(),
+		})
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].ChunkIndex < chunks[j].ChunkIndex
+	})
+
+	return &KnowledgeFileChunks{
+		File:   *knowledgeFile,
+		Chunks: chunks,
+	}, nil
+}
+
+// getKnowledgeFile находит файл базы знаний, принадлежащий агенту
+func (s *Service) getKnowledgeFile(agentID string, fileID string) (*models.KnowledgeFile, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(agentID)
+	fileUUID, _ := uuid.Parse(fileID)
+
+	var knowledgeFile models.KnowledgeFile
+
+	err := s.postgres.DB.
+		Where("id = ? AND agent_id = ?", fileUUID, agentUUID).
+		First(&knowledgeFile).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewUserErrorResponse(
+				404,
+				"Файл не найден",
+				"Указанный файл не существует или был удален.",
+			)
+		}
+
+		s.logger.Errorf("получение файла базы знаний: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения файла",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return &knowledgeFile, nil
+}
+
+// scrollFilePoints загружает все точки коллекции, относящиеся к файлу
+func (s *Service) scrollFilePoints(ctx context.Context, knowledgeFile *models.KnowledgeFile) ([]*qdrant.RetrievedPoint, *utils.UserErrorResponse) {
+	exists, err := s.qdrant.Client.CollectionExists(ctx, knowledgeFile.CollectionName)
+	if err == nil && !exists {
+		return nil, nil
+	}
+
+	var points []*qdrant.RetrievedPoint
+	var offset *qdrant.PointId
+	limit := uint32(scrollPageSize)
+
+	for err == nil {
+		var response *qdrant.ScrollResponse
+		response, err = s.qdrant.Client.GetPointsClient().Scroll(ctx, &qdrant.ScrollPoints{
+			CollectionName: knowledgeFile.CollectionName,
+			Filter:         fileFilter(knowledgeFile.ID),
+			Offset:         offset,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayload(true),
+		})
+		if err != nil {
+			break
+		}
+
+		points = append(points, response.GetResult()...)
+
+		offset = response.GetNextPageOffset()
+		if offset == nil {
+			return points, nil
+		}
+	}
+
+	s.logger.Errorf("получение чанков файла %s из Qdrant: %v", knowledgeFile.ID, err)
+	return nil, utils.NewUserErrorResponse(
+		500,
+		"Ошибка получения чанков",
+		"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+	)
+}
+
+func fileFilter(fileID uuid.UUID) *qdrant.Filter {
+	return &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatchKeyword("file_id", fileID.String()),
+		},
+	}
+}
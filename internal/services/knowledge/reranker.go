@@ -0,0 +1,128 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"sort"
+	"time"
+)
+
+// rerankTimeout ограничивает переранжирование, чтобы оно не задерживало ответ пользователю
+const rerankTimeout = 20 * time.Second
+
+// Reranker оценивает релевантность найденных чанков запросу точнее, чем векторный поиск
+type Reranker interface {
+	// Score возвращает оценки от 0 до 1 в порядке текстов
+	Score(ctx context.Context, query string, texts []string) ([]float64, error)
+}
+
+// NewReranker создает переранжировщик по настройкам агента
+func NewReranker(agent *models.Agent) (Reranker, *utils.UserErrorResponse) {
+	switch agent.RerankProvider {
+	case "", models.RerankProviderLLM:
+		return NewLLMReranker(agent.APIKey, agent.Model), nil
+	case models.RerankProviderHTTP:
+		if agent.RerankBaseURL == "" {
+			return nil, utils.NewUserErrorResponse(
+				400,
+				"Не настроен сервер переранжирования",
+				"Укажите rerank_base_url в настройках агента",
+			)
+		}
+		return NewHTTPReranker(agent.RerankBaseURL, agent.RerankAPIKey), nil
+	default:
+		return nil, utils.NewUserErrorResponse(
+			400,
+			"Неизвестный способ переранжирования",
+			"Поддерживаются способы llm и http",
+		)
+	}
+}
+
+// RerankResults упорядочивает кандидатов по оценкам reranker и оставляет не более limit чанков
+// с оценкой не ниже threshold. Score результата заменяется оценкой reranker.
+func RerankResults(ctx context.Context, reranker Reranker, query string, candidates []SearchResult, limit int, threshold float64) ([]SearchResult, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	texts := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		texts[i] = candidate.Text
+	}
+
+	scores, err := reranker.Score(ctx, query, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scores) != len(candidates) {
+		return nil, fmt.Errorf("получено %d оценок для %d кандидатов", len(scores), len(candidates))
+	}
+
+	results := make([]SearchResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		if scores[i] < threshold {
+			continue
+		}
+		candidate.Score = float32(scores[i])
+		results = append(results, candidate)
+	}
+
+	// Стабильная сортировка сохраняет порядок поиска для чанков с одинаковой оценкой
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// rerank переранжирует кандидатов по настройкам агента. При ошибке reranker возвращаются
+// первые кандидаты в порядке поиска, чтобы сбой второй стадии не оставил ответ без базы знаний.
+func (s *Service) rerank(agent *models.Agent, query string, candidates []SearchResult) []SearchResult {
+	reranker, errorResponse := NewReranker(agent)
+	if errorResponse != nil {
+		s.logger.Warnf("переранжирование для агента %s отключено: %s", agent.ID, errorResponse.Details)
+		return firstResults(candidates, rerankLimit(agent))
+	}
+
+	return s.rerankWith(reranker, agent, query, candidates)
+}
+
+// rerankWith переранжирует кандидатов переданным reranker с лимитом и порогом агента
+func (s *Service) rerankWith(reranker Reranker, agent *models.Agent, query string, candidates []SearchResult) []SearchResult {
+	limit := rerankLimit(agent)
+
+	ctx, cancel := context.WithTimeout(context.Background(), rerankTimeout)
+	defer cancel()
+
+	results, err := RerankResults(ctx, reranker, query, candidates, limit, agent.RerankScoreThreshold)
+	if err != nil {
+		s.logger.Errorf("переранжирование для агента %s: %v", agent.ID, err)
+		return firstResults(candidates, limit)
+	}
+
+	s.logger.Infof("после переранжирования осталось %d из %d чанков для агента %s", len(results), len(candidates), agent.ID)
+	return results
+}
+
+// rerankLimit возвращает число чанков после переранжирования: RerankTopN, а если он не задан — KnowledgeTopK
+func rerankLimit(agent *models.Agent) int {
+	if agent.RerankTopN > 0 {
+		return agent.RerankTopN
+	}
+	return agent.KnowledgeTopK
+}
+
+func firstResults(results []SearchResult, limit int) []SearchResult {
+	if limit > 0 && len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,110 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPReranker оценивает чанки cross-encoder моделью через эндпоинт POST /rerank
+// в формате text-embeddings-inference: оценки возвращаются в диапазоне от 0 до 1
+type HTTPReranker struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+type httpRerankRequest struct {
+	Query     string   `json:"query"`
+	Texts     []string `json:"texts"`
+	Truncate  bool     `json:"truncate"`
+	RawScores bool     `json:"raw_scores"`
+}
+
+type httpRerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+func NewHTTPReranker(baseURL string, apiKey string) *HTTPReranker {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &HTTPReranker{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   rerankTimeout,
+		},
+	}
+}
+
+func (r *HTTPReranker) Score(ctx context.Context, query string, texts []string) ([]float64, error) {
+	body, err := json.Marshal(httpRerankRequest{
+		Query:    query,
+		Texts:    texts,
+		Truncate: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервер переранжирования вернул статус %d: %s", resp.StatusCode, truncateBody(data))
+	}
+
+	var results []httpRerankResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("разбор ответа сервера переранжирования: %w", err)
+	}
+
+	if len(results) != len(texts) {
+		return nil, fmt.Errorf("сервер переранжирования вернул %d оценок вместо %d", len(results), len(texts))
+	}
+
+	scores := make([]float64, len(texts))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(scores) {
+			return nil, fmt.Errorf("индекс оценки %d вне диапазона", result.Index)
+		}
+		scores[result.Index] = result.Score
+	}
+
+	return scores, nil
+}
@@ -0,0 +1,87 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/openai/openai-go"
+	openaiService "macdent-ai-chatbot/internal/services/openai"
+	"strings"
+)
+
+// llmRerankMaxRunes ограничивает длину чанка в запросе оценки
+const llmRerankMaxRunes = 1500
+
+const llmRerankPrompt = `Ты оцениваешь, насколько фрагменты базы знаний стоматологической клиники помогают ответить на вопрос пациента.
+Оцени каждый фрагмент целым числом от 0 до 10: 10 — фрагмент прямо отвечает на вопрос, 0 — не относится к вопросу.
+Верни JSON вида {"scores": [оценка фрагмента 1, оценка фрагмента 2, ...]} с оценкой для каждого фрагмента в исходном порядке.`
+
+// LLMReranker оценивает релевантность чанков чат-моделью агента
+type LLMReranker struct {
+	service *openaiService.Service
+	model   string
+}
+
+func NewLLMReranker(apiKey string, model string) *LLMReranker {
+	return &LLMReranker{
+		service: openaiService.NewService(apiKey),
+		model:   model,
+	}
+}
+
+func (r *LLMReranker) Score(ctx context.Context, query string, texts []string) ([]float64, error) {
+	var builder strings.Builder
+	builder.WriteString("Вопрос пациента: ")
+	builder.WriteString(query)
+	for i, text := range texts {
+		runes := []rune(text)
+		if len(runes) > llmRerankMaxRunes {
+			text = string(runes[:llmRerankMaxRunes]) + "..."
+		}
+		builder.WriteString(fmt.Sprintf("\n\nФрагмент %d:\n%s", i+1, text))
+	}
+
+	completion, err := r.service.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.F(r.model),
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(llmRerankPrompt),
+			openai.UserMessage(builder.String()),
+		}),
+		Temperature: openai.F(0.0),
+		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](openai.ResponseFormatJSONObjectParam{
+			Type: openai.F(openai.ResponseFormatJSONObjectTypeJSONObject),
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(completion.Choices) == 0 {
+		return nil, errors.New("модель не вернула ответ")
+	}
+
+	return parseLLMScores(completion.Choices[0].Message.Content, len(texts))
+}
+
+// parseLLMScores переводит оценки модели от 0 до 10 в диапазон от 0 до 1
+func parseLLMScores(content string, count int) ([]float64, error) {
+	var response struct {
+		Scores []float64 `json:"scores"`
+	}
+
+	if err := json.Unmarshal([]byte(content), &response); err != nil {
+		return nil, fmt.Errorf("разбор оценок модели: %w", err)
+	}
+
+	if len(response.Scores) != count {
+		return nil, fmt.Errorf("модель вернула %d оценок вместо %d", len(response.Scores), count)
+	}
+
+	scores := make([]float64, count)
+	for i, score := range response.Scores {
+		scores[i] = min(max(score, 0), 10) / 10
+	}
+
+	return scores, nil
+}
@@ -0,0 +1,173 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"macdent-ai-chatbot/internal/models"
+	"slices"
+	"testing"
+)
+
+// fakeReranker возвращает заранее заданные оценки и запоминает полученные тексты
+type fakeReranker struct {
+	scores []float64
+	err    error
+	texts  []string
+}
+
+func (r *fakeReranker) Score(_ context.Context, _ string, texts []string) ([]float64, error) {
+	r.texts = texts
+	return r.scores, r.err
+}
+
+func TestRerankResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		scores    []float64
+		limit     int
+		threshold float64
+		want      []string
+	}{
+		{
+			name:   "упорядочивание по оценкам",
+			scores: []float64{0.1, 0.9, 0.5},
+			want:   []string{"b", "c", "a"},
+		},
+		{
+			name:   "равные оценки сохраняют порядок поиска",
+			scores: []float64{0.5, 0.9, 0.5},
+			want:   []string{"b", "a", "c"},
+		},
+		{
+			name:   "limit оставляет лучшие",
+			scores: []float64{0.1, 0.9, 0.5},
+			limit:  2,
+			want:   []string{"b", "c"},
+		},
+		{
+			name:      "порог отбрасывает нерелевантные",
+			scores:    []float64{0.1, 0.9, 0.5},
+			threshold: 0.5,
+			want:      []string{"b", "c"},
+		},
+		{
+			name:      "ни один кандидат не прошел порог",
+			scores:    []float64{0.1, 0.2, 0.3},
+			threshold: 0.8,
+			want:      []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reranker := &fakeReranker{scores: test.scores}
+
+			reranked, err := RerankResults(context.Background(), reranker, "запрос", results("a", "b", "c"), test.limit, test.threshold)
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+
+			if got := resultIDs(reranked); !slices.Equal(got, test.want) {
+				t.Errorf("результаты %v, ожидались %v", got, test.want)
+			}
+			if !slices.Equal(reranker.texts, []string{"текст a", "текст b", "текст c"}) {
+				t.Errorf("reranker получил тексты %q", reranker.texts)
+			}
+		})
+	}
+}
+
+func TestRerankResultsScore(t *testing.T) {
+	reranked, _ := RerankResults(context.Background(), &fakeReranker{scores: []float64{0.25, 0.75}}, "запрос", results("a", "b"), 0, 0)
+
+	if reranked[0].ID != "b" || reranked[0].Score != 0.75 || reranked[1].Score != 0.25 {
+		t.Errorf("оценки не заменены оценками reranker: %+v", reranked)
+	}
+}
+
+func TestRerankResultsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		reranker *fakeReranker
+	}{
+		{
+			name:     "ошибка reranker",
+			reranker: &fakeReranker{err: errors.New("сервер недоступен")},
+		},
+		{
+			name:     "оценок меньше, чем кандидатов",
+			reranker: &fakeReranker{scores: []float64{0.5, 0.1}},
+		},
+		{
+			name:     "оценок больше, чем кандидатов",
+			reranker: &fakeReranker{scores: []float64{0.5, 0.1, 0.3, 0.9}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := RerankResults(context.Background(), test.reranker, "запрос", results("a", "b", "c"), 0, 0); err == nil {
+				t.Error("ожидалась ошибка")
+			}
+		})
+	}
+}
+
+func TestRerankResultsNoCandidates(t *testing.T) {
+	reranker := &fakeReranker{err: errors.New("не должен вызываться")}
+
+	reranked, err := RerankResults(context.Background(), reranker, "запрос", nil, 5, 0)
+	if err != nil || len(reranked) != 0 {
+		t.Errorf("результаты %v, ошибка %v, ожидался пустой результат без ошибки", reranked, err)
+	}
+}
+
+// При сбое reranker возвращаются первые кандидаты в порядке поиска
+func TestServiceRerankFallback(t *testing.T) {
+	service := NewService(nil, nil)
+	candidates := results("a", "b", "c", "d")
+
+	tests := []struct {
+		name     string
+		agent    *models.Agent
+		reranker Reranker
+		want     []string
+	}{
+		{
+			name:     "ошибка reranker",
+			agent:    &models.Agent{RerankTopN: 2, KnowledgeTopK: 3},
+			reranker: &fakeReranker{err: errors.New("таймаут")},
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "неверное количество оценок, лимит по KnowledgeTopK",
+			agent:    &models.Agent{KnowledgeTopK: 3},
+			reranker: &fakeReranker{scores: []float64{1}},
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "успешное переранжирование",
+			agent:    &models.Agent{RerankTopN: 2, RerankScoreThreshold: 0.2},
+			reranker: &fakeReranker{scores: []float64{0.1, 0.3, 0.9, 0.5}},
+			want:     []string{"c", "d"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := resultIDs(service.rerankWith(test.reranker, test.agent, "запрос", candidates))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("результаты %v, ожидались %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestServiceRerankUnknownProvider(t *testing.T) {
+	agent := &models.Agent{RerankProvider: "unknown", RerankTopN: 1}
+
+	got := resultIDs(NewService(nil, nil).rerank(agent, "запрос", results("a", "b")))
+	if !slices.Equal(got, []string{"a"}) {
+		t.Errorf("результаты %v, ожидались первые кандидаты поиска", got)
+	}
+}
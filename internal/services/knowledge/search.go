@@ -0,0 +1,196 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"github.com/qdrant/go-client/qdrant"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"strings"
+	"time"
+)
+
+// hybridCandidateFactor задает, во сколько раз больше кандидатов берет каждый способ поиска перед объединением
+const hybridCandidateFactor = 3
+
+// SearchResult — найденный чанк. Score содержит оценку reranker, если переранжирование включено,
+// оценку reciprocal rank fusion при гибридном поиске, иначе — косинусную близость к запросу.
+type SearchResult struct {
+	ID    string
+	Text  string
+	Score float32
+}
+
+// SearchKnowledge ищет в коллекции агента чанки, наиболее близкие к запросу пользователя.
+// Если коллекция хранит векторы ключевых слов, векторный поиск дополняется поиском по ключевым словам,
+// а результаты объединяются с весами агента. Если включено переранжирование, найденные кандидаты
+// переупорядочиваются reranker. Если у агента нет коллекции, возвращается пустой результат.
+func (s *Service) SearchKnowledge(agent *models.Agent, query string) ([]SearchResult, *utils.UserErrorResponse) {
+	if agent.KnowledgeTopK <= 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collectionName := agent.ID.String()
+
+	collectionExists, err := s.qdrant.Client.CollectionExists(ctx, collectionName)
+	if err != nil {
+		s.logger.Errorf("проверка существования коллекции в Qdrant: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка поиска по базе знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	if !collectionExists {
+		return nil, nil
+	}
+
+	schema, errorResponse := s.getCollectionSchema(ctx, collectionName)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	limit := agent.KnowledgeTopK
+	if agent.RerankEnabled && agent.RerankCandidates > limit {
+		limit = agent.RerankCandidates
+	}
+
+	// Нулевой вес отключает способ поиска. Коллекции без разреженных векторов ищут только по эмбеддингам.
+	hybrid := schema.Keywords && agent.KnowledgeKeywordWeight > 0
+	if !hybrid && agent.KnowledgeDenseWeight <= 0 {
+		s.logger.Warnf("поиск по базе знаний агента %s отключен нулевыми весами", collectionName)
+		return nil, nil
+	}
+
+	var results []SearchResult
+	if hybrid {
+		results, errorResponse = s.searchHybrid(ctx, agent, query, limit)
+	} else {
+		results, errorResponse = s.searchDense(ctx, agent, query, limit)
+	}
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	if agent.RerankEnabled {
+		results = s.rerank(agent, query, results)
+	}
+
+	return results, nil
+}
+
+// searchHybrid объединяет векторный поиск и поиск по ключевым словам с весами агента
+func (s *Service) searchHybrid(ctx context.Context, agent *models.Agent, query string, limit int) ([]SearchResult, *utils.UserErrorResponse) {
+	collectionName := agent.ID.String()
+	candidates := limit * hybridCandidateFactor
+	var rankings []Ranking
+
+	if agent.KnowledgeDenseWeight > 0 {
+		denseResults, errorResponse := s.searchDense(ctx, agent, query, candidates)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+		rankings = append(rankings, Ranking{Results: denseResults, Weight: agent.KnowledgeDenseWeight})
+	}
+
+	keywordResults, errorResponse := s.searchKeywords(ctx, collectionName, query, candidates)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+	rankings = append(rankings, Ranking{Results: keywordResults, Weight: agent.KnowledgeKeywordWeight})
+
+	results := FuseRankings(rankings, limit)
+
+	s.logger.Infof("найдено %d чанков для агента %s гибридным поиском", len(results), collectionName)
+	return results, nil
+}
+
+// searchDense ищет чанки по косинусной близости эмбеддинга запроса с порогом агента
+func (s *Service) searchDense(ctx context.Context, agent *models.Agent, query string, limit int) ([]SearchResult, *utils.UserErrorResponse) {
+	embedder, errorResponse := NewEmbedder(agent)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	vectors, _, errorResponse := s.createEmbeddings(embedder, []string{query})
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	threshold := float32(agent.KnowledgeScoreThreshold)
+
+	results, errorResponse := s.queryPoints(ctx, &qdrant.QueryPoints{
+		CollectionName: agent.ID.String(),
+		Query:          qdrant.NewQuery(vectors[0]...),
+		Limit:          qdrant.PtrOf(uint64(limit)),
+		ScoreThreshold: &threshold,
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	s.logger.Infof("найдено %d чанков для агента %s векторным поиском", len(results), agent.ID)
+	return results, nil
+}
+
+// searchKeywords ищет чанки по совпадению терминов запроса с весами BM25
+func (s *Service) searchKeywords(ctx context.Context, collectionName string, query string, limit int) ([]SearchResult, *utils.UserErrorResponse) {
+	vector := QueryKeywordVector(query)
+	if len(vector.Indices) == 0 {
+		return nil, nil
+	}
+
+	results, errorResponse := s.queryPoints(ctx, &qdrant.QueryPoints{
+		CollectionName: collectionName,
+		Query:          qdrant.NewQuerySparse(vector.Indices, vector.Values),
+		Using:          qdrant.PtrOf(keywordVectorName),
+		Limit:          qdrant.PtrOf(uint64(limit)),
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	s.logger.Infof("найдено %d чанков для агента %s по ключевым словам", len(results), collectionName)
+	return results, nil
+}
+
+func (s *Service) queryPoints(ctx context.Context, request *qdrant.QueryPoints) ([]SearchResult, *utils.UserErrorResponse) {
+	points, err := s.qdrant.Client.Query(ctx, request)
+	if err != nil {
+		s.logger.Errorf("поиск в Qdrant: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка поиска по базе знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	results := make([]SearchResult, 0, len(points))
+	for _, point := range points {
+		results = append(results, SearchResult{
+			ID:    point.GetId().GetUuid(),
+			Text:  point.GetPayload()["text"].GetStringValue(),
+			Score: point.GetScore(),
+		})
+	}
+
+	return results, nil
+}
+
+// FormatSearchResults собирает найденные чанки в блок контекста для системного сообщения
+func FormatSearchResults(results []SearchResult) string {
+	var builder strings.Builder
+
+	builder.WriteString("Информация из базы знаний клиники. Используй её при ответе, если она относится к вопросу:")
+	for i, result := range results {
+		builder.WriteString(fmt.Sprintf("\n\n[%d] %s", i+1, result.Text))
+	}
+
+	return builder.String()
+}
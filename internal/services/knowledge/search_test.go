@@ -0,0 +1,180 @@
+package knowledge
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/qdrant/go-client/qdrant"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestQdrant подключается к Qdrant из QDRANT_TEST_ADDR (host:port gRPC), например к локальному контейнеру:
+//
+//	docker run -p 6334:6334 qdrant/qdrant
+//	QDRANT_TEST_ADDR=localhost:6334 go test ./internal/services/knowledge -run Qdrant
+//
+// Без переменной тест пропускается.
+func newTestQdrant(t *testing.T) *databases.QdrantDatabase {
+	t.Helper()
+
+	address := os.Getenv("QDRANT_TEST_ADDR")
+	if address == "" {
+		t.Skip("QDRANT_TEST_ADDR не задан, тест с Qdrant пропущен")
+	}
+
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatalf("QDRANT_TEST_ADDR: %v", err)
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		t.Fatalf("QDRANT_TEST_ADDR: %v", err)
+	}
+
+	client, err := qdrant.NewClient(&qdrant.Config{
+		Host:                   host,
+		Port:                   port,
+		APIKey:                 os.Getenv("QDRANT_TEST_API_KEY"),
+		SkipCompatibilityCheck: true,
+	})
+	if err != nil {
+		t.Fatalf("подключение к Qdrant: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return &databases.QdrantDatabase{Client: client}
+}
+
+// indexTestKnowledge создает коллекцию агента и загружает в нее чанки текста
+func indexTestKnowledge(t *testing.T, service *Service, agent *models.Agent, content string) {
+	t.Helper()
+	ctx := context.Background()
+
+	embedder, errorResponse := NewEmbedder(agent)
+	if errorResponse != nil {
+		t.Fatal(errorResponse.Details)
+	}
+
+	schema, errorResponse := service.prepareCollection(ctx, agent.ID, embedder)
+	if errorResponse != nil {
+		t.Fatalf("создание коллекции: %s", errorResponse.Details)
+	}
+	t.Cleanup(func() { service.qdrant.Client.DeleteCollection(context.Background(), agent.ID.String()) })
+
+	chunks, errorResponse := service.CreateContentChunks(content, agent.ID, NewChunkingConfig(models.ChunkingStrategyStructure, 120, 0))
+	if errorResponse != nil {
+		t.Fatalf("разбиение на чанки: %s", errorResponse.Details)
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	vectors, _, errorResponse := service.createEmbeddings(embedder, texts)
+	if errorResponse != nil {
+		t.Fatalf("создание эмбеддингов: %s", errorResponse.Details)
+	}
+
+	knowledgeFile := &models.KnowledgeFile{
+		ID:             uuid.New(),
+		AgentID:        agent.ID,
+		OriginalName:   "price.md",
+		CollectionName: agent.ID.String(),
+	}
+
+	points := make([]*qdrant.PointStruct, len(chunks))
+	for i, chunk := range chunks {
+		points[i] = chunkPoint(knowledgeFile, chunk, hashText(chunk.Text), vectors[i], i, len(chunks), schema.Keywords)
+	}
+
+	wait := true
+	_, err := service.qdrant.Client.Upsert(ctx, &qdrant.UpsertPoints{
+		CollectionName: agent.ID.String(),
+		Wait:           &wait,
+		Points:         points,
+	})
+	if err != nil {
+		t.Fatalf("загрузка точек: %v", err)
+	}
+}
+
+func TestSearchKnowledgeQdrant(t *testing.T) {
+	service := NewService(nil, newTestQdrant(t))
+
+	agent := &models.Agent{
+		ID:                     uuid.New(),
+		EmbeddingProvider:      models.EmbeddingProviderHash,
+		EmbeddingDimensions:    256,
+		KnowledgeTopK:          2,
+		KnowledgeDenseWeight:   1,
+		KnowledgeKeywordWeight: 1,
+	}
+
+	indexTestKnowledge(t, service, agent, strings.Join([]string{
+		"# Гигиена",
+		"Профессиональная чистка зубов стоит 5000 тенге и занимает час.",
+		"# Имплантация",
+		"Установка импланта стоит 150000 тенге, гарантия пять лет.",
+		"# Коды услуг",
+		"Услуга A16.07 — пломбирование канала одного зуба.",
+		"# Ортодонтия",
+		"Брекеты подбираются после консультации ортодонта.",
+	}, "\n\n"))
+
+	tests := []struct {
+		name          string
+		denseWeight   float64
+		keywordWeight float64
+		query         string
+		want          string
+	}{
+		{name: "гибридный поиск", denseWeight: 1, keywordWeight: 1, query: "сколько стоит установка импланта", want: "импланта"},
+		{name: "только векторный поиск", denseWeight: 1, keywordWeight: 0, query: "сколько стоит установка импланта", want: "импланта"},
+		{name: "только ключевые слова находят код услуги", denseWeight: 0, keywordWeight: 1, query: "A16.07", want: "A16.07"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			searchAgent := *agent
+			searchAgent.KnowledgeDenseWeight = test.denseWeight
+			searchAgent.KnowledgeKeywordWeight = test.keywordWeight
+
+			results, errorResponse := service.SearchKnowledge(&searchAgent, test.query)
+			if errorResponse != nil {
+				t.Fatalf("поиск: %s", errorResponse.Details)
+			}
+			if len(results) == 0 || len(results) > agent.KnowledgeTopK {
+				t.Fatalf("найдено %d чанков, ожидалось от 1 до %d", len(results), agent.KnowledgeTopK)
+			}
+			if !strings.Contains(results[0].Text, test.want) {
+				t.Errorf("первый результат %q, ожидался чанк с %q", results[0].Text, test.want)
+			}
+		})
+	}
+
+	t.Run("нулевые веса отключают поиск", func(t *testing.T) {
+		searchAgent := *agent
+		searchAgent.KnowledgeDenseWeight = 0
+		searchAgent.KnowledgeKeywordWeight = 0
+
+		results, errorResponse := service.SearchKnowledge(&searchAgent, "сколько стоит установка импланта")
+		if errorResponse != nil || len(results) != 0 {
+			t.Errorf("результаты %v, ошибка %v, ожидался пустой результат", results, errorResponse)
+		}
+	})
+
+	t.Run("агент без коллекции", func(t *testing.T) {
+		searchAgent := *agent
+		searchAgent.ID = uuid.New()
+
+		results, errorResponse := service.SearchKnowledge(&searchAgent, "импланта")
+		if errorResponse != nil || len(results) != 0 {
+			t.Errorf("результаты %v, ошибка %v, ожидался пустой результат", results, errorResponse)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package knowledge
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+	"strings"
+	"time"
+)
+
+type CreateKnowledgeSourceRequest struct {
+	AgentID              string          `json:"agent_id" validate:"required,uuid"`
+	URL                  string          `json:"url" validate:"required,http_url"`
+	Type                 string          `json:"type" validate:"omitempty,oneof=page sitemap"`
+	MaxPages             int             `json:"max_pages" validate:"gte=0,lte=1000"`
+	RefreshIntervalHours int             `json:"refresh_interval_hours" validate:"gte=0,lte=720"`
+	Chunking             ChunkingRequest `json:"chunking"`
+}
+
+type GetKnowledgeSourcesRequest struct {
+	AgentID string `json:"agent_id" validate:"required,uuid"`
+}
+
+type KnowledgeSourceRequest struct {
+	AgentID  string `json:"agent_id" validate:"required,uuid"`
+	SourceID string `json:"source_id" validate:"required,uuid"`
+}
+
+// CreateKnowledgeSource добавляет сайт в базу знаний агента и ставит его первую загрузку в очередь.
+// Если тип не указан, адрес, оканчивающийся на .xml или .xml.gz, считается sitemap.
+func (s *Service) CreateKnowledgeSource(request *CreateKnowledgeSourceRequest, scheduler *SourceScheduler) (*models.KnowledgeSource, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+	currentAgent, errorResponse := agent.NewService().
+		GetAgent(agentUUID, s.postgres)
+
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	var count int64
+	err := s.postgres.DB.
+		Model(&models.KnowledgeSource{}).
+		Where("agent_id = ? AND url = ?", agentUUID, request.URL).
+		Count(&count).Error
+
+	if err != nil {
+		s.logger.Errorf("проверка источников агента %s: %v", agentUUID, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка добавления источника",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	if count > 0 {
+		return nil, utils.NewUserErrorResponse(
+			409,
+			"Источник уже добавлен",
+			"Этот адрес уже загружается в базу знаний агента.",
+		)
+	}
+
+	sourceType := request.Type
+	if sourceType == "" {
+		sourceType = models.KnowledgeSourceTypePage
+		lowerURL := strings.ToLower(request.URL)
+		if strings.HasSuffix(lowerURL, ".xml") || strings.HasSuffix(lowerURL, ".xml.gz") {
+			sourceType = models.KnowledgeSourceTypeSitemap
+		}
+	}
+
+	chunking := resolveChunking(request.Chunking, currentAgent)
+
+	source := models.KnowledgeSource{
+		AgentID:              agentUUID,
+		URL:                  request.URL,
+		Type:                 sourceType,
+		MaxPages:             request.MaxPages,
+		RefreshIntervalHours: request.RefreshIntervalHours,
+		ChunkingStrategy:     chunking.ChunkingStrategy,
+		ChunkSize:            chunking.ChunkSize,
+		ChunkOverlap:         chunking.ChunkOverlap,
+		Status:               models.KnowledgeFileStatusQueued,
+		NextFetchAt:          time.Now(),
+	}
+
+	if err := s.postgres.DB.Create(&source).Error; err != nil {
+		s.logger.Errorf("создание источника %s: %v", request.URL, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка добавления источника",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	scheduler.Schedule(source.ID)
+	s.logger.Infof("добавлен источник %s (%s) агента %s", source.URL, source.Type, agentUUID)
+
+	return &source, nil
+}
+
+// GetKnowledgeSources возвращает сайты, загружаемые в базу знаний агента
+func (s *Service) GetKnowledgeSources(request *GetKnowledgeSourcesRequest) ([]models.KnowledgeSource, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(request.AgentID)
+
+	sources := []models.KnowledgeSource{}
+	err := s.postgres.DB.
+		Where("agent_id = ?", agentUUID).
+		Order("created_at").
+		Find(&sources).Error
+
+	if err != nil {
+		s.logger.Errorf("получение источников агента %s: %v", agentUUID, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения источников",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return sources, nil
+}
+
+// RefreshKnowledgeSource ставит внеочередное обновление источника
+func (s *Service) RefreshKnowledgeSource(request *KnowledgeSourceRequest, scheduler *SourceScheduler) (*models.KnowledgeSource, *utils.UserErrorResponse) {
+	source, errorResponse := s.getKnowledgeSource(request.AgentID, request.SourceID)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	if source.Status == models.KnowledgeFileStatusProcessing {
+		return nil, utils.NewUserErrorResponse(
+			409,
+			"Источник обновляется",
+			"Дождитесь завершения текущего обновления источника.",
+		)
+	}
+
+	source.NextFetchAt = time.Now()
+	if err := s.postgres.DB.Model(source).Update("next_fetch_at", source.NextFetchAt).Error; err != nil {
+		s.logger.Errorf("обновление источника %s: %v", source.ID, err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка обновления источника",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	scheduler.Schedule(source.ID)
+	return source, nil
+}
+
+// DeleteKnowledgeSource удаляет источник вместе с загруженными из него страницами
+func (s *Service) DeleteKnowledgeSource(request *KnowledgeSourceRequest) *utils.UserErrorResponse {
+	source, errorResponse := s.getKnowledgeSource(request.AgentID, request.SourceID)
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	if source.Status == models.KnowledgeFileStatusProcessing {
+		return utils.NewUserErrorResponse(
+			409,
+			"Источник обновляется",
+			"Дождитесь завершения текущего обновления источника.",
+		)
+	}
+
+	var knowledgeFiles []models.KnowledgeFile
+	if err := s.postgres.DB.Where("source_id = ?", source.ID).Find(&knowledgeFiles).Error; err != nil {
+		s.logger.Errorf("получение страниц источника %s: %v", source.ID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления источника",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	for i := range knowledgeFiles {
+		if errorResponse := s.removeKnowledgeFile(&knowledgeFiles[i]); errorResponse != nil {
+			return errorResponse
+		}
+	}
+
+	if err := s.postgres.DB.Delete(source).Error; err != nil {
+		s.logger.Errorf("удаление источника %s: %v", source.ID, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка удаления источника",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	s.logger.Infof("удален источник %s агента %s", source.URL, source.AgentID)
+	return nil
+}
+
+// getKnowledgeSource находит источник, принадлежащий агенту
+func (s *Service) getKnowledgeSource(agentID string, sourceID string) (*models.KnowledgeSource, *utils.UserErrorResponse) {
+	agentUUID, _ := uuid.Parse(agentID)
+	sourceUUID, _ := uuid.Parse(sourceID)
+
+	var source models.KnowledgeSource
+
+	err := s.postgres.DB.
+		Where("id = ? AND agent_id = ?", sourceUUID, agentUUID).
+		First(&source).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewUserErrorResponse(
+				404,
+				"Источник не найден",
+				"Указанный источник не существует или был удален.",
+			)
+		}
+
+		s.logger.Errorf("получение источника: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка получения источника",
+			"Пожалуйста, повторите попытку позже",
+		)
+	}
+
+	return &source, nil
+}
@@ -0,0 +1,332 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"net/url"
+	"path"
+	"time"
+)
+
+// sourceRefreshTimeout ограничивает загрузку всех страниц одного источника
+const sourceRefreshTimeout = 30 * time.Minute
+
+// refreshSource загружает страницы источника и ставит в очередь индексации новые и изменившиеся страницы.
+// Страницы, пропавшие из sitemap, удаляются из базы знаний.
+func (s *Service) refreshSource(sourceID uuid.UUID, fetcher *WebFetcher, queue *IngestionQueue) {
+	source, ok := s.claimSource(sourceID)
+	if !ok {
+		return
+	}
+
+	if s.agentDeleted(source.AgentID) {
+		s.logger.Infof("агент источника %s удален, обновление пропущено", source.URL)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sourceRefreshTimeout)
+	defer cancel()
+
+	var pageCount, failedPages int
+	var errorResponse *utils.UserErrorResponse
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				s.logger.Errorf("паника при обновлении источника %s: %v", source.ID, recovered)
+				errorResponse = utils.NewUserErrorResponse(500, "Ошибка обновления источника", "Внутренняя ошибка")
+			}
+		}()
+
+		store := &postgresPageStore{service: s, queue: queue}
+		pageCount, failedPages, errorResponse = s.syncSourcePages(ctx, source, fetcher, store)
+	}()
+
+	s.finishSource(source, pageCount, failedPages, errorResponse)
+}
+
+// sourcePageStore хранит страницы источника в базе знаний
+type sourcePageStore interface {
+	// Pages возвращает загруженные ранее страницы источника
+	Pages(source *models.KnowledgeSource) ([]models.KnowledgeFile, *utils.UserErrorResponse)
+	// Queue ставит в очередь индексации новую страницу, если knowledgeFile равен nil, или новое содержимое страницы
+	Queue(source *models.KnowledgeSource, pageURL string, knowledgeFile *models.KnowledgeFile, file *extractedFile, chunking ChunkingRequest) *utils.UserErrorResponse
+	// Remove удаляет страницу, пропавшую с сайта
+	Remove(knowledgeFile *models.KnowledgeFile) *utils.UserErrorResponse
+}
+
+// claimSource атомарно переводит источник, время обновления которого наступило, в обработку
+func (s *Service) claimSource(sourceID uuid.UUID) (*models.KnowledgeSource, bool) {
+	result := s.postgres.DB.
+		Model(&models.KnowledgeSource{}).
+		Where("id = ? AND status <> ? AND next_fetch_at <= ?", sourceID, models.KnowledgeFileStatusProcessing, time.Now()).
+		Update("status", models.KnowledgeFileStatusProcessing)
+
+	if result.Error != nil {
+		s.logger.Errorf("получение источника %s: %v", sourceID, result.Error)
+		return nil, false
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, false
+	}
+
+	var source models.KnowledgeSource
+	if err := s.postgres.DB.First(&source, "id = ?", sourceID).Error; err != nil {
+		s.logger.Errorf("получение источника %s: %v", sourceID, err)
+		return nil, false
+	}
+
+	s.logger.Infof("начато обновление источника %s", source.URL)
+	return &source, true
+}
+
+// syncSourcePages загружает страницы источника и передает в store новые и изменившиеся страницы.
+// Возвращает количество страниц и количество страниц, которые не удалось загрузить.
+func (s *Service) syncSourcePages(
+	ctx context.Context,
+	source *models.KnowledgeSource,
+	fetcher *WebFetcher,
+	store sourcePageStore,
+) (int, int, *utils.UserErrorResponse) {
+	urls := []string{source.URL}
+	if source.Type == models.KnowledgeSourceTypeSitemap {
+		var err error
+		urls, err = fetcher.SitemapURLs(ctx, source.URL, source.MaxPages)
+		if err != nil {
+			s.logger.Errorf("загрузка sitemap %s: %v", source.URL, err)
+			return 0, 0, utils.NewUserErrorResponse(502, "Не удалось загрузить sitemap", err.Error())
+		}
+	}
+
+	knowledgeFiles, errorResponse := store.Pages(source)
+	if errorResponse != nil {
+		return 0, 0, errorResponse
+	}
+
+	existing := make(map[string]*models.KnowledgeFile, len(knowledgeFiles))
+	for i := range knowledgeFiles {
+		existing[knowledgeFiles[i].SourceURL] = &knowledgeFiles[i]
+	}
+
+	chunking := ChunkingRequest{
+		ChunkingStrategy: source.ChunkingStrategy,
+		ChunkSize:        source.ChunkSize,
+		ChunkOverlap:     source.ChunkOverlap,
+	}
+
+	failedPages := 0
+	current := make(map[string]bool, len(urls))
+	var lastFailure *utils.UserErrorResponse
+
+	for _, pageURL := range urls {
+		current[pageURL] = true
+
+		if errorResponse := s.ingestSourcePage(ctx, source, pageURL, existing[pageURL], fetcher, store, chunking); errorResponse != nil {
+			s.logger.Warnf("страница %s не загружена: %s", pageURL, errorResponse.Details)
+			failedPages++
+			lastFailure = errorResponse
+		}
+	}
+
+	if failedPages == len(urls) {
+		return len(urls), failedPages, lastFailure
+	}
+
+	for sourceURL, knowledgeFile := range existing {
+		if current[sourceURL] {
+			continue
+		}
+
+		s.logger.Infof("страница %s удалена с сайта, удаляем ее из базы знаний", sourceURL)
+		if errorResponse := store.Remove(knowledgeFile); errorResponse != nil {
+			s.logger.Warnf("удаление страницы %s: %s", sourceURL, errorResponse.Details)
+		}
+	}
+
+	return len(urls), failedPages, nil
+}
+
+// ingestSourcePage загружает страницу и передает ее в store, если она новая или изменилась
+func (s *Service) ingestSourcePage(
+	ctx context.Context,
+	source *models.KnowledgeSource,
+	pageURL string,
+	knowledgeFile *models.KnowledgeFile,
+	fetcher *WebFetcher,
+	store sourcePageStore,
+	chunking ChunkingRequest,
+) *utils.UserErrorResponse {
+	page, err := fetcher.Fetch(ctx, pageURL)
+	if err != nil {
+		return utils.NewUserErrorResponse(502, "Не удалось загрузить страницу", err.Error())
+	}
+
+	file, errorResponse := s.extractPageText(page)
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	if knowledgeFile != nil && knowledgeFile.ContentHash == hashText(file.Text) &&
+		knowledgeFile.Status != models.KnowledgeFileStatusFailed {
+		return nil
+	}
+
+	return store.Queue(source, pageURL, knowledgeFile, file, chunking)
+}
+
+// postgresPageStore хранит страницы источника как файлы базы знаний и индексирует их через IngestionQueue
+type postgresPageStore struct {
+	service *Service
+	queue   *IngestionQueue
+}
+
+func (ps *postgresPageStore) Pages(source *models.KnowledgeSource) ([]models.KnowledgeFile, *utils.UserErrorResponse) {
+	var knowledgeFiles []models.KnowledgeFile
+
+	if err := ps.service.postgres.DB.Where("source_id = ?", source.ID).Find(&knowledgeFiles).Error; err != nil {
+		ps.service.logger.Errorf("получение страниц источника %s: %v", source.ID, err)
+		return nil, utils.NewUserErrorResponse(500, "Ошибка обновления источника", "Внутренняя ошибка")
+	}
+
+	return knowledgeFiles, nil
+}
+
+func (ps *postgresPageStore) Queue(
+	source *models.KnowledgeSource,
+	pageURL string,
+	knowledgeFile *models.KnowledgeFile,
+	file *extractedFile,
+	chunking ChunkingRequest,
+) *utils.UserErrorResponse {
+	s := ps.service
+
+	// Агента могли удалить во время обновления источника
+	if s.agentDeleted(source.AgentID) {
+		return utils.NewUserErrorResponse(410, "Обновление отменено", "Агент удален")
+	}
+
+	operation := models.KnowledgeJobOperationUpload
+	if knowledgeFile != nil {
+		active, errorResponse := s.hasActiveJob(knowledgeFile.ID)
+		if errorResponse != nil {
+			return errorResponse
+		}
+		if active {
+			return nil
+		}
+
+		operation = models.KnowledgeJobOperationReplace
+	} else {
+		knowledgeFile = &models.KnowledgeFile{
+			AgentID:        source.AgentID,
+			FileName:       file.Name,
+			OriginalName:   file.Name,
+			FileSize:       file.Size,
+			FileType:       file.Type,
+			ContentHash:    hashText(file.Text),
+			SourceID:       &source.ID,
+			SourceURL:      pageURL,
+			CollectionName: source.AgentID.String(),
+			Status:         models.KnowledgeFileStatusQueued,
+		}
+
+		if errorResponse := s.createKnowledgeFile(knowledgeFile); errorResponse != nil {
+			return errorResponse
+		}
+	}
+
+	job, errorResponse := s.createJob(knowledgeFile, operation, *file, chunking)
+	if errorResponse != nil {
+		if operation == models.KnowledgeJobOperationUpload {
+			s.finishKnowledgeFile(knowledgeFile, 0, errorResponse)
+		}
+		return errorResponse
+	}
+
+	ps.queue.Enqueue(job.ID)
+	s.logger.Infof("страница %s поставлена в очередь индексации, задача %s", pageURL, job.ID)
+
+	return nil
+}
+
+func (ps *postgresPageStore) Remove(knowledgeFile *models.KnowledgeFile) *utils.UserErrorResponse {
+	if ps.service.agentDeleted(knowledgeFile.AgentID) {
+		return utils.NewUserErrorResponse(410, "Обновление отменено", "Агент удален")
+	}
+
+	return ps.service.removeKnowledgeFile(knowledgeFile)
+}
+
+// extractPageText извлекает основной текст HTML страницы, а документы по ссылкам разбирает как загруженные файлы
+func (s *Service) extractPageText(page *webPage) (*extractedFile, *utils.UserErrorResponse) {
+	name := page.URL
+	if parsed, err := url.Parse(page.URL); err == nil && path.Base(parsed.Path) != "/" && path.Base(parsed.Path) != "." {
+		name = path.Base(parsed.Path)
+	}
+
+	file := Knowledge{
+		Name:    name,
+		Size:    int64(len(page.Content)),
+		Type:    page.ContentType,
+		Content: page.Content,
+	}
+
+	mimeType := DetectMIMEType(file)
+	if mimeType != MIMEHTML {
+		text, mimeType, errorResponse := s.ExtractText(file)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		file.Type = mimeType
+		return &extractedFile{Knowledge: file, Text: text}, nil
+	}
+
+	title, text, err := extractWebPage(page.Content)
+	if err != nil {
+		s.logger.Errorf("разбор страницы %s: %v", page.URL, err)
+		return nil, utils.NewUserErrorResponse(400, "Не удалось прочитать страницу", "Страница "+page.URL+" имеет неверный формат.")
+	}
+
+	if text == "" {
+		return nil, utils.NewUserErrorResponse(400, "Страница не содержит текста", "На странице "+page.URL+" не найден текст.")
+	}
+
+	file.Type = MIMEHTML
+	if title != "" {
+		file.Name = title
+	}
+
+	// Текст страницы начинается с ее адреса, чтобы модель могла сослаться на источник
+	return &extractedFile{Knowledge: file, Text: fmt.Sprintf("Источник: %s\n\n%s", page.URL, text)}, nil
+}
+
+// finishSource записывает итог обновления и время следующего обновления источника
+func (s *Service) finishSource(source *models.KnowledgeSource, pageCount int, failedPages int, failure *utils.UserErrorResponse) {
+	now := time.Now()
+	interval := time.Duration(source.RefreshIntervalHours) * time.Hour
+
+	updates := map[string]interface{}{
+		"status":          models.KnowledgeFileStatusCompleted,
+		"page_count":      pageCount,
+		"failed_pages":    failedPages,
+		"failure_reason":  "",
+		"last_fetched_at": now,
+		"next_fetch_at":   now.Add(interval),
+	}
+
+	if failure != nil {
+		updates["status"] = models.KnowledgeFileStatusFailed
+		updates["failure_reason"] = failure.Message + ": " + failure.Details
+	}
+
+	if err := s.postgres.DB.Model(source).Updates(updates).Error; err != nil {
+		s.logger.Errorf("обновление статуса источника %s: %v", source.ID, err)
+	}
+
+	s.logger.Infof("обновлен источник %s: страниц %d, с ошибкой %d", source.URL, pageCount, failedPages)
+}
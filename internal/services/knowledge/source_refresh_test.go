@@ -0,0 +1,154 @@
+package knowledge
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakePageStore хранит страницы источника в памяти и запоминает изменения
+type fakePageStore struct {
+	pages    []models.KnowledgeFile
+	queued   []string
+	replaced []uuid.UUID
+	removed  []string
+}
+
+func (ps *fakePageStore) Pages(*models.KnowledgeSource) ([]models.KnowledgeFile, *utils.UserErrorResponse) {
+	return ps.pages, nil
+}
+
+func (ps *fakePageStore) Queue(
+	_ *models.KnowledgeSource,
+	pageURL string,
+	knowledgeFile *models.KnowledgeFile,
+	_ *extractedFile,
+	_ ChunkingRequest,
+) *utils.UserErrorResponse {
+	ps.queued = append(ps.queued, pageURL)
+	if knowledgeFile != nil {
+		ps.replaced = append(ps.replaced, knowledgeFile.ID)
+	}
+	return nil
+}
+
+func (ps *fakePageStore) Remove(knowledgeFile *models.KnowledgeFile) *utils.UserErrorResponse {
+	ps.removed = append(ps.removed, knowledgeFile.SourceURL)
+	return nil
+}
+
+func pageHTML(title string, text string) string {
+	return "<html><head><title>" + title + "</title></head><body><main><p>" + text + "</p></main></body></html>"
+}
+
+func TestSyncSourcePages(t *testing.T) {
+	server := newSiteServer(t, map[string]string{
+		"/sitemap.xml": urlSet("{site}/prices", "{site}/implants", "{site}/contacts"),
+		"/prices":      pageHTML("Цены", "Чистка зубов стоит 5000 тенге."),
+		"/implants":    pageHTML("Имплантация", "Установка импланта стоит 160000 тенге."),
+		"/contacts":    pageHTML("Контакты", "Клиника работает с 9 до 21 часа."),
+	})
+
+	service := NewService(nil, nil)
+	fetcher := NewWebFetcher(true)
+
+	// Хеш текущего текста страницы цен: она не изменилась с прошлой загрузки
+	page, err := fetcher.Fetch(context.Background(), server.URL+"/prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices, errorResponse := service.extractPageText(page)
+	if errorResponse != nil {
+		t.Fatal(errorResponse.Details)
+	}
+
+	implantsID := uuid.New()
+	store := &fakePageStore{
+		pages: []models.KnowledgeFile{
+			{ID: uuid.New(), SourceURL: server.URL + "/prices", ContentHash: hashText(prices.Text), Status: models.KnowledgeFileStatusCompleted},
+			{ID: implantsID, SourceURL: server.URL + "/implants", ContentHash: hashText("старый прайс"), Status: models.KnowledgeFileStatusCompleted},
+			{ID: uuid.New(), SourceURL: server.URL + "/promo", ContentHash: hashText("акция"), Status: models.KnowledgeFileStatusCompleted},
+		},
+	}
+
+	source := &models.KnowledgeSource{
+		ID:       uuid.New(),
+		URL:      server.URL + "/sitemap.xml",
+		Type:     models.KnowledgeSourceTypeSitemap,
+		MaxPages: 10,
+	}
+
+	pageCount, failedPages, errorResponse := service.syncSourcePages(context.Background(), source, fetcher, store)
+	if errorResponse != nil {
+		t.Fatalf("неожиданная ошибка: %s", errorResponse.Details)
+	}
+	if pageCount != 3 || failedPages != 0 {
+		t.Errorf("страниц %d, с ошибкой %d, ожидалось 3 и 0", pageCount, failedPages)
+	}
+
+	if want := []string{server.URL + "/implants", server.URL + "/contacts"}; !slices.Equal(store.queued, want) {
+		t.Errorf("в очередь поставлены %v, ожидались измененная и новая страницы %v", store.queued, want)
+	}
+	if !slices.Equal(store.replaced, []uuid.UUID{implantsID}) {
+		t.Errorf("заменены файлы %v, ожидалась только измененная страница", store.replaced)
+	}
+	if want := []string{server.URL + "/promo"}; !slices.Equal(store.removed, want) {
+		t.Errorf("удалены %v, ожидалась пропавшая с сайта страница %v", store.removed, want)
+	}
+}
+
+func TestSyncSourcePagesFailedPageIsRetried(t *testing.T) {
+	server := newSiteServer(t, map[string]string{
+		"/prices": pageHTML("Цены", "Чистка зубов стоит 5000 тенге."),
+	})
+
+	service := NewService(nil, nil)
+	fetcher := NewWebFetcher(true)
+
+	page, _ := fetcher.Fetch(context.Background(), server.URL+"/prices")
+	prices, _ := service.extractPageText(page)
+
+	// Содержимое не изменилось, но прошлая индексация завершилась ошибкой
+	store := &fakePageStore{
+		pages: []models.KnowledgeFile{
+			{ID: uuid.New(), SourceURL: server.URL + "/prices", ContentHash: hashText(prices.Text), Status: models.KnowledgeFileStatusFailed},
+		},
+	}
+	source := &models.KnowledgeSource{ID: uuid.New(), URL: server.URL + "/prices", Type: models.KnowledgeSourceTypePage}
+
+	if _, _, errorResponse := service.syncSourcePages(context.Background(), source, fetcher, store); errorResponse != nil {
+		t.Fatalf("неожиданная ошибка: %s", errorResponse.Details)
+	}
+	if len(store.queued) != 1 || len(store.removed) != 0 {
+		t.Errorf("в очередь поставлены %v, удалены %v, ожидалась повторная индексация страницы", store.queued, store.removed)
+	}
+}
+
+// Если не загрузилась ни одна страница, сайт, вероятно, недоступен: страницы не удаляются
+func TestSyncSourcePagesAllPagesFailed(t *testing.T) {
+	server := newSiteServer(t, map[string]string{
+		"/sitemap.xml": urlSet("{site}/prices", "{site}/implants"),
+	})
+
+	store := &fakePageStore{
+		pages: []models.KnowledgeFile{
+			{ID: uuid.New(), SourceURL: server.URL + "/promo", Status: models.KnowledgeFileStatusCompleted},
+		},
+	}
+	source := &models.KnowledgeSource{ID: uuid.New(), URL: server.URL + "/sitemap.xml", Type: models.KnowledgeSourceTypeSitemap, MaxPages: 10}
+
+	pageCount, failedPages, errorResponse := NewService(nil, nil).syncSourcePages(context.Background(), source, NewWebFetcher(true), store)
+	if errorResponse == nil || !strings.Contains(errorResponse.Details, "404") {
+		t.Errorf("ошибка %v, ожидалась ошибка загрузки страницы", errorResponse)
+	}
+	if pageCount != 2 || failedPages != 2 {
+		t.Errorf("страниц %d, с ошибкой %d, ожидалось 2 и 2", pageCount, failedPages)
+	}
+	if len(store.queued) != 0 || len(store.removed) != 0 {
+		t.Errorf("в очередь поставлены %v, удалены %v, ожидалось без изменений", store.queued, store.removed)
+	}
+}
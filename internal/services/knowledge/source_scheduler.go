@@ -0,0 +1,111 @@
+package knowledge
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"macdent-ai-chatbot/internal/databases"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// Параметры периодического обновления источников
+const (
+	sourceQueueSize    = 100
+	sourcePollInterval = 5 * time.Minute
+)
+
+// SourceScheduler обновляет сайты, загружаемые в базу знаний. Время следующего обновления хранится
+// в Postgres, поэтому расписание переживает перезапуск. Найденные страницы индексирует IngestionQueue.
+type SourceScheduler struct {
+	logger    *log.Logger
+	service   *Service
+	fetcher   *WebFetcher
+	ingestion *IngestionQueue
+	sources   chan uuid.UUID
+}
+
+func NewSourceScheduler(postgres *databases.PostgresDatabase, qdrant *databases.QdrantDatabase, ingestion *IngestionQueue) *SourceScheduler {
+	return &SourceScheduler{
+		logger:    utils.NewLogger("sources"),
+		service:   NewService(postgres, qdrant),
+		fetcher:   NewWebFetcher(false),
+		ingestion: ingestion,
+		sources:   make(chan uuid.UUID, sourceQueueSize),
+	}
+}
+
+// Start возвращает в очередь источники, прерванные перезапуском, и запускает обновление по расписанию.
+// Источники обновляются по одному, чтобы не нагружать сайты клиник.
+func (sc *SourceScheduler) Start() {
+	sc.resumeInterrupted()
+
+	go sc.work()
+	go sc.poll()
+}
+
+// Schedule передает источник на обновление, не блокируя запрос
+func (sc *SourceScheduler) Schedule(sourceID uuid.UUID) {
+	select {
+	case sc.sources <- sourceID:
+	default:
+		sc.logger.Warnf("очередь источников заполнена, источник %s будет взят при следующем опросе", sourceID)
+	}
+}
+
+func (sc *SourceScheduler) work() {
+	for sourceID := range sc.sources {
+		sc.service.refreshSource(sourceID, sc.fetcher, sc.ingestion)
+	}
+}
+
+// poll периодически передает на обновление источники, время обновления которых наступило
+func (sc *SourceScheduler) poll() {
+	ticker := time.NewTicker(sourcePollInterval)
+	defer ticker.Stop()
+
+	for {
+		sc.scheduleDue()
+		<-ticker.C
+	}
+}
+
+func (sc *SourceScheduler) scheduleDue() {
+	var sourceIDs []uuid.UUID
+
+	err := sc.service.postgres.DB.
+		Model(&models.KnowledgeSource{}).
+		Where("status <> ? AND next_fetch_at <= ?", models.KnowledgeFileStatusProcessing, time.Now()).
+		Order("next_fetch_at").
+		Limit(sourceQueueSize).
+		Pluck("id", &sourceIDs).Error
+
+	if err != nil {
+		sc.logger.Errorf("получение источников для обновления: %v", err)
+		return
+	}
+
+	for _, sourceID := range sourceIDs {
+		sc.Schedule(sourceID)
+	}
+}
+
+// resumeInterrupted возвращает в очередь источники, обновление которых прервала остановка сервиса
+func (sc *SourceScheduler) resumeInterrupted() {
+	result := sc.service.postgres.DB.
+		Model(&models.KnowledgeSource{}).
+		Where("status = ?", models.KnowledgeFileStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":        models.KnowledgeFileStatusQueued,
+			"next_fetch_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		sc.logger.Errorf("возобновление прерванных обновлений источников: %v", result.Error)
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		sc.logger.Infof("возобновлено %d прерванных обновлений источников", result.RowsAffected)
+	}
+}
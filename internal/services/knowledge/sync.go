@@ -0,0 +1,232 @@
+package knowledge
+
+import (
+	"context"
+	"github.com/qdrant/go-client/qdrant"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// payloadBatchSize ограничивает число операций обновления payload в одном запросе к Qdrant
+const payloadBatchSize = 100
+
+// fileChunksPlan описывает, как привести точки файла в коллекции к новому набору чанков
+type fileChunksPlan struct {
+	// Chunks — новые чанки файла без повторов, в порядке следования в файле
+	Chunks []Chunk
+	// Hashes — хеши текстов Chunks
+	Hashes []string
+	// Changed — чанки, которых еще нет в коллекции и для которых нужны эмбеддинги
+	Changed []Chunk
+	// Existing — точки файла, уже сохраненные в коллекции, по идентификатору
+	Existing map[string]*qdrant.RetrievedPoint
+	// Stale — идентификаторы точек, которых нет среди новых чанков
+	Stale []*qdrant.PointId
+}
+
+// planFileChunks сравнивает новые чанки файла с точками в коллекции. Идентификатор точки зависит
+// от текста чанка, поэтому неизменившиеся чанки находятся без повторного создания эмбеддингов.
+func (s *Service) planFileChunks(ctx context.Context, knowledgeFile *models.KnowledgeFile, chunks []Chunk) (*fileChunksPlan, *utils.UserErrorResponse) {
+	points, errorResponse := s.scrollFilePoints(ctx, knowledgeFile)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	plan := &fileChunksPlan{
+		Existing: make(map[string]*qdrant.RetrievedPoint, len(points)),
+	}
+	for _, point := range points {
+		plan.Existing[point.GetId().GetUuid()] = point
+	}
+
+	seen := make(map[string]bool, len(chunks))
+	for _, chunk := range chunks {
+		hash := hashText(chunk.Text)
+		if seen[hash] {
+			// Повторяющийся текст дал бы в поиске одинаковые результаты
+			continue
+		}
+		seen[hash] = true
+
+		plan.Chunks = append(plan.Chunks, chunk)
+		plan.Hashes = append(plan.Hashes, hash)
+
+		if _, ok := plan.Existing[chunkPointID(knowledgeFile.AgentID, knowledgeFile.ID, hash)]; !ok {
+			plan.Changed = append(plan.Changed, chunk)
+		}
+	}
+
+	current := make(map[string]bool, len(plan.Chunks))
+	for _, hash := range plan.Hashes {
+		current[chunkPointID(knowledgeFile.AgentID, knowledgeFile.ID, hash)] = true
+	}
+	for id, point := range plan.Existing {
+		if !current[id] {
+			plan.Stale = append(plan.Stale, point.GetId())
+		}
+	}
+
+	s.logger.Infof("файл %s: %d чанков, из них новых %d, устаревших точек %d",
+		knowledgeFile.ID, len(plan.Chunks), len(plan.Changed), len(plan.Stale))
+	return plan, nil
+}
+
+// applyFileChunks сохраняет новые чанки, обновляет позиции неизменившихся и удаляет устаревшие.
+// Устаревшие точки удаляются последними, поэтому до конца обработки в поиске остается прежнее содержимое.
+func (s *Service) applyFileChunks(
+	ctx context.Context,
+	knowledgeFile *models.KnowledgeFile,
+	plan *fileChunksPlan,
+	results []EmbeddingResult,
+	keywords bool,
+) *utils.UserErrorResponse {
+	vectors := make(map[string][]float32, len(results))
+	for _, result := range results {
+		vectors[hashText(result.Chunk.Text)] = result.Vector
+	}
+
+	var points []*qdrant.PointStruct
+	var updates []*qdrant.PointsUpdateOperation
+	total := len(plan.Chunks)
+
+	for position, chunk := range plan.Chunks {
+		hash := plan.Hashes[position]
+		id := chunkPointID(knowledgeFile.AgentID, knowledgeFile.ID, hash)
+
+		if existing, ok := plan.Existing[id]; ok {
+			payload := chunkPositionPayload(knowledgeFile, chunk, position, total)
+			if !payloadMatches(existing.GetPayload(), payload) {
+				updates = append(updates, qdrant.NewPointsUpdateSetPayload(&qdrant.PointsUpdateOperation_SetPayload{
+					Payload:        payload,
+					PointsSelector: qdrant.NewPointsSelector(existing.GetId()),
+				}))
+			}
+			continue
+		}
+
+		vector, ok := vectors[hash]
+		if !ok {
+			s.logger.Errorf("нет эмбеддинга для чанка %d файла %s", position, knowledgeFile.ID)
+			return utils.NewUserErrorResponse(500, "Ошибка обработки эмбеддингов", "Внутренняя ошибка")
+		}
+
+		points = append(points, chunkPoint(knowledgeFile, chunk, hash, vector, position, total, keywords))
+	}
+
+	if len(points) > 0 {
+		if errorResponse := s.UpsertPoints(ctx, knowledgeFile.AgentID, points); errorResponse != nil {
+			return errorResponse
+		}
+	}
+
+	if errorResponse := s.updatePayloads(ctx, knowledgeFile, updates); errorResponse != nil {
+		return errorResponse
+	}
+
+	if len(plan.Stale) > 0 {
+		wait := true
+		_, err := s.qdrant.Client.Delete(ctx, &qdrant.DeletePoints{
+			CollectionName: knowledgeFile.CollectionName,
+			Wait:           &wait,
+			Points:         qdrant.NewPointsSelectorIDs(plan.Stale),
+		})
+		if err != nil {
+			s.logger.Errorf("удаление устаревших чанков файла %s из Qdrant: %v", knowledgeFile.ID, err)
+			return utils.NewUserErrorResponse(
+				500,
+				"Ошибка удаления чанков файла",
+				"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+			)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) updatePayloads(ctx context.Context, knowledgeFile *models.KnowledgeFile, updates []*qdrant.PointsUpdateOperation) *utils.UserErrorResponse {
+	for i := 0; i < len(updates); i += payloadBatchSize {
+		end := min(i+payloadBatchSize, len(updates))
+
+		wait := true
+		_, err := s.qdrant.Client.UpdateBatch(ctx, &qdrant.UpdateBatchPoints{
+			CollectionName: knowledgeFile.CollectionName,
+			Wait:           &wait,
+			Operations:     updates[i:end],
+		})
+		if err != nil {
+			s.logger.Errorf("обновление позиций чанков файла %s в Qdrant: %v", knowledgeFile.ID, err)
+			return utils.NewUserErrorResponse(
+				500,
+				"Ошибка загрузки базы знаний",
+				"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+			)
+		}
+	}
+
+	return nil
+}
+
+// chunkPoint создает точку чанка. Если коллекция поддерживает поиск по ключевым словам,
+// точка хранит и разреженный вектор терминов чанка.
+func chunkPoint(
+	knowledgeFile *models.KnowledgeFile,
+	chunk Chunk,
+	hash string,
+	vector []float32,
+	position int,
+	total int,
+	keywords bool,
+) *qdrant.PointStruct {
+	vectors := qdrant.NewVectors(vector...)
+	if keywords {
+		keywordVector := DocumentKeywordVector(chunk.Text)
+		vectors = qdrant.NewVectorsMap(map[string]*qdrant.Vector{
+			"":                qdrant.NewVectorDense(vector),
+			keywordVectorName: qdrant.NewVectorSparse(keywordVector.Indices, keywordVector.Values),
+		})
+	}
+
+	payload := chunkPositionPayload(knowledgeFile, chunk, position, total)
+	for key, value := range qdrant.NewValueMap(map[string]any{
+		"text":         chunk.Text,
+		"content_hash": hash,
+		"char_count":   int64(chunk.Metadata["char_count"].(int)),
+		"word_count":   int64(chunk.Metadata["word_count"].(int)),
+		"agent_id":     knowledgeFile.AgentID.String(),
+		"file_id":      knowledgeFile.ID.String(),
+		"created_at":   time.Now().Format(time.RFC3339),
+	}) {
+		payload[key] = value
+	}
+
+	return &qdrant.PointStruct{
+		Id:      qdrant.NewID(chunkPointID(knowledgeFile.AgentID, knowledgeFile.ID, hash)),
+		Vectors: vectors,
+		Payload: payload,
+	}
+}
+
+// chunkPositionPayload возвращает поля payload, которые меняются при сдвиге чанка внутри файла
+// или при переименовании файла, не затрагивая текст чанка
+func chunkPositionPayload(knowledgeFile *models.KnowledgeFile, chunk Chunk, position int, total int) map[string]*qdrant.Value {
+	return qdrant.NewValueMap(map[string]any{
+		"chunk_index": int64(chunk.Metadata["chunk_index"].(int)),
+		"start_idx":   int64(chunk.StartIdx),
+		"end_idx":     int64(chunk.EndIdx),
+		"file_name":   knowledgeFile.OriginalName,
+		"position":    int64(position),
+		"chunk_total": int64(total),
+	})
+}
+
+// payloadMatches сравнивает поля позиции чанка, которые содержат только строки и целые числа
+func payloadMatches(current map[string]*qdrant.Value, expected map[string]*qdrant.Value) bool {
+	for key, value := range expected {
+		actual, ok := current[key]
+		if !ok || actual.GetStringValue() != value.GetStringValue() || actual.GetIntegerValue() != value.GetIntegerValue() {
+			return false
+		}
+	}
+	return true
+}
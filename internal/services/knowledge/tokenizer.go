@@ -0,0 +1,84 @@
+package knowledge
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer разбивает текст на фрагменты с количеством токенов модели эмбеддингов.
+// Фрагменты в сумме дают исходный текст, а токены не пересекают их границ.
+type Tokenizer interface {
+	Pieces(text string) []TokenPiece
+}
+
+// TokenPiece представляет фрагмент текста и число токенов, которое он занимает
+type TokenPiece struct {
+	Text   string
+	Tokens int
+}
+
+// defaultTokenizer используется стратегией tokens. Его можно заменить точным BPE токенизатором через SetTokenizer.
+var defaultTokenizer Tokenizer = cl100kEstimator{}
+
+// SetTokenizer заменяет токенизатор, по которому считается размер чанков
+func SetTokenizer(tokenizer Tokenizer) {
+	defaultTokenizer = tokenizer
+}
+
+// cl100kPreTokenizer повторяет предварительное разбиение текста токенизатора cl100k_base,
+// который используют модели text-embedding-3. Токен никогда не пересекает границу этих фрагментов.
+var cl100kPreTokenizer = regexp.MustCompile(
+	`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+)
+
+// cl100kEstimator оценивает число токенов cl100k_base без словаря BPE: текст делится на фрагменты
+// так же, как в cl100k_base, а длина фрагмента переводится в токены по средней длине токена для алфавита.
+// Оценка сделана с запасом для кириллицы, чтобы чанк не превысил лимит модели.
+type cl100kEstimator struct{}
+
+func (cl100kEstimator) Pieces(text string) []TokenPiece {
+	matches := cl100kPreTokenizer.FindAllStringIndex(text, -1)
+	pieces := make([]TokenPiece, 0, len(matches))
+
+	position := 0
+	for _, match := range matches {
+		// Символы вне шаблона (не должны встречаться) считаются отдельным токеном
+		if match[0] > position {
+			pieces = append(pieces, TokenPiece{Text: text[position:match[0]], Tokens: 1})
+		}
+
+		piece := text[match[0]:match[1]]
+		pieces = append(pieces, TokenPiece{Text: piece, Tokens: estimateTokens(piece)})
+		position = match[1]
+	}
+
+	if position < len(text) {
+		pieces = append(pieces, TokenPiece{Text: text[position:], Tokens: 1})
+	}
+
+	return pieces
+}
+
+// estimateTokens оценивает число токенов во фрагменте: латиница — около 4 символов на токен,
+// кириллица и другие алфавиты — около 2,5 символов, знаки препинания — около 2 символов
+func estimateTokens(piece string) int {
+	var latin, other, punctuation int
+
+	for _, r := range piece {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLetter(r):
+			latin++
+		case unicode.IsLetter(r):
+			other++
+		case unicode.IsDigit(r):
+			// Числа разбиваются по 3 цифры, каждая группа — отдельный фрагмент и один токен
+			return 1
+		case !unicode.IsSpace(r):
+			punctuation++
+		}
+	}
+
+	tokens := (latin+3)/4 + (other*2+4)/5 + (punctuation+1)/2
+	return max(tokens, 1)
+}
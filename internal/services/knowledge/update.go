@@ -1 +1,50 @@
 package knowledge
+
+import (
+	"github.com/google/uuid"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/services/agent"
+	"macdent-ai-chatbot/internal/utils"
+)
+
+type ReplaceKnowledgeFileRequest struct {
+	AgentID  string          `json:"agent_id" validate:"required,uuid"`
+	FileID   string          `json:"file_id" validate:"required,uuid"`
+	File     Knowledge       `json:"file" validate:"required"`
+	Chunking ChunkingRequest `json:"chunking"`
+}
+
+// ReplaceKnowledgeFile ставит в очередь замену содержимого файла. Новые эмбеддинги создаются
+// до удаления старых чанков, поэтому при ошибке эмбеддингов файл остается в прежнем состоянии.
+func (s *Service) ReplaceKnowledgeFile(request *ReplaceKnowledgeFileRequest, queue *IngestionQueue) (*models.KnowledgeJob, *utils.UserErrorResponse) {
+	knowledgeFile, errorResponse := s.getKnowledgeFile(request.AgentID, request.FileID)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	agentUUID, _ := uuid.Parse(request.AgentID)
+	currentAgent, errorResponse := agent.NewService().
+		GetAgent(agentUUID, s.postgres)
+
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	text, mimeType, errorResponse := s.ExtractText(request.File)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	file := extractedFile{Knowledge: request.File, Text: text}
+	file.Type = mimeType
+
+	job, errorResponse := s.replaceUploadedFile(knowledgeFile, file, resolveChunking(request.Chunking, currentAgent))
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	queue.Enqueue(job.ID)
+	s.logger.Infof("замена содержимого файла %s поставлена в очередь, задача %s", knowledgeFile.ID, job.ID)
+
+	return job, nil
+}
@@ -2,18 +2,39 @@ package knowledge
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/qdrant/go-client/qdrant"
 	"macdent-ai-chatbot/internal/models"
 	"macdent-ai-chatbot/internal/services/agent"
-	openai2 "macdent-ai-chatbot/internal/services/openai"
 	"macdent-ai-chatbot/internal/utils"
 	"time"
 )
 
 type UploadKnowledgeRequest struct {
-	AgentID string      `json:"agent_id" validate:"required,uuid"`
-	Files   []Knowledge `json:"files" validate:"required,dive,required"`
+	AgentID  string          `json:"agent_id" validate:"required,uuid"`
+	Files    []Knowledge     `json:"files" validate:"required,dive,required"`
+	Chunking ChunkingRequest `json:"chunking"`
+}
+
+// ChunkingRequest задает разбиение на чанки для одной загрузки. Пустая стратегия означает настройки агента.
+type ChunkingRequest struct {
+	ChunkingStrategy string `json:"chunking_strategy" validate:"omitempty,oneof=fixed structure tokens rows"`
+	ChunkSize        int    `json:"chunk_size" validate:"gte=0,lte=8000"`
+	ChunkOverlap     int    `json:"chunk_overlap" validate:"gte=0,lte=2000"`
+}
+
+// resolveChunking возвращает настройки загрузки, а если стратегия не указана — настройки агента
+func resolveChunking(request ChunkingRequest, currentAgent *models.Agent) ChunkingRequest {
+	if request.ChunkingStrategy != "" {
+		return request
+	}
+
+	return ChunkingRequest{
+		ChunkingStrategy: currentAgent.ChunkingStrategy,
+		ChunkSize:        currentAgent.ChunkSize,
+		ChunkOverlap:     currentAgent.ChunkOverlap,
+	}
 }
 
 type Knowledge struct {
@@ -23,61 +44,171 @@ type Knowledge struct {
 	Content []byte
 }
 
-func (s *Service) UploadKnowledge(request *UploadKnowledgeRequest) *utils.UserErrorResponse {
+// extractedFile хранит загруженный файл вместе с извлеченным из него текстом
+type extractedFile struct {
+	Knowledge
+	Text string
+}
+
+// UploadKnowledgeResult описывает, во что превратился каждый загруженный файл.
+// Файлы индексируются в фоне, их прогресс отслеживается по задачам.
+// Duplicates содержит уже загруженные файлы с тем же текстом, повторно они не индексируются.
+// Новая версия уже загруженного файла с тем же именем заменяет его содержимое: такой файл
+// попадает в Files, а его задача в Jobs выполняет замену.
+type UploadKnowledgeResult struct {
+	Files      []models.KnowledgeFile   `json:"files"`
+	Prompts    []models.KnowledgePrompt `json:"prompts"`
+	Jobs       []models.KnowledgeJob    `json:"jobs"`
+	Duplicates []models.KnowledgeFile   `json:"duplicates"`
+}
+
+// UploadKnowledge загружает файлы в базу знаний агента. Из каждого файла сначала извлекается текст:
+// неподдерживаемый или поврежденный файл отклоняет весь запрос до начала загрузки.
+// Небольшие тексты сохраняются как промпты, остальные ставятся в очередь индексации,
+// где обрабатываются независимо друг от друга.
+func (s *Service) UploadKnowledge(request *UploadKnowledgeRequest, queue *IngestionQueue) (*UploadKnowledgeResult, *utils.UserErrorResponse) {
 	agentUUID, _ := uuid.Parse(request.AgentID)
 	currentAgent, errorResponse := agent.NewService().
 		GetAgent(agentUUID, s.postgres)
 
 	if errorResponse != nil {
 		s.logger.Errorf("получения агента %s: %v", request.AgentID, errorResponse)
-		return errorResponse
+		return nil, errorResponse
 	}
 
-	// Извлечение информации из файлов
-	var knowledgeSize int
-	var knowledgeContent []byte
-	for _, knowledge := range request.Files {
-		knowledgeSize += int(knowledge.Size)
-		knowledgeContent = append(knowledgeContent, knowledge.Content...)
+	files := make([]extractedFile, len(request.Files))
+	for i, file := range request.Files {
+		text, mimeType, errorResponse := s.ExtractText(file)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		file.Type = mimeType
+		files[i] = extractedFile{Knowledge: file, Text: text}
 	}
 
-	// Создание prompt knowledge
-	s.logger.Infof("длина knowledge %d байт", knowledgeSize)
-	if knowledgeSize < PromptTypeSize {
-		s.CreatePromptKnowledge(string(knowledgeContent), agentUUID)
-		return nil
+	chunking := resolveChunking(request.Chunking, currentAgent)
+
+	result := &UploadKnowledgeResult{
+		Files:      []models.KnowledgeFile{},
+		Prompts:    []models.KnowledgePrompt{},
+		Jobs:       []models.KnowledgeJob{},
+		Duplicates: []models.KnowledgeFile{},
+	}
+
+	for _, file := range files {
+		s.logger.Infof("длина knowledge %s: %d байт", file.Name, len(file.Text))
+
+		if len(file.Text) < PromptTypeSize {
+			prompt, errorResponse := s.CreatePromptKnowledge(file.Text, agentUUID)
+			if errorResponse != nil {
+				return nil, errorResponse
+			}
+			result.Prompts = append(result.Prompts, *prompt)
+			continue
+		}
+
+		contentHash := hashText(file.Text)
+
+		duplicate, errorResponse := s.findDuplicateFile(agentUUID, contentHash)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		if duplicate != nil {
+			s.logger.Infof("файл %s совпадает по содержимому с файлом %s, индексация пропущена", file.Name, duplicate.ID)
+			result.Duplicates = append(result.Duplicates, *duplicate)
+			continue
+		}
+
+		existing, errorResponse := s.findFileByName(agentUUID, file.Name)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		if existing != nil {
+			job, errorResponse := s.replaceUploadedFile(existing, file, chunking)
+			if errorResponse != nil {
+				return nil, errorResponse
+			}
+
+			queue.Enqueue(job.ID)
+			s.logger.Infof("файл %s заменяет содержимое файла %s, задача %s", file.Name, existing.ID, job.ID)
+
+			result.Files = append(result.Files, *existing)
+			result.Jobs = append(result.Jobs, *job)
+			continue
+		}
+
+		knowledgeFile, errorResponse := s.CreateKnowledgeFile(agentUUID, file.Knowledge, contentHash)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		job, errorResponse := s.createJob(knowledgeFile, models.KnowledgeJobOperationUpload, file, chunking)
+		if errorResponse != nil {
+			s.finishKnowledgeFile(knowledgeFile, 0, errorResponse)
+			return nil, errorResponse
+		}
+
+		queue.Enqueue(job.ID)
+		s.logger.Infof("файл %s поставлен в очередь индексации, задача %s", file.Name, job.ID)
+
+		result.Files = append(result.Files, *knowledgeFile)
+		result.Jobs = append(result.Jobs, *job)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
+	return result, nil
+}
 
-	// Создание коллекции в Qdrant
-	errorResponse = s.CreateCollection(ctx, &qdrant.CreateCollection{
-		CollectionName: request.AgentID,
+// prepareCollection создает коллекцию агента с размерностью модели эмбеддингов, разреженными векторами
+// ключевых слов и индексом по file_id для выборочного удаления чанков.
+// Существующая коллекция другой размерности не подходит для новых чанков.
+func (s *Service) prepareCollection(ctx context.Context, agentID uuid.UUID, embedder Embedder) (*collectionSchema, *utils.UserErrorResponse) {
+	dimensions, err := embedder.Dimensions(ctx)
+	if err != nil {
+		s.logger.Errorf("определение размерности модели %s: %v", embedder.Model(), err)
+		return nil, utils.NewUserErrorResponse(500, "Ошибка создания эмбеддингов", "Не удалось определить размерность модели эмбеддингов")
+	}
+
+	errorResponse := s.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: agentID.String(),
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-			Size:     3072,
+			Size:     uint64(dimensions),
 			Distance: qdrant.Distance_Cosine,
 		}),
+		SparseVectorsConfig: qdrant.NewSparseVectorsConfig(map[string]*qdrant.SparseVectorParams{
+			keywordVectorName: {Modifier: qdrant.Modifier_Idf.Enum()},
+		}),
 	})
 	if errorResponse != nil {
-		return errorResponse
+		return nil, errorResponse
 	}
 
-	openaiService := openai2.NewService(currentAgent.APIKey)
-	results, errorResponse := s.PrepareContent(openaiService, string(knowledgeContent), agentUUID)
+	schema, errorResponse := s.getCollectionSchema(ctx, agentID.String())
 	if errorResponse != nil {
-		return errorResponse
+		return nil, errorResponse
 	}
 
-	errorResponse = s.UpsertChunks(ctx, agentUUID, results)
-	if errorResponse != nil {
-		return errorResponse
+	if schema.Dimensions != dimensions {
+		return nil, utils.NewUserErrorResponse(
+			409,
+			"Модель эмбеддингов не совпадает с базой знаний",
+			fmt.Sprintf("База знаний создана с векторами размерности %d, а модель агента возвращает %d. Удалите базу знаний, чтобы сменить модель эмбеддингов.", schema.Dimensions, dimensions),
+		)
 	}
 
-	s.CreateKnowledgeFile(agentUUID, request.Files, len(results))
+	_, err = s.qdrant.Client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+		CollectionName: agentID.String(),
+		FieldName:      "file_id",
+		FieldType:      qdrant.FieldType_FieldTypeKeyword.Enum(),
+	})
+	if err != nil {
+		// Без индекса фильтр по file_id работает, но медленнее
+		s.logger.Warnf("создание индекса file_id в Qdrant: %v", err)
+	}
 
-	s.logger.Infof("успешно загружено %d чанков для агента %s", len(results), request.AgentID)
-	return nil
+	return schema, nil
 }
 
 func (s *Service) UpsertPoints(ctx context.Context, agentID uuid.UUID, points []*qdrant.PointStruct) *utils.UserErrorResponse {
@@ -98,30 +229,151 @@ func (s *Service) UpsertPoints(ctx context.Context, agentID uuid.UUID, points []
 	return nil
 }
 
-func (s *Service) CreatePromptKnowledge(content string, agentUUID uuid.UUID) {
+func (s *Service) CreatePromptKnowledge(content string, agentUUID uuid.UUID) (*models.KnowledgePrompt, *utils.UserErrorResponse) {
 	knowledgePrompt := models.KnowledgePrompt{
 		AgentID: agentUUID,
 		Prompt:  content,
 	}
-	s.postgres.DB.Create(&knowledgePrompt)
+
+	if err := s.postgres.DB.Create(&knowledgePrompt).Error; err != nil {
+		s.logger.Errorf("создание prompt knowledge: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка загрузки базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
 	s.logger.Infof("создание prompt knowledge для агента %s", agentUUID.String())
 	s.logger.Infof("контент knowledge: %s", knowledgePrompt.Prompt)
+	return &knowledgePrompt, nil
 }
 
-func (s *Service) CreateKnowledgeFile(agentID uuid.UUID, files []Knowledge, chunkCount int) {
-	for _, file := range files {
-		knowledgeFile := models.KnowledgeFile{
-			AgentID:        agentID,
-			FileName:       file.Name,
-			OriginalName:   file.Name,
-			FileSize:       file.Size,
-			FileType:       file.Type,
-			CollectionName: agentID.String(),
-			ChunkCount:     chunkCount,
-			Status:         "completed",
-			ProcessedAt:    &time.Time{},
-		}
-		*knowledgeFile.ProcessedAt = time.Now()
-		s.postgres.DB.Create(&knowledgeFile)
+func (s *Service) CreateKnowledgeFile(agentID uuid.UUID, file Knowledge, contentHash string) (*models.KnowledgeFile, *utils.UserErrorResponse) {
+	knowledgeFile := models.KnowledgeFile{
+		AgentID:        agentID,
+		FileName:       file.Name,
+		OriginalName:   file.Name,
+		FileSize:       file.Size,
+		FileType:       file.Type,
+		ContentHash:    contentHash,
+		CollectionName: agentID.String(),
+		Status:         models.KnowledgeFileStatusQueued,
+	}
+
+	if errorResponse := s.createKnowledgeFile(&knowledgeFile); errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	return &knowledgeFile, nil
+}
+
+func (s *Service) createKnowledgeFile(knowledgeFile *models.KnowledgeFile) *utils.UserErrorResponse {
+	if err := s.postgres.DB.Create(knowledgeFile).Error; err != nil {
+		s.logger.Errorf("создание записи файла %s: %v", knowledgeFile.OriginalName, err)
+		return utils.NewUserErrorResponse(
+			500,
+			"Ошибка загрузки базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	return nil
+}
+
+// findDuplicateFile ищет у агента файл с тем же текстом, который обработан или ожидает обработки
+func (s *Service) findDuplicateFile(agentID uuid.UUID, contentHash string) (*models.KnowledgeFile, *utils.UserErrorResponse) {
+	var knowledgeFiles []models.KnowledgeFile
+
+	err := s.postgres.DB.
+		Where("agent_id = ? AND content_hash = ? AND status <> ?", agentID, contentHash, models.KnowledgeFileStatusFailed).
+		Limit(1).
+		Find(&knowledgeFiles).Error
+
+	if err != nil {
+		s.logger.Errorf("поиск файла с тем же содержимым: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка загрузки базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	if len(knowledgeFiles) == 0 {
+		return nil, nil
+	}
+
+	return &knowledgeFiles[0], nil
+}
+
+// findFileByName ищет у агента загруженный вручную файл с тем же именем. Страницы сайтов
+// сопоставляются по адресу при синхронизации источника и здесь не учитываются.
+func (s *Service) findFileByName(agentID uuid.UUID, name string) (*models.KnowledgeFile, *utils.UserErrorResponse) {
+	var knowledgeFiles []models.KnowledgeFile
+
+	err := s.postgres.DB.
+		Where("agent_id = ? AND original_name = ? AND source_id IS NULL", agentID, name).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&knowledgeFiles).Error
+
+	if err != nil {
+		s.logger.Errorf("поиск файла с тем же именем: %v", err)
+		return nil, utils.NewUserErrorResponse(
+			500,
+			"Ошибка загрузки базы знаний",
+			"Пожалуйста, попробуйте позже или обратитесь в службу поддержки.",
+		)
+	}
+
+	if len(knowledgeFiles) == 0 {
+		return nil, nil
+	}
+
+	return &knowledgeFiles[0], nil
+}
+
+// replaceUploadedFile создает задачу замены содержимого файла новой версией
+func (s *Service) replaceUploadedFile(knowledgeFile *models.KnowledgeFile, file extractedFile, chunking ChunkingRequest) (*models.KnowledgeJob, *utils.UserErrorResponse) {
+	active, errorResponse := s.hasActiveJob(knowledgeFile.ID)
+	if errorResponse != nil {
+		return nil, errorResponse
+	}
+
+	if active {
+		return nil, utils.NewUserErrorResponse(
+			409,
+			"Файл еще обрабатывается",
+			"Дождитесь завершения текущей обработки файла и повторите замену.",
+		)
+	}
+
+	return s.createJob(knowledgeFile, models.KnowledgeJobOperationReplace, file, chunking)
+}
+
+// finishKnowledgeFile записывает итог обработки файла: количество чанков либо причину ошибки
+func (s *Service) finishKnowledgeFile(knowledgeFile *models.KnowledgeFile, chunkCount int, failure *utils.UserErrorResponse) {
+	processedAt := time.Now()
+
+	knowledgeFile.Status = models.KnowledgeFileStatusCompleted
+	knowledgeFile.ChunkCount = chunkCount
+	knowledgeFile.FailureReason = ""
+	knowledgeFile.ProcessedAt = &processedAt
+
+	if failure != nil {
+		knowledgeFile.Status = models.KnowledgeFileStatusFailed
+		knowledgeFile.ChunkCount = 0
+		knowledgeFile.FailureReason = failure.Message + ": " + failure.Details
+	}
+
+	err := s.postgres.DB.Model(knowledgeFile).Updates(map[string]interface{}{
+		"status":         knowledgeFile.Status,
+		"chunk_count":    knowledgeFile.ChunkCount,
+		"failure_reason": knowledgeFile.FailureReason,
+		"processed_at":   processedAt,
+	}).Error
+
+	if err != nil {
+		s.logger.Errorf("обновление статуса файла %s: %v", knowledgeFile.ID, err)
 	}
 }
@@ -0,0 +1,216 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Параметры загрузки страниц сайтов
+const (
+	webFetchTimeout = 30 * time.Second
+	webMaxPageSize  = 10 << 20
+	// sitemapMaxDepth ограничивает вложенность индексов sitemap
+	sitemapMaxDepth = 3
+	webUserAgent    = "MacdentKnowledgeBot/1.0"
+)
+
+// errPrivateNetwork возвращается при попытке загрузить адрес внутренней сети
+var errPrivateNetwork = errors.New("адрес внутренней сети запрещен")
+
+// WebFetcher загружает страницы и sitemap сайтов клиник
+type WebFetcher struct {
+	httpClient *http.Client
+}
+
+// webPage — загруженная страница сайта
+type webPage struct {
+	URL         string
+	ContentType string
+	Content     []byte
+}
+
+// NewWebFetcher создает загрузчик страниц. Если allowPrivateNetworks выключен, соединения с локальными
+// и внутренними адресами запрещены, чтобы через источник базы знаний нельзя было обратиться к внутренним сервисам.
+func NewWebFetcher(allowPrivateNetworks bool) *WebFetcher {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivateNetworks {
+		dialer.Control = denyPrivateNetworks
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: webFetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &WebFetcher{
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   webFetchTimeout,
+		},
+	}
+}
+
+// denyPrivateNetworks проверяет адрес уже после разрешения имени, поэтому срабатывает и при перенаправлениях
+func denyPrivateNetworks(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errPrivateNetwork
+	}
+
+	return nil
+}
+
+// Fetch загружает страницу по адресу http или https
+func (f *WebFetcher) Fetch(ctx context.Context, rawURL string) (*webPage, error) {
+	pageURL, err := url.Parse(rawURL)
+	if err != nil || (pageURL.Scheme != "http" && pageURL.Scheme != "https") || pageURL.Host == "" {
+		return nil, fmt.Errorf("некорректный адрес %q", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", webUserAgent)
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("страница %s вернула статус %d", rawURL, resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, webMaxPageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > webMaxPageSize {
+		return nil, fmt.Errorf("страница %s больше %d МБ", rawURL, webMaxPageSize>>20)
+	}
+
+	return &webPage{
+		URL:         resp.Request.URL.String(),
+		ContentType: resp.Header.Get("Content-Type"),
+		Content:     content,
+	}, nil
+}
+
+type sitemapDocument struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// SitemapURLs возвращает не более limit адресов страниц из sitemap, включая вложенные индексы sitemap.
+// Учитываются только страницы того же сайта, что и sitemap.
+func (f *WebFetcher) SitemapURLs(ctx context.Context, sitemapURL string, limit int) ([]string, error) {
+	root, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+
+	var walk func(location string, depth int) error
+	walk = func(location string, depth int) error {
+		page, err := f.Fetch(ctx, location)
+		if err != nil {
+			return err
+		}
+
+		content := page.Content
+		if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+			reader, err := gzip.NewReader(bytes.NewReader(content))
+			if err != nil {
+				return err
+			}
+			content, err = io.ReadAll(io.LimitReader(reader, webMaxPageSize))
+			if err != nil {
+				return err
+			}
+		}
+
+		var document sitemapDocument
+		if err := xml.Unmarshal(content, &document); err != nil {
+			return fmt.Errorf("разбор sitemap %s: %w", location, err)
+		}
+
+		for _, entry := range document.URLs {
+			if len(urls) >= limit {
+				return nil
+			}
+
+			loc := strings.TrimSpace(entry.Loc)
+			if seen[loc] || !sameSite(root, loc) {
+				continue
+			}
+			seen[loc] = true
+			urls = append(urls, loc)
+		}
+
+		for _, entry := range document.Sitemaps {
+			loc := strings.TrimSpace(entry.Loc)
+			if len(urls) >= limit || depth >= sitemapMaxDepth || seen[loc] || !sameSite(root, loc) {
+				continue
+			}
+			seen[loc] = true
+
+			if err := walk(loc, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(sitemapURL, 1); err != nil {
+		return nil, err
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("sitemap %s не содержит страниц сайта", sitemapURL)
+	}
+
+	return urls, nil
+}
+
+// sameSite сравнивает хост адреса с хостом sitemap без учета префикса www
+func sameSite(root *url.URL, location string) bool {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimPrefix(strings.ToLower(parsed.Host), "www.") ==
+		strings.TrimPrefix(strings.ToLower(root.Host), "www.")
+}
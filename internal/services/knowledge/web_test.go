@@ -0,0 +1,223 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newSiteServer запускает тестовый сайт. Ответы могут ссылаться на адрес сайта через {site}.
+func newSiteServer(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		content = strings.ReplaceAll(content, "{site}", server.URL)
+		if strings.HasSuffix(r.URL.Path, ".gz") {
+			w.Write(gzipBytes(t, content))
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, ".xml") {
+			w.Header().Set("Content-Type", "application/xml")
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		fmt.Fprint(w, content)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func gzipBytes(t *testing.T, content string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func urlSet(locations ...string) string {
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	for _, location := range locations {
+		builder.WriteString("<url><loc>" + location + "</loc></url>")
+	}
+	builder.WriteString("</urlset>")
+	return builder.String()
+}
+
+func sitemapIndex(locations ...string) string {
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	for _, location := range locations {
+		builder.WriteString("<sitemap><loc>" + location + "</loc></sitemap>")
+	}
+	builder.WriteString("</sitemapindex>")
+	return builder.String()
+}
+
+func TestWebFetcherFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			if r.Header.Get("User-Agent") != webUserAgent {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<p>Прайс</p>")
+		case "/limit":
+			w.Write(bytes.Repeat([]byte("a"), webMaxPageSize))
+		case "/large":
+			w.Write(bytes.Repeat([]byte("a"), webMaxPageSize+1))
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewWebFetcher(true)
+
+	page, err := fetcher.Fetch(context.Background(), server.URL+"/moved")
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if page.URL != server.URL+"/page" || page.ContentType != "text/html" || string(page.Content) != "<p>Прайс</p>" {
+		t.Errorf("страница %s %q %q", page.URL, page.ContentType, page.Content)
+	}
+
+	page, err = fetcher.Fetch(context.Background(), server.URL+"/limit")
+	if err != nil || len(page.Content) != webMaxPageSize {
+		t.Errorf("страница предельного размера не загружена: %v", err)
+	}
+
+	for _, rawURL := range []string{server.URL + "/large", server.URL + "/missing", "ftp://example.com/page", "/page"} {
+		if _, err := fetcher.Fetch(context.Background(), rawURL); err == nil {
+			t.Errorf("%s: ожидалась ошибка", rawURL)
+		}
+	}
+}
+
+func TestWebFetcherDeniesPrivateNetworks(t *testing.T) {
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	_, err := NewWebFetcher(false).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, errPrivateNetwork) {
+		t.Errorf("ошибка %v, ожидался запрет внутренней сети", err)
+	}
+	if requested {
+		t.Error("запрос дошел до сервера внутренней сети")
+	}
+}
+
+func TestDenyPrivateNetworks(t *testing.T) {
+	tests := []struct {
+		address string
+		denied  bool
+	}{
+		{address: "127.0.0.1:80", denied: true},
+		{address: "10.0.0.5:443", denied: true},
+		{address: "192.168.1.1:80", denied: true},
+		{address: "169.254.169.254:80", denied: true},
+		{address: "[::1]:80", denied: true},
+		{address: "0.0.0.0:80", denied: true},
+		{address: "93.184.216.34:443", denied: false},
+	}
+
+	for _, test := range tests {
+		err := denyPrivateNetworks("tcp", test.address, nil)
+		if (err != nil) != test.denied {
+			t.Errorf("%s: ошибка %v, запрет ожидался: %v", test.address, err, test.denied)
+		}
+	}
+}
+
+func TestSitemapURLs(t *testing.T) {
+	server := newSiteServer(t, map[string]string{
+		"/sitemap.xml": sitemapIndex("{site}/pages.xml", "{site}/services.xml.gz", "http://other.example/sitemap.xml"),
+		"/pages.xml":   urlSet("{site}/", "{site}/contacts", "http://other.example/page", "{site}/contacts"),
+		"/services.xml.gz": urlSet(
+			"{site}/implants",
+			"{site}/hygiene",
+		),
+	})
+
+	fetcher := NewWebFetcher(true)
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "вложенные и сжатые sitemap, только страницы сайта",
+			limit: 100,
+			want:  []string{"/", "/contacts", "/implants", "/hygiene"},
+		},
+		{
+			name:  "ограничение количества страниц",
+			limit: 3,
+			want:  []string{"/", "/contacts", "/implants"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			urls, err := fetcher.SitemapURLs(context.Background(), server.URL+"/sitemap.xml", test.limit)
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+
+			want := make([]string, len(test.want))
+			for i, page := range test.want {
+				want[i] = server.URL + page
+			}
+			if !slices.Equal(urls, want) {
+				t.Errorf("адреса %v, ожидались %v", urls, want)
+			}
+		})
+	}
+}
+
+func TestSitemapURLsErrors(t *testing.T) {
+	server := newSiteServer(t, map[string]string{
+		"/foreign.xml": urlSet("http://other.example/page"),
+		"/broken.xml":  "<urlset><url>",
+		"/index.xml":   sitemapIndex("{site}/missing.xml"),
+	})
+
+	fetcher := NewWebFetcher(true)
+
+	for _, name := range []string{"/foreign.xml", "/broken.xml", "/index.xml", "/missing.xml"} {
+		if _, err := fetcher.SitemapURLs(context.Background(), server.URL+name, 10); err == nil {
+			t.Errorf("%s: ожидалась ошибка", name)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package tool
+
+import (
+	"context"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/utils"
+	"slices"
+	"time"
+)
+
+// maxToolAppointments ограничивает количество записей пациента в ответе инструмента
+const maxToolAppointments = 20
+
+type createAppointmentArguments struct {
+	Patient int    `json:"patient"`
+	Doctor  int    `json:"doctor"`
+	Date    string `json:"date"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+var createAppointmentTool = requireConfirmation(NewDefinition(
+	"create_appointment",
+	"Создает запись к врачу. Выполняется только после подтверждения пользователем",
+	Schema{
+		Properties: map[string]Property{
+			"patient": {Type: TypeInteger, Description: "ID пациента диалога из find_patient или create_patient, по умолчанию пациент диалога"},
+			"doctor":  {Type: TypeInteger, Description: "ID врача, полученный из списка врачей (get_doctors)"},
+			"date":    {Type: TypeString, Description: "дата приема в формате ГГГГ-ММ-ДД"},
+			"start":   {Type: TypeString, Description: "время начала в формате ЧЧ:ММ"},
+			"end":     {Type: TypeString, Description: "время окончания в формате ЧЧ:ММ"},
+		},
+		Required: []string{"doctor", "date", "start", "end"},
+	},
+	allowAppointment,
+	func(ctx context.Context, s *Service, args createAppointmentArguments) (any, *utils.UserErrorResponse) {
+		// Записать можно только пациента диалога, найденного по телефону или созданного в диалоге
+		patientID := s.PatientID()
+		if patientID == 0 {
+			return AgentArgumentError{Message: "Пациент не определен. Найдите его через find_patient по номеру телефона или создайте через create_patient"}, nil
+		}
+		if args.Patient != 0 && args.Patient != patientID {
+			return AgentArgumentError{Message: "Записать можно только пациента диалога. Чтобы записать другого пациента, найдите его через find_patient по номеру телефона"}, nil
+		}
+		args.Patient = patientID
+
+		return s.Denttime.CreateAppointment(ctx, clients.CreateAppointmentRequest{
+			AccessToken:          s.Agent.Metadata.AccessToken,
+			DoctorID:             args.Doctor,
+			PatientID:            args.Patient,
+			AppointmentDate:      args.Date,
+			AppointmentStartTime: args.Start,
+			AppointmentEndTime:   args.End,
+		})
+	},
+))
+
+// patientNotIdentifiedMessage возвращается модели, если записями пытаются управлять до определения пациента
+const patientNotIdentifiedMessage = "Пациент диалога не определен. Найдите его через find_patient по номеру телефона"
+
+var getPatientAppointmentsTool = NewDefinition(
+	"get_patient_appointments",
+	"Возвращает предстоящие записи пациента диалога",
+	Schema{
+		Properties: map[string]Property{},
+	},
+	allowManageAppointments,
+	func(ctx context.Context, s *Service, args struct{}) (any, *utils.UserErrorResponse) {
+		patientID := s.PatientID()
+		if patientID == 0 {
+			return AgentArgumentError{Message: patientNotIdentifiedMessage}, nil
+		}
+
+		response, errorResponse := s.Denttime.FindAllAppointments(ctx, &clients.FindAppointmentsRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			PatientID:   patientID,
+			DateFrom:    time.Now().Format(DateLayout),
+		}, clients.DefaultMaxPages)
+
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		return newListResult(
+			response.Appointments,
+			maxToolAppointments,
+			response.AtPage >= response.MaxPage,
+			"Показаны не все записи пациента.",
+		), nil
+	},
+)
+
+type rescheduleAppointmentArguments struct {
+	Appointment int    `json:"appointment"`
+	Date        string `json:"date"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+}
+
+var rescheduleAppointmentTool = requireConfirmation(NewDefinition(
+	"reschedule_appointment",
+	"Переносит запись пациента диалога на другую дату и время. Выполняется только после подтверждения пользователем",
+	Schema{
+		Properties: map[string]Property{
+			"appointment": {Type: TypeInteger, Description: "ID записи из get_patient_appointments"},
+			"date":        {Type: TypeString, Description: "новая дата в формате ГГГГ-ММ-ДД"},
+			"start":       {Type: TypeString, Description: "новое время начала в формате ЧЧ:ММ"},
+			"end":         {Type: TypeString, Description: "новое время окончания в формате ЧЧ:ММ"},
+		},
+		Required: []string{"appointment", "date", "start", "end"},
+	},
+	allowManageAppointments,
+	func(ctx context.Context, s *Service, args rescheduleAppointmentArguments) (any, *utils.UserErrorResponse) {
+		if errorResponse := s.checkPatientAppointment(ctx, args.Appointment); errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		return s.Denttime.UpdateAppointment(ctx, clients.UpdateAppointmentRequest{
+			AccessToken:          s.Agent.Metadata.AccessToken,
+			AppointmentID:        args.Appointment,
+			AppointmentDate:      args.Date,
+			AppointmentStartTime: args.Start,
+			AppointmentEndTime:   args.End,
+		})
+	},
+))
+
+type cancelAppointmentArguments struct {
+	Appointment int    `json:"appointment"`
+	Reason      string `json:"reason"`
+}
+
+var cancelAppointmentTool = requireConfirmation(NewDefinition(
+	"cancel_appointment",
+	"Отменяет запись пациента диалога с указанием причины. Выполняется только после подтверждения пользователем",
+	Schema{
+		Properties: map[string]Property{
+			"appointment": {Type: TypeInteger, Description: "ID записи из get_patient_appointments"},
+			"reason":      {Type: TypeString, Description: "причина отмены со слов пациента"},
+		},
+		Required: []string{"appointment", "reason"},
+	},
+	allowManageAppointments,
+	func(ctx context.Context, s *Service, args cancelAppointmentArguments) (any, *utils.UserErrorResponse) {
+		if errorResponse := s.checkPatientAppointment(ctx, args.Appointment); errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		return s.Denttime.CancelAppointment(ctx, clients.CancelAppointmentRequest{
+			AccessToken:   s.Agent.Metadata.AccessToken,
+			AppointmentID: args.Appointment,
+			Reason:        args.Reason,
+		})
+	},
+))
+
+// checkPatientAppointment проверяет, что запись принадлежит пациенту диалога. Пациент берется из диалога,
+// а не из аргументов модели, чтобы пользователь не мог изменить чужую запись, назвав другого пациента.
+func (s *Service) checkPatientAppointment(ctx context.Context, appointmentID int) *utils.UserErrorResponse {
+	patientID := s.PatientID()
+	if patientID == 0 {
+		return utils.NewUserErrorResponse(403, "Пациент не определен", patientNotIdentifiedMessage)
+	}
+
+	response, errorResponse := s.Denttime.FindAllAppointments(ctx, &clients.FindAppointmentsRequest{
+		AccessToken: s.Agent.Metadata.AccessToken,
+		PatientID:   patientID,
+	}, clients.DefaultMaxPages)
+
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	found := slices.ContainsFunc(response.Appointments, func(appointment clients.AppointmentInfo) bool {
+		return appointment.ID == appointmentID && (appointment.PatientID == 0 || appointment.PatientID == patientID)
+	})
+
+	if !found {
+		s.logger.Warnf("запись %d не принадлежит пациенту диалога %d", appointmentID, patientID)
+		return utils.NewUserErrorResponse(
+			404,
+			"Запись не найдена",
+			"У пациента нет записи с указанным ID",
+		)
+	}
+
+	return nil
+}
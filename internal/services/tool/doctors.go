@@ -0,0 +1,42 @@
+package tool
+
+import (
+	"context"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/utils"
+)
+
+// maxToolDoctors ограничивает количество врачей в ответе инструмента
+const maxToolDoctors = 50
+
+type getDoctorsArguments struct {
+	Name string `json:"name"`
+}
+
+var getDoctorsTool = NewDefinition(
+	"get_doctors",
+	"Получает список врачей с данными",
+	Schema{
+		Properties: map[string]Property{
+			"name": {Type: TypeString, Description: "часть ФИО врача для поиска"},
+		},
+	},
+	allowDoctors,
+	func(ctx context.Context, s *Service, args getDoctorsArguments) (any, *utils.UserErrorResponse) {
+		response, errorResponse := s.Denttime.GetAllDoctors(ctx, &clients.GetDoctorsRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			FullName:    args.Name,
+		}, clients.DefaultMaxPages)
+
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		return newListResult(
+			response.Doctors,
+			maxToolDoctors,
+			response.AtPage >= response.MaxPage,
+			"Список врачей неполный. Уточните ФИО врача в параметре name.",
+		), nil
+	},
+)
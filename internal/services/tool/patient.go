@@ -0,0 +1,288 @@
+package tool
+
+import (
+	"context"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/utils"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxToolPatients ограничивает количество найденных пациентов в ответе инструмента
+const maxToolPatients = 10
+
+// phoneSignificantDigits задает количество последних цифр, по которым сравниваются телефоны,
+// чтобы +7 701 ... и 8 701 ... считались одним номером
+const phoneSignificantDigits = 10
+
+type findPatientArguments struct {
+	Phone string `json:"phone"`
+	Name  string `json:"name"`
+	Birth string `json:"birth"`
+}
+
+// maskedPatient — пациент, совпавший только по имени. Контакты не передаются, а имя маскируется,
+// чтобы по чужому имени нельзя было получить данные пациента
+type maskedPatient struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// findPatientResult содержит пациентов, подтвержденных телефоном, и ID пациента, запомненного в диалоге.
+// Совпадения только по имени возвращаются отдельно и без контактов.
+type findPatientResult struct {
+	ListResult[clients.PatientInfo]
+	NameMatches []maskedPatient `json:"name_matches,omitempty"`
+	Message     string          `json:"message,omitempty"`
+	PatientID   int             `json:"patient_id,omitempty"`
+}
+
+var findPatientTool = NewDefinition(
+	"find_patient",
+	"Ищет пациента в базе клиники по телефону и/или имени. Данные пациента возвращаются только при совпадении телефона. Вызывайте перед create_patient",
+	Schema{
+		Properties: map[string]Property{
+			"phone": {Type: TypeString, Description: "номер телефона пациента"},
+			"name":  {Type: TypeString, Description: "имя пациента"},
+			"birth": {Type: TypeString, Description: "дата рождения в формате ГГГГ-ММ-ДД, если пациент ее назвал"},
+		},
+	},
+	allowAppointment,
+	func(ctx context.Context, s *Service, args findPatientArguments) (any, *utils.UserErrorResponse) {
+		if args.Phone == "" && args.Name == "" {
+			return AgentArgumentError{Message: "Укажите телефон или имя пациента"}, nil
+		}
+
+		if args.Birth != "" {
+			birth, err := ParseDate(args.Birth)
+			if err != nil {
+				return AgentArgumentError{Message: err.Error()}, nil
+			}
+			args.Birth = birth.Format(DateLayout)
+		}
+
+		verified, nameMatches, errorResponse := s.findLikelyPatients(ctx, args.Phone, args.Name, args.Birth)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		result := findPatientResult{
+			ListResult: newListResult(
+				verified,
+				maxToolPatients,
+				true,
+				"Найдено слишком много пациентов. Уточните телефон.",
+			),
+			NameMatches: maskPatients(nameMatches),
+		}
+
+		if len(nameMatches) > 0 {
+			result.Message = "Есть совпадения только по имени. Чтобы работать с карточкой, попросите пациента назвать номер телефона из карточки"
+		}
+
+		// Единственное совпадение по телефону запоминается, чтобы не спрашивать ID при записи
+		if len(verified) == 1 {
+			s.RememberPatient(verified[0].ID)
+			result.PatientID = verified[0].ID
+		}
+
+		return result, nil
+	},
+)
+
+type createPatientArguments struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Birth   string `json:"birth"`
+	Comment string `json:"comment"`
+}
+
+// duplicatePatientResult возвращается вместо создания, если пациент уже есть в базе.
+// Данные пациентов, совпавших только по имени, не передаются.
+type duplicatePatientResult struct {
+	Message     string                `json:"message"`
+	Matches     []clients.PatientInfo `json:"matches,omitempty"`
+	NameMatches []maskedPatient       `json:"name_matches,omitempty"`
+}
+
+var createPatientTool = requireConfirmation(NewDefinition(
+	"create_patient",
+	"Создает пациента после подтверждения пользователем. Если похожий пациент уже есть в базе, пациент не создается и возвращаются совпадения",
+	Schema{
+		Properties: map[string]Property{
+			"name":    {Type: TypeString, Description: "имя пациента"},
+			"phone":   {Type: TypeString, Description: "номер телефона пациента"},
+			"birth":   {Type: TypeString, Description: "дата рождения в формате ГГГГ-ММ-ДД"},
+			"comment": {Type: TypeString, Description: "комментарий к карточке пациента"},
+		},
+		Required: []string{"name"},
+	},
+	allowAppointment,
+	func(ctx context.Context, s *Service, args createPatientArguments) (any, *utils.UserErrorResponse) {
+		if args.Birth != "" {
+			birth, err := ParseDate(args.Birth)
+			if err != nil {
+				return AgentArgumentError{Message: err.Error()}, nil
+			}
+			args.Birth = birth.Format(DateLayout)
+		}
+
+		verified, nameMatches, errorResponse := s.findLikelyPatients(ctx, args.Phone, args.Name, args.Birth)
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		if len(verified) > 0 || len(nameMatches) > 0 {
+			if len(verified) == 1 {
+				s.RememberPatient(verified[0].ID)
+			}
+
+			return duplicatePatientResult{
+				Message:     "Пациент не создан: в базе уже есть похожий пациент. Уточните у пациента, его ли это карточка. Совпадения по имени подтверждаются номером телефона из карточки",
+				Matches:     verified,
+				NameMatches: maskPatients(nameMatches),
+			}, nil
+		}
+
+		response, errorResponse := s.Denttime.CreatePatient(ctx, clients.CreatePatientRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			Name:        args.Name,
+			Phone:       args.Phone,
+			Birth:       args.Birth,
+			Comment:     args.Comment,
+		})
+
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		s.RememberPatient(response.Patient.ID)
+
+		return response, nil
+	},
+))
+
+// findLikelyPatients ищет пациентов по телефону и имени и оставляет только вероятные совпадения.
+// Пациенты с тем же номером телефона и не противоречащей датой рождения считаются подтвержденными,
+// пациенты с тем же именем — только совпадениями по имени.
+func (s *Service) findLikelyPatients(
+	ctx context.Context,
+	phone string,
+	name string,
+	birth string,
+) ([]clients.PatientInfo, []clients.PatientInfo, *utils.UserErrorResponse) {
+	var candidates []clients.PatientInfo
+
+	if normalizePhone(phone) != "" {
+		response, errorResponse := s.Denttime.FindPatients(ctx, &clients.FindPatientsRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			Phone:       phone,
+		})
+		if errorResponse != nil {
+			return nil, nil, errorResponse
+		}
+		candidates = append(candidates, response.Patients...)
+	}
+
+	if normalizeName(name) != "" {
+		response, errorResponse := s.Denttime.FindPatients(ctx, &clients.FindPatientsRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			Name:        name,
+		})
+		if errorResponse != nil {
+			return nil, nil, errorResponse
+		}
+		candidates = append(candidates, response.Patients...)
+	}
+
+	var verified []clients.PatientInfo
+	var nameMatches []clients.PatientInfo
+	seen := make(map[int]bool)
+
+	for _, candidate := range candidates {
+		if seen[candidate.ID] {
+			continue
+		}
+
+		switch {
+		case isVerifiedPatient(candidate, phone, birth):
+			verified = append(verified, candidate)
+		case isNameMatch(candidate, name, birth):
+			nameMatches = append(nameMatches, candidate)
+		default:
+			continue
+		}
+
+		seen[candidate.ID] = true
+	}
+
+	return verified, nameMatches, nil
+}
+
+// isVerifiedPatient проверяет совпадение телефона и, если дата рождения известна, ее совпадение
+func isVerifiedPatient(patient clients.PatientInfo, phone string, birth string) bool {
+	if normalizePhone(phone) == "" || normalizePhone(patient.Phone) != normalizePhone(phone) {
+		return false
+	}
+
+	return birthMatches(patient, birth)
+}
+
+func isNameMatch(patient clients.PatientInfo, name string, birth string) bool {
+	if normalizeName(name) == "" || normalizeName(patient.Name) != normalizeName(name) {
+		return false
+	}
+
+	// Однофамильцы с разными датами рождения считаются разными пациентами
+	return birthMatches(patient, birth)
+}
+
+func birthMatches(patient clients.PatientInfo, birth string) bool {
+	if birth == "" || patient.Birth == "" {
+		return true
+	}
+
+	patientBirth, err := ParseDate(patient.Birth)
+	return err != nil || patientBirth.Format(DateLayout) == birth
+}
+
+// maskPatients оставляет от пациентов только ID и первые буквы слов имени
+func maskPatients(patients []clients.PatientInfo) []maskedPatient {
+	if len(patients) > maxToolPatients {
+		patients = patients[:maxToolPatients]
+	}
+
+	masked := make([]maskedPatient, len(patients))
+	for i, patient := range patients {
+		words := strings.Fields(patient.Name)
+		for j, word := range words {
+			first, _ := utf8.DecodeRuneInString(word)
+			words[j] = string(first) + "***"
+		}
+
+		masked[i] = maskedPatient{ID: patient.ID, Name: strings.Join(words, " ")}
+	}
+
+	return masked
+}
+
+func normalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+
+	if len(digits) > phoneSignificantDigits {
+		digits = digits[len(digits)-phoneSignificantDigits:]
+	}
+
+	return digits
+}
+
+func normalizeName(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,86 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+)
+
+// Definition описывает инструмент, доступный агенту: его схему, требуемое разрешение и обработчик
+type Definition struct {
+	Name        string
+	Description string
+	Schema      Schema
+	Permission  func(permission models.Permission) bool
+	Handler     func(ctx context.Context, s *Service, arguments string) (any, *utils.UserErrorResponse)
+
+	// Инструменты, изменяющие данные клиники, выполняются только после подтверждения пользователем
+	RequiresConfirmation bool
+}
+
+// NewDefinition создает инструмент с типизированными аргументами.
+// Аргументы разбираются в T только после проверки по схеме.
+func NewDefinition[T any](
+	name string,
+	description string,
+	schema Schema,
+	permission func(permission models.Permission) bool,
+	handler func(ctx context.Context, s *Service, args T) (any, *utils.UserErrorResponse),
+) *Definition {
+	return &Definition{
+		Name:        name,
+		Description: description,
+		Schema:      schema,
+		Permission:  permission,
+		Handler: func(ctx context.Context, s *Service, arguments string) (any, *utils.UserErrorResponse) {
+			var args T
+
+			if arguments != "" {
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					s.logger.Errorf("разбор аргументов инструмента %s: %v", name, err)
+					return nil, utils.NewUserErrorResponse(
+						400,
+						"Не удалось разобрать аргументы",
+						err.Error(),
+					)
+				}
+			}
+
+			return handler(ctx, s, args)
+		},
+	}
+}
+
+// requireConfirmation помечает инструмент как требующий подтверждения пользователем
+func requireConfirmation(definition *Definition) *Definition {
+	definition.RequiresConfirmation = true
+	return definition
+}
+
+// Разрешения агента, которыми ограничивается доступ к инструментам
+func allowDoctors(permission models.Permission) bool            { return permission.Doctors }
+func allowSchedule(permission models.Permission) bool           { return permission.Schedule }
+func allowAppointment(permission models.Permission) bool        { return permission.Appointment }
+func allowManageAppointments(permission models.Permission) bool { return permission.ManageAppointments }
+
+// registry содержит все инструменты в порядке, в котором они передаются модели
+var registry = []*Definition{
+	getDoctorsTool,
+	getScheduleTool,
+	createAppointmentTool,
+	findPatientTool,
+	createPatientTool,
+	getPatientAppointmentsTool,
+	rescheduleAppointmentTool,
+	cancelAppointmentTool,
+}
+
+func findDefinition(name string) *Definition {
+	for _, definition := range registry {
+		if definition.Name == name {
+			return definition
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package tool
+
+// ListResult ограничивает размер списков, которые передаются модели,
+// чтобы ответ инструмента помещался в контекст
+type ListResult[T any] struct {
+	Items     []T    `json:"items"`
+	Total     int    `json:"total"`
+	Truncated bool   `json:"truncated"`
+	Hint      string `json:"hint,omitempty"`
+}
+
+// newListResult оставляет не более limit элементов. complete сообщает,
+// были ли загружены все страницы источника.
+func newListResult[T any](items []T, limit int, complete bool, hint string) ListResult[T] {
+	result := ListResult[T]{
+		Items: items,
+		Total: len(items),
+	}
+
+	if len(items) > limit {
+		result.Items = items[:limit]
+		result.Truncated = true
+	}
+	if !complete {
+		result.Truncated = true
+	}
+	if result.Truncated {
+		result.Hint = hint
+	}
+
+	return result
+}
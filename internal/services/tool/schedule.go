@@ -0,0 +1,101 @@
+package tool
+
+import (
+	"context"
+	"macdent-ai-chatbot/internal/clients"
+	"macdent-ai-chatbot/internal/utils"
+	"time"
+)
+
+// maxToolSlots ограничивает количество свободных окон в ответе инструмента
+const maxToolSlots = 40
+
+// maxScheduleDays ограничивает диапазон дат одного запроса расписания
+const maxScheduleDays = 31
+
+// defaultAppointmentDuration используется, если модель не указала длительность приема
+const defaultAppointmentDuration = 30
+
+type getScheduleArguments struct {
+	Doctor   int    `json:"doctor"`
+	DateFrom string `json:"date_from"`
+	DateTo   string `json:"date_to"`
+	Duration int    `json:"duration"`
+}
+
+var getScheduleTool = NewDefinition(
+	"get_schedule",
+	"Возвращает свободные окна для записи к врачу в указанном диапазоне дат с учетом уже существующих записей",
+	Schema{
+		Properties: map[string]Property{
+			"doctor":    {Type: TypeInteger, Description: "ID врача, полученный из списка врачей (get_doctors)"},
+			"date_from": {Type: TypeString, Description: "первая дата диапазона в формате ГГГГ-ММ-ДД"},
+			"date_to":   {Type: TypeString, Description: "последняя дата диапазона в формате ГГГГ-ММ-ДД, по умолчанию равна date_from"},
+			"duration":  {Type: TypeInteger, Description: "длительность приема в минутах, по умолчанию 30"},
+		},
+		Required: []string{"doctor", "date_from"},
+	},
+	allowSchedule,
+	func(ctx context.Context, s *Service, args getScheduleArguments) (any, *utils.UserErrorResponse) {
+		from, err := ParseDate(args.DateFrom)
+		if err != nil {
+			return nil, utils.NewUserErrorResponse(400, "Неверные аргументы", err.Error())
+		}
+
+		to := from
+		if args.DateTo != "" {
+			if to, err = ParseDate(args.DateTo); err != nil {
+				return nil, utils.NewUserErrorResponse(400, "Неверные аргументы", err.Error())
+			}
+		}
+
+		if to.Before(from) {
+			return nil, utils.NewUserErrorResponse(400, "Неверные аргументы", "date_to не может быть раньше date_from")
+		}
+		if to.Sub(from) > maxScheduleDays*24*time.Hour {
+			return nil, utils.NewUserErrorResponse(400, "Неверные аргументы", "диапазон дат не может превышать 31 день")
+		}
+
+		duration := args.Duration
+		if duration <= 0 {
+			duration = defaultAppointmentDuration
+		}
+
+		schedules, errorResponse := s.Denttime.GetAllSchedules(ctx, &clients.GetScheduleRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			DoctorID:    args.Doctor,
+		}, clients.DefaultMaxPages)
+
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		appointments, errorResponse := s.Denttime.FindAllAppointments(ctx, &clients.FindAppointmentsRequest{
+			AccessToken: s.Agent.Metadata.AccessToken,
+			DoctorID:    args.Doctor,
+			DateFrom:    from.Format(DateLayout),
+			DateTo:      to.Format(DateLayout),
+		}, clients.DefaultMaxPages)
+
+		if errorResponse != nil {
+			return nil, errorResponse
+		}
+
+		slots := ComputeFreeSlots(
+			args.Doctor,
+			schedules.Schedules,
+			appointments.Appointments,
+			from,
+			to,
+			time.Duration(duration)*time.Minute,
+			time.Now(),
+		)
+
+		return newListResult(
+			slots,
+			maxToolSlots,
+			schedules.AtPage >= schedules.MaxPage && appointments.AtPage >= appointments.MaxPage,
+			"Показаны не все свободные окна. Сузьте диапазон дат.",
+		), nil
+	},
+)
@@ -0,0 +1,147 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/openai/openai-go"
+	"math"
+	"slices"
+)
+
+// Типы параметров JSON схемы
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+)
+
+// Property описывает параметр инструмента в JSON схеме
+type Property struct {
+	Type        string
+	Description string
+	Enum        []string
+	Items       *Property
+}
+
+// Schema описывает аргументы инструмента: объект с параметрами и списком обязательных
+type Schema struct {
+	Properties map[string]Property
+	Required   []string
+}
+
+func (p Property) toMap() map[string]interface{} {
+	property := map[string]interface{}{
+		"type": p.Type,
+	}
+	if p.Description != "" {
+		property["description"] = p.Description
+	}
+	if len(p.Enum) > 0 {
+		property["enum"] = p.Enum
+	}
+	if p.Items != nil {
+		property["items"] = p.Items.toMap()
+	}
+	return property
+}
+
+// Parameters возвращает схему в формате параметров функции OpenAI
+func (s Schema) Parameters() openai.FunctionParameters {
+	properties := make(map[string]interface{}, len(s.Properties))
+	for name, property := range s.Properties {
+		properties[name] = property.toMap()
+	}
+
+	parameters := openai.FunctionParameters{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(s.Required) > 0 {
+		parameters["required"] = s.Required
+	}
+
+	return parameters
+}
+
+// Validate проверяет аргументы, сгенерированные моделью, на соответствие схеме.
+// Текст ошибки предназначен для модели, чтобы она могла исправить вызов.
+func (s Schema) Validate(arguments string) error {
+	args := map[string]interface{}{}
+
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return fmt.Errorf("не удалось разобрать аргументы: ожидается JSON объект")
+		}
+	}
+
+	for _, name := range s.Required {
+		value, ok := args[name]
+		if !ok || value == nil || value == "" {
+			return fmt.Errorf("не указан обязательный параметр %s%s", name, describe(s.Properties[name]))
+		}
+	}
+
+	for name, value := range args {
+		property, ok := s.Properties[name]
+		if !ok {
+			return fmt.Errorf("неизвестный параметр %s", name)
+		}
+
+		if err := property.validate(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p Property) validate(name string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	valid := true
+	switch p.Type {
+	case TypeString:
+		str, ok := value.(string)
+		valid = ok && (len(p.Enum) == 0 || slices.Contains(p.Enum, str))
+	case TypeInteger:
+		number, ok := value.(float64)
+		valid = ok && number == math.Trunc(number)
+	case TypeNumber:
+		_, valid = value.(float64)
+	case TypeBoolean:
+		_, valid = value.(bool)
+	case TypeArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			valid = false
+			break
+		}
+		if p.Items != nil {
+			for i, item := range items {
+				if err := p.Items.validate(fmt.Sprintf("%s[%d]", name, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if !valid {
+		if len(p.Enum) > 0 {
+			return fmt.Errorf("параметр %s должен быть одним из значений: %v", name, p.Enum)
+		}
+		return fmt.Errorf("параметр %s должен иметь тип %s%s", name, p.Type, describe(p))
+	}
+
+	return nil
+}
+
+func describe(property Property) string {
+	if property.Description == "" {
+		return ""
+	}
+	return " (" + property.Description + ")"
+}
@@ -1,32 +1,121 @@
 package tool
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/charmbracelet/log"
 	"github.com/openai/openai-go"
 	"macdent-ai-chatbot/internal/clients"
 	"macdent-ai-chatbot/internal/models"
 	"macdent-ai-chatbot/internal/utils"
+	"slices"
+	"sync"
+	"time"
 )
 
+// maxParallelToolCalls ограничивает количество одновременно выполняемых инструментов
+const maxParallelToolCalls = 4
+
+// toolCallTimeout ограничивает время выполнения одного инструмента
+const toolCallTimeout = 30 * time.Second
+
+// toolCallFailedResult передается модели, если результат инструмента не удалось сформировать
+const toolCallFailedResult = `{"message":"Не удалось получить результат инструмента, попробуйте позже"}`
+
 type Service struct {
-	Agent  *models.Agent
-	logger *log.Logger
+	Agent       *models.Agent
+	Denttime    *clients.Client
+	logger      *log.Logger
+	notifyMutex sync.Mutex
+
+	// ID пациента, найденного или созданного в диалоге
+	patientMutex sync.Mutex
+	patientID    int
+
+	// Вызовы, отложенные до подтверждения пользователем
+	pendingMutex sync.Mutex
+	pendingCalls []PendingCall
+
+	// Необязательные обработчики для отслеживания выполнения инструментов
+	OnToolStarted  func(toolCall openai.ChatCompletionMessageToolCall)
+	OnToolFinished func(toolCall openai.ChatCompletionMessageToolCall, result string)
+}
+
+type toolCallResult struct {
+	content string
+	ok      bool
+	// Вызов, отложенный до подтверждения пользователем
+	pending *PendingCall
 }
 
 type AgentArgumentError struct {
 	Message string `json:"message"`
 }
 
-func NewService(agent *models.Agent) *Service {
+// PendingCall описывает вызов инструмента, который ожидает подтверждения пользователем
+type PendingCall struct {
+	ToolCallID string
+	Name       string
+	Arguments  string
+}
+
+// pendingToolResult передается модели вместо результата отложенного инструмента
+type pendingToolResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func NewService(agent *models.Agent, denttime *clients.Client) *Service {
 	logger := utils.NewLogger("tool")
 
 	return &Service{
-		Agent:  agent,
-		logger: logger,
+		Agent:    agent,
+		Denttime: denttime,
+		logger:   logger,
 	}
 }
 
+// RememberPatient запоминает пациента диалога, чтобы последующие записи использовали его ID
+func (s *Service) RememberPatient(patientID int) {
+	if patientID == 0 {
+		return
+	}
+
+	s.patientMutex.Lock()
+	defer s.patientMutex.Unlock()
+
+	s.patientID = patientID
+}
+
+// PatientID возвращает ID пациента диалога или 0, если пациент еще не определен
+func (s *Service) PatientID() int {
+	s.patientMutex.Lock()
+	defer s.patientMutex.Unlock()
+
+	return s.patientID
+}
+
+// PendingCalls возвращает вызовы, отложенные до подтверждения пользователем
+func (s *Service) PendingCalls() []PendingCall {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+
+	return slices.Clone(s.pendingCalls)
+}
+
+// ExecuteConfirmed выполняет подтвержденный пользователем вызов инструмента и возвращает его результат
+func (s *Service) ExecuteConfirmed(name string, arguments string) (string, bool) {
+	result := s.executeToolCallWithTimeout(context.Background(), openai.ChatCompletionMessageToolCall{
+		Function: openai.ChatCompletionMessageToolCallFunction{
+			Name:      name,
+			Arguments: arguments,
+		},
+	}, true)
+
+	return result.content, result.ok
+}
+
 func (s *Service) HasToolCalls(toolCalls []openai.ChatCompletionMessageToolCall) bool {
 
 	if len(toolCalls) == 0 {
@@ -38,247 +127,194 @@ func (s *Service) HasToolCalls(toolCalls []openai.ChatCompletionMessageToolCall)
 	return true
 }
 
-func (s *Service) ExecuteToolCalls(messages []openai.ChatCompletionMessageParamUnion, toolMessage openai.ChatCompletionMessage) []openai.ChatCompletionMessageParamUnion {
+// ExecuteToolCalls выполняет вызовы инструментов одного ответа модели параллельно
+// и добавляет результаты и отложенные вызовы в порядке вызовов, чтобы история диалога
+// и порядок подтверждения оставались детерминированными. На каждый вызов добавляется ответ,
+// иначе OpenAI API отклонит следующий запрос. После отмены ctx оставшиеся вызовы не выполняются.
+func (s *Service) ExecuteToolCalls(
+	ctx context.Context,
+	messages []openai.ChatCompletionMessageParamUnion,
+	toolMessage openai.ChatCompletionMessage,
+) []openai.ChatCompletionMessageParamUnion {
 	var toolResults []openai.ChatCompletionMessageParamUnion
 
 	toolResults = append(toolResults, messages...)
 	toolResults = append(toolResults, toolMessage)
 
-	for _, toolCall := range toolMessage.ToolCalls {
-		switch toolCall.Function.Name {
-		case "get_doctors":
-			s.logger.Info("вызов инструмента get_doctors")
-			doctorsResponse, errorResponse := clients.GetDoctors(&clients.GetDoctorsRequest{
-				AccessToken: s.Agent.Metadata.AccessToken,
-			})
-
-			if errorResponse != nil {
-				s.logger.Errorf("обработка инструмента get_doctors: %v", errorResponse)
-				errorJSON, err := json.Marshal(errorResponse)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
-
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
-
-			responseJSON, err := json.Marshal(doctorsResponse)
-			if err != nil {
-				s.logger.Errorf("создание json: %v", err)
-				continue
-			}
-			toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(responseJSON)))
-		case "create_patient":
-			s.logger.Info("вызов инструмента create_patient")
-
-			var args map[string]interface{}
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-				s.logger.Errorf("разбор аргументов инструмента create_patient: %v", err)
-
-				errorObj := AgentArgumentError{Message: "Не удалось разобрать аргументы"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
-
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+	results := make([]toolCallResult, len(toolMessage.ToolCalls))
+	workers := make(chan struct{}, maxParallelToolCalls)
 
-			name, ok := args["name"].(string)
-			if !ok || name == "" {
-				s.logger.Errorf("отсутствует имя пациента")
+	var wg sync.WaitGroup
+	for i, toolCall := range toolMessage.ToolCalls {
+		wg.Add(1)
 
-				errorObj := AgentArgumentError{Message: "Необходимо указать имя пациента"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+		go func() {
+			defer wg.Done()
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+			workers <- struct{}{}
+			defer func() { <-workers }()
 
-			patientRequest := clients.CreatePatientRequest{
-				AccessToken: s.Agent.Metadata.AccessToken,
-				Name:        name,
+			if ctx.Err() != nil {
+				results[i] = s.toolResult(AgentArgumentError{Message: "Выполнение инструмента отменено"})
+				return
 			}
 
-			patientResponse, errorResponse := clients.CreatePatient(patientRequest)
+			s.notifyToolStarted(toolCall)
+			results[i] = s.executeToolCallWithTimeout(ctx, toolCall, false)
+			s.notifyToolFinished(toolCall, results[i].content)
+		}()
+	}
+	wg.Wait()
 
-			if errorResponse != nil {
-				s.logger.Errorf("обработка инструмента create_patient: %v", errorResponse)
-				errorJSON, err := json.Marshal(errorResponse)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+	s.pendingMutex.Lock()
+	for i, toolCall := range toolMessage.ToolCalls {
+		content := results[i].content
+		if !results[i].ok {
+			content = toolCallFailedResult
+		}
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+		toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, content))
 
-			responseJSON, err := json.Marshal(patientResponse)
-			if err != nil {
-				s.logger.Errorf("создание json: %v", err)
-				continue
-			}
-
-			toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(responseJSON)))
-		case "get_schedule":
-			s.logger.Info("вызов инструмента get_schedule")
-			scheduleResponse, errorResponse := clients.GetSchedule(&clients.GetScheduleRequest{
-				AccessToken: s.Agent.Metadata.AccessToken,
-			})
-
-			if errorResponse != nil {
-				s.logger.Errorf("обработка инструмента get_schedule: %v", errorResponse)
-				errorJSON, err := json.Marshal(errorResponse)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
-
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+		if results[i].pending != nil {
+			s.pendingCalls = append(s.pendingCalls, *results[i].pending)
+		}
+	}
+	s.pendingMutex.Unlock()
 
-			responseJSON, err := json.Marshal(scheduleResponse)
-			if err != nil {
-				s.logger.Errorf("создание json: %v", err)
-				continue
-			}
-			toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(responseJSON)))
-		case "create_appointment":
-			s.logger.Info("вызов инструмента create_appointment")
-
-			var args map[string]interface{}
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-				s.logger.Errorf("разбор аргументов инструмента create_appointment: %v", err)
-
-				errorObj := AgentArgumentError{Message: "Не удалось разобрать аргументы"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
-
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+	s.logger.Infof("Выполнение инструментов завершено, добавлено %d сообщений", len(toolResults)-len(messages)-1)
+	return toolResults
+}
 
-			patientID, ok := args["patient"].(float64)
-			if !ok {
-				s.logger.Errorf("неверный формат ID пациента: %v", args["patient"])
+func (s *Service) executeToolCallWithTimeout(parent context.Context, toolCall openai.ChatCompletionMessageToolCall, confirmed bool) toolCallResult {
+	ctx, cancel := context.WithTimeout(parent, toolCallTimeout)
+	defer cancel()
 
-				errorObj := AgentArgumentError{Message: "Не указан ID пациента. Сначала создайте пациента с помощью инструмента create_patient и используйте полученный ID"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+	done := make(chan toolCallResult, 1)
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Errorf("panic в инструменте %s: %v", toolCall.Function.Name, r)
+				done <- s.toolResult(AgentArgumentError{Message: "Внутренняя ошибка инструмента " + toolCall.Function.Name})
 			}
+		}()
+
+		done <- s.executeToolCall(ctx, toolCall, confirmed)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			s.logger.Warnf("выполнение инструмента %s отменено: %v", toolCall.Function.Name, parent.Err())
+			return s.toolResult(AgentArgumentError{Message: "Выполнение инструмента отменено"})
+		}
 
-			doctorID, ok := args["doctor"].(float64)
-			if !ok {
-				s.logger.Errorf("неверный формат ID врача: %v", args["doctor"])
-
-				errorObj := AgentArgumentError{Message: "Не указан ID врача. Сначала получите список врачей с помощью инструмента get_doctors и выберите нужный ID"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+		s.logger.Errorf("превышено время выполнения инструмента %s: %v", toolCall.Function.Name, toolCallTimeout)
+		return s.toolResult(AgentArgumentError{
+			Message: fmt.Sprintf("Инструмент %s не ответил за %v, попробуйте позже", toolCall.Function.Name, toolCallTimeout),
+		})
+	}
+}
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+// Обработчики прогресса вызываются из разных горутин, поэтому выполняются последовательно
+func (s *Service) notifyToolStarted(toolCall openai.ChatCompletionMessageToolCall) {
+	if s.OnToolStarted == nil {
+		return
+	}
 
-			date, ok := args["date"].(string)
-			if !ok {
-				s.logger.Errorf("неверный формат даты: %v", args["date"])
+	s.notifyMutex.Lock()
+	defer s.notifyMutex.Unlock()
+	s.OnToolStarted(toolCall)
+}
 
-				errorObj := AgentArgumentError{Message: "Неверный формат даты"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+func (s *Service) notifyToolFinished(toolCall openai.ChatCompletionMessageToolCall, result string) {
+	if s.OnToolFinished == nil {
+		return
+	}
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+	s.notifyMutex.Lock()
+	defer s.notifyMutex.Unlock()
+	s.OnToolFinished(toolCall, result)
+}
 
-			start, ok := args["start"].(string)
-			if !ok {
-				s.logger.Errorf("неверный формат времени начала: %v", args["start"])
+func (s *Service) executeToolCall(ctx context.Context, toolCall openai.ChatCompletionMessageToolCall, confirmed bool) toolCallResult {
+	name := toolCall.Function.Name
+	s.logger.Infof("вызов инструмента %s", name)
 
-				errorObj := AgentArgumentError{Message: "Неверный формат времени начала"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+	definition := findDefinition(name)
+	if definition == nil || !definition.Permission(s.Agent.Permission) {
+		s.logger.Warnf("неизвестный или недоступный инструмент: %s", name)
+		return s.toolResult(AgentArgumentError{Message: "Инструмент " + name + " недоступен"})
+	}
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+	if err := definition.Schema.Validate(toolCall.Function.Arguments); err != nil {
+		s.logger.Errorf("проверка аргументов инструмента %s: %v", name, err)
+		return s.toolResult(AgentArgumentError{Message: err.Error()})
+	}
 
-			end, ok := args["end"].(string)
-			if !ok {
-				s.logger.Errorf("неверный формат времени окончания: %v", args["end"])
+	if definition.RequiresConfirmation && !confirmed {
+		s.logger.Infof("инструмент %s ожидает подтверждения пользователем", name)
+		result := s.toolResult(pendingToolResult{
+			Status:  "pending_confirmation",
+			Message: "Действие не выполнено и ожидает подтверждения. Перечислите пользователю его параметры и попросите подтвердить",
+		})
+		result.pending = &PendingCall{
+			ToolCallID: toolCall.ID,
+			Name:       name,
+			Arguments:  s.withDialogPatient(definition, toolCall.Function.Arguments),
+		}
+		return result
+	}
 
-				errorObj := AgentArgumentError{Message: "Неверный формат времени окончания"}
-				errorJSON, err := json.Marshal(errorObj)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+	result, errorResponse := definition.Handler(ctx, s, toolCall.Function.Arguments)
+	if errorResponse != nil {
+		s.logger.Errorf("обработка инструмента %s: %v", name, errorResponse)
+		return s.toolResult(errorResponse)
+	}
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+	return s.toolResult(result)
+}
 
-			appointmentRequest := clients.CreateAppointmentRequest{
-				AccessToken:          s.Agent.Metadata.AccessToken,
-				DoctorID:             int(doctorID),
-				PatientID:            int(patientID),
-				AppointmentDate:      date,
-				AppointmentStartTime: start,
-				AppointmentEndTime:   end,
-			}
+// withDialogPatient подставляет пациента диалога в аргументы отложенного вызова,
+// чтобы пользователь подтверждал действие с конкретным пациентом
+func (s *Service) withDialogPatient(definition *Definition, arguments string) string {
+	patientID := s.PatientID()
+	if _, ok := definition.Schema.Properties["patient"]; !ok || patientID == 0 {
+		return arguments
+	}
 
-			appointmentResponse, errorResponse := clients.CreateAppointment(appointmentRequest)
+	args := map[string]interface{}{}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return arguments
+		}
+	}
+	if patient, ok := args["patient"].(float64); ok && patient != 0 {
+		return arguments
+	}
 
-			if errorResponse != nil {
-				s.logger.Errorf("обработка инструмента create_appointment: %v", errorResponse)
-				errorJSON, err := json.Marshal(errorResponse)
-				if err != nil {
-					s.logger.Errorf("создание json: %v", err)
-					continue
-				}
+	args["patient"] = patientID
+	resolved, err := json.Marshal(args)
+	if err != nil {
+		return arguments
+	}
 
-				toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(errorJSON)))
-				continue
-			}
+	return string(resolved)
+}
 
-			responseJSON, err := json.Marshal(appointmentResponse)
-			if err != nil {
-				s.logger.Errorf("создание json: %v", err)
-				continue
-			}
+func (s *Service) toolResult(result any) toolCallResult {
+	content, ok := s.marshalToolResult(result)
+	return toolCallResult{content: content, ok: ok}
+}
 
-			toolResults = append(toolResults, openai.ToolMessage(toolCall.ID, string(responseJSON)))
-		}
+func (s *Service) marshalToolResult(result any) (string, bool) {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		s.logger.Errorf("создание json: %v", err)
+		return "", false
 	}
 
-	s.logger.Infof("Выполнение инструментов завершено, добавлено %d сообщений", len(toolResults)-len(messages)-1)
-	return toolResults
+	return string(resultJSON), true
 }
@@ -0,0 +1,151 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openai/openai-go"
+	"macdent-ai-chatbot/internal/models"
+	"macdent-ai-chatbot/internal/utils"
+	"sync/atomic"
+	"testing"
+)
+
+func allowAll(models.Permission) bool { return true }
+
+// withTestTools добавляет инструменты в реестр на время теста
+func withTestTools(t *testing.T, definitions ...*Definition) {
+	t.Helper()
+
+	previous := registry
+	registry = append(append([]*Definition{}, registry...), definitions...)
+	t.Cleanup(func() { registry = previous })
+}
+
+func toolCall(id string, name string, arguments string) openai.ChatCompletionMessageToolCall {
+	return openai.ChatCompletionMessageToolCall{
+		ID:       id,
+		Function: openai.ChatCompletionMessageToolCallFunction{Name: name, Arguments: arguments},
+	}
+}
+
+// toolMessageIDs возвращает tool_call_id сообщений инструментов в порядке истории
+func toolMessageIDs(t *testing.T, messages []openai.ChatCompletionMessageParamUnion) ([]string, map[string]string) {
+	t.Helper()
+
+	var ids []string
+	contents := make(map[string]string)
+	for _, message := range messages {
+		toolMessage, ok := message.(openai.ChatCompletionToolMessageParam)
+		if !ok {
+			continue
+		}
+
+		id := toolMessage.ToolCallID.Value
+		ids = append(ids, id)
+		contents[id] = toolMessage.Content.Value[0].Text.Value
+	}
+	return ids, contents
+}
+
+func TestExecuteToolCallsOrder(t *testing.T) {
+	withTestTools(t,
+		requireConfirmation(NewDefinition[struct {
+			Step int `json:"step"`
+		}](
+			"test_confirm",
+			"Действие, требующее подтверждения",
+			Schema{Properties: map[string]Property{"step": {Type: TypeInteger}}, Required: []string{"step"}},
+			allowAll,
+			func(context.Context, *Service, struct {
+				Step int `json:"step"`
+			}) (any, *utils.UserErrorResponse) {
+				return nil, utils.NewUserErrorResponse(500, "Не должен вызываться", "")
+			},
+		)),
+		NewDefinition[struct{}](
+			"test_broken",
+			"Инструмент, результат которого нельзя сериализовать",
+			Schema{Properties: map[string]Property{}},
+			allowAll,
+			func(context.Context, *Service, struct{}) (any, *utils.UserErrorResponse) {
+				return make(chan int), nil
+			},
+		),
+	)
+
+	service := NewService(&models.Agent{}, nil)
+
+	var calls []openai.ChatCompletionMessageToolCall
+	for i := range 8 {
+		calls = append(calls, toolCall(fmt.Sprintf("confirm-%d", i), "test_confirm", fmt.Sprintf(`{"step":%d}`, i)))
+	}
+	calls = append(calls,
+		toolCall("broken", "test_broken", "{}"),
+		toolCall("unknown", "test_unknown", "{}"),
+	)
+
+	messages := service.ExecuteToolCalls(context.Background(), nil, openai.ChatCompletionMessage{ToolCalls: calls})
+
+	ids, contents := toolMessageIDs(t, messages)
+	if len(ids) != len(calls) {
+		t.Fatalf("ответов инструментов %d, ожидалось по одному на каждый из %d вызовов", len(ids), len(calls))
+	}
+	for i, call := range calls {
+		if ids[i] != call.ID {
+			t.Errorf("ответ %d относится к %s, ожидался %s", i, ids[i], call.ID)
+		}
+	}
+
+	if contents["broken"] != toolCallFailedResult {
+		t.Errorf("ответ сломанного инструмента %q, ожидалась ошибка", contents["broken"])
+	}
+	if !json.Valid([]byte(contents["unknown"])) {
+		t.Errorf("ответ неизвестного инструмента %q не является JSON", contents["unknown"])
+	}
+
+	pending := service.PendingCalls()
+	if len(pending) != 8 {
+		t.Fatalf("отложено %d вызовов, ожидалось 8", len(pending))
+	}
+	for i, call := range pending {
+		if call.ToolCallID != fmt.Sprintf("confirm-%d", i) || call.Arguments != fmt.Sprintf(`{"step":%d}`, i) {
+			t.Errorf("отложенный вызов %d: %+v, ожидался порядок вызовов модели", i, call)
+		}
+	}
+}
+
+func TestExecuteToolCallsCancelled(t *testing.T) {
+	var executed atomic.Int32
+	withTestTools(t,
+		NewDefinition[struct{}](
+			"test_side_effect",
+			"Инструмент с побочным эффектом",
+			Schema{Properties: map[string]Property{}},
+			allowAll,
+			func(context.Context, *Service, struct{}) (any, *utils.UserErrorResponse) {
+				executed.Add(1)
+				return "ok", nil
+			},
+		),
+	)
+
+	service := NewService(&models.Agent{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := []openai.ChatCompletionMessageToolCall{
+		toolCall("first", "test_side_effect", "{}"),
+		toolCall("second", "test_side_effect", "{}"),
+	}
+	messages := service.ExecuteToolCalls(ctx, nil, openai.ChatCompletionMessage{ToolCalls: calls})
+
+	if executed.Load() != 0 {
+		t.Errorf("после отмены выполнено %d инструментов", executed.Load())
+	}
+	ids, _ := toolMessageIDs(t, messages)
+	if len(ids) != len(calls) {
+		t.Errorf("ответов инструментов %d, ожидалось %d", len(ids), len(calls))
+	}
+}
@@ -0,0 +1,149 @@
+package tool
+
+import (
+	"fmt"
+	"macdent-ai-chatbot/internal/clients"
+	"strconv"
+	"time"
+)
+
+// DateLayout задает формат дат, которыми инструменты обмениваются с моделью
+const DateLayout = "2006-01-02"
+
+// TimeLayout задает формат времени приема
+const TimeLayout = "15:04"
+
+// FreeSlot описывает свободное окно для записи к врачу
+type FreeSlot struct {
+	DoctorID int    `json:"doctor"`
+	Date     string `json:"date"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// ParseDate разбирает дату в формате DateLayout или в формате ДД.ММ.ГГГГ
+func ParseDate(value string) (time.Time, error) {
+	for _, layout := range []string{DateLayout, "02.01.2006"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверный формат даты %q, ожидается ГГГГ-ММ-ДД", value)
+}
+
+// parseClock разбирает время в формате ЧЧ:ММ или ЧЧ:ММ:СС и возвращает смещение от начала дня
+func parseClock(value string) (time.Duration, error) {
+	for _, layout := range []string{TimeLayout, "15:04:05"} {
+		if clock, err := time.Parse(layout, value); err == nil {
+			return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+		}
+	}
+	return 0, fmt.Errorf("неверный формат времени %q", value)
+}
+
+func formatClock(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset.Hours()), int(offset.Minutes())%60)
+}
+
+type busyInterval struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// ComputeFreeSlots пересекает рабочие интервалы врача с существующими записями
+// и возвращает окна заданной длительности в диапазоне дат [from, to].
+// Окна в прошлом относительно now не возвращаются.
+func ComputeFreeSlots(
+	doctorID int,
+	schedules []clients.Schedule,
+	appointments []clients.AppointmentInfo,
+	from time.Time,
+	to time.Time,
+	duration time.Duration,
+	now time.Time,
+) []FreeSlot {
+	busy := make(map[string][]busyInterval)
+	for _, appointment := range appointments {
+		if appointment.DoctorID != doctorID {
+			continue
+		}
+
+		date, err := ParseDate(appointment.Date)
+		if err != nil {
+			continue
+		}
+		start, err := parseClock(appointment.StartTime)
+		if err != nil {
+			continue
+		}
+		end, err := parseClock(appointment.EndTime)
+		if err != nil {
+			continue
+		}
+
+		key := date.Format(DateLayout)
+		busy[key] = append(busy[key], busyInterval{start: start, end: end})
+	}
+
+	var slots []FreeSlot
+
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		key := date.Format(DateLayout)
+
+		for _, schedule := range schedules {
+			if schedule.DoctorID != doctorID || schedule.Year != date.Year() || schedule.Month != int(date.Month()) {
+				continue
+			}
+
+			for _, interval := range schedule.PerDayData[strconv.Itoa(date.Day())] {
+				intervalStart, err := parseClock(interval.Start)
+				if err != nil {
+					continue
+				}
+				intervalEnd, err := parseClock(interval.End)
+				if err != nil {
+					continue
+				}
+
+				start := intervalStart
+				for start+duration <= intervalEnd {
+					end := start + duration
+
+					// При пересечении с записью продолжаем сразу после нее, а не с шагом длительности
+					if busyEnd, ok := overlapEnd(busy[key], start, end); ok {
+						start = busyEnd
+						continue
+					}
+
+					if !date.Add(start).Before(now) {
+						slots = append(slots, FreeSlot{
+							DoctorID: doctorID,
+							Date:     key,
+							Start:    formatClock(start),
+							End:      formatClock(end),
+						})
+					}
+
+					start = end
+				}
+			}
+		}
+	}
+
+	return slots
+}
+
+// overlapEnd возвращает наиболее позднее окончание записи, пересекающейся с окном [start, end)
+func overlapEnd(intervals []busyInterval, start time.Duration, end time.Duration) (time.Duration, bool) {
+	var latest time.Duration
+	found := false
+
+	for _, interval := range intervals {
+		if start < interval.end && interval.start < end && interval.end > latest {
+			latest = interval.end
+			found = true
+		}
+	}
+
+	return latest, found
+}
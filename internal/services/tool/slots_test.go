@@ -0,0 +1,202 @@
+package tool
+
+import (
+	"macdent-ai-chatbot/internal/clients"
+	"slices"
+	"testing"
+	"time"
+)
+
+func mustDate(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	date, err := ParseDate(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return date
+}
+
+func schedule(doctorID int, year int, month int, days clients.DaySchedule) clients.Schedule {
+	return clients.Schedule{DoctorID: doctorID, Year: year, Month: month, PerDayData: days}
+}
+
+func appointment(doctorID int, date string, start string, end string) clients.AppointmentInfo {
+	return clients.AppointmentInfo{DoctorID: doctorID, Date: date, StartTime: start, EndTime: end}
+}
+
+func slotStrings(slots []FreeSlot) []string {
+	values := make([]string, len(slots))
+	for i, slot := range slots {
+		values[i] = slot.Date + " " + slot.Start + "-" + slot.End
+	}
+	return values
+}
+
+func TestComputeFreeSlots(t *testing.T) {
+	morning := clients.DaySchedule{"15": {{Start: "09:00", End: "11:00"}}}
+
+	tests := []struct {
+		name         string
+		schedules    []clients.Schedule
+		appointments []clients.AppointmentInfo
+		from         string
+		to           string
+		duration     time.Duration
+		now          string
+		want         []string
+	}{
+		{
+			name:      "свободный день делится на окна",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			from:      "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			want: []string{
+				"2026-06-15 09:00-09:30", "2026-06-15 09:30-10:00",
+				"2026-06-15 10:00-10:30", "2026-06-15 10:30-11:00",
+			},
+		},
+		{
+			name:      "пересекающиеся записи, окно начинается после последней из них",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			appointments: []clients.AppointmentInfo{
+				appointment(1, "2026-06-15", "09:15", "10:00"),
+				appointment(1, "2026-06-15", "09:45", "10:20"),
+			},
+			from: "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			want:     []string{"2026-06-15 10:20-10:50"},
+		},
+		{
+			name:      "вплотную идущие записи не пересекаются с окнами на их границах",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, clients.DaySchedule{"15": {{Start: "09:00", End: "12:00"}}})},
+			appointments: []clients.AppointmentInfo{
+				appointment(1, "2026-06-15", "09:30", "10:00"),
+				appointment(1, "2026-06-15", "10:00", "10:30"),
+				appointment(1, "2026-06-15", "11:00:00", "11:30:00"),
+			},
+			from: "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			want: []string{
+				"2026-06-15 09:00-09:30", "2026-06-15 10:30-11:00", "2026-06-15 11:30-12:00",
+			},
+		},
+		{
+			name:      "промежуток короче длительности приема пропускается",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			appointments: []clients.AppointmentInfo{
+				appointment(1, "15.06.2026", "09:00", "09:40"),
+				appointment(1, "15.06.2026", "10:00", "10:30"),
+			},
+			from: "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			want:     []string{"2026-06-15 10:30-11:00"},
+		},
+		{
+			name:      "промежуток ровно в длительность приема подходит",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			appointments: []clients.AppointmentInfo{
+				appointment(1, "2026-06-15", "09:00", "09:30"),
+				appointment(1, "2026-06-15", "10:15", "11:00"),
+			},
+			from: "2026-06-15", to: "2026-06-15",
+			duration: 45 * time.Minute,
+			want:     []string{"2026-06-15 09:30-10:15"},
+		},
+		{
+			name:      "длительность больше рабочего интервала",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			from:      "2026-06-15", to: "2026-06-15",
+			duration: 3 * time.Hour,
+			want:     []string{},
+		},
+		{
+			name: "диапазон через границу месяца берет расписание нужного месяца",
+			schedules: []clients.Schedule{
+				schedule(1, 2026, 1, clients.DaySchedule{
+					"1":  {{Start: "08:00", End: "09:00"}},
+					"31": {{Start: "17:00", End: "18:00"}},
+				}),
+				schedule(1, 2026, 2, clients.DaySchedule{
+					"1": {{Start: "10:00", End: "11:00"}},
+				}),
+			},
+			appointments: []clients.AppointmentInfo{
+				appointment(1, "2026-02-01", "10:00", "10:30"),
+			},
+			from: "2026-01-31", to: "2026-02-01",
+			duration: 30 * time.Minute,
+			want: []string{
+				"2026-01-31 17:00-17:30", "2026-01-31 17:30-18:00", "2026-02-01 10:30-11:00",
+			},
+		},
+		{
+			name: "диапазон через границу года",
+			schedules: []clients.Schedule{
+				schedule(1, 2025, 12, clients.DaySchedule{"31": {{Start: "09:00", End: "09:30"}}}),
+				schedule(1, 2026, 1, clients.DaySchedule{"1": {{Start: "09:00", End: "09:30"}}}),
+				schedule(1, 2026, 12, clients.DaySchedule{"31": {{Start: "12:00", End: "12:30"}}}),
+			},
+			from: "2025-12-31", to: "2026-01-01",
+			duration: 30 * time.Minute,
+			want:     []string{"2025-12-31 09:00-09:30", "2026-01-01 09:00-09:30"},
+		},
+		{
+			name:      "окна до now не возвращаются, окно ровно в now возвращается",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			from:      "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			now:      "2026-06-15 10:00",
+			want:     []string{"2026-06-15 10:00-10:30", "2026-06-15 10:30-11:00"},
+		},
+		{
+			name:      "окно, начавшееся до now, не возвращается",
+			schedules: []clients.Schedule{schedule(1, 2026, 6, morning)},
+			from:      "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			now:      "2026-06-15 09:40",
+			want:     []string{"2026-06-15 10:00-10:30", "2026-06-15 10:30-11:00"},
+		},
+		{
+			name: "расписание и записи других врачей не учитываются, неверное время записи пропускается",
+			schedules: []clients.Schedule{
+				schedule(2, 2026, 6, clients.DaySchedule{"15": {{Start: "12:00", End: "13:00"}}}),
+				schedule(1, 2026, 6, clients.DaySchedule{"15": {{Start: "09:00", End: "10:00"}, {Start: "14:00", End: "14:30"}}}),
+			},
+			appointments: []clients.AppointmentInfo{
+				appointment(2, "2026-06-15", "09:00", "10:00"),
+				appointment(1, "2026-06-15", "утро", "10:00"),
+			},
+			from: "2026-06-15", to: "2026-06-15",
+			duration: 30 * time.Minute,
+			want: []string{
+				"2026-06-15 09:00-09:30", "2026-06-15 09:30-10:00", "2026-06-15 14:00-14:30",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := mustDate(t, "2026-01-01").AddDate(-1, 0, 0)
+			if test.now != "" {
+				parsed, err := time.ParseInLocation(DateLayout+" "+TimeLayout, test.now, time.Local)
+				if err != nil {
+					t.Fatal(err)
+				}
+				now = parsed
+			}
+
+			slots := ComputeFreeSlots(1, test.schedules, test.appointments,
+				mustDate(t, test.from), mustDate(t, test.to), test.duration, now)
+
+			if got := slotStrings(slots); !slices.Equal(got, test.want) {
+				t.Errorf("окна %v, ожидались %v", got, test.want)
+			}
+			for _, slot := range slots {
+				if slot.DoctorID != 1 {
+					t.Errorf("окно %+v относится к другому врачу", slot)
+				}
+			}
+		})
+	}
+}